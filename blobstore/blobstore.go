@@ -0,0 +1,38 @@
+// Package blobstore stores the contents of uploaded files, either on the local filesystem or in
+// an S3-compatible object store.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps blobs under slash-separated keys. Blobs are written once and never changed.
+type BlobStore interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the blob under key. Seeking is cheap, so ranges can be served without
+	// reading the whole blob.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob under key; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+var keySegment = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// checkKey rejects keys that could escape the store's directory or need escaping in a URL
+func checkKey(key string) error {
+	for _, segment := range strings.Split(key, "/") {
+		if !keySegment.MatchString(segment) {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
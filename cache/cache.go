@@ -0,0 +1,196 @@
+// Package cache keeps recently read values close at hand so hot lookups skip the database. Cache is
+// the storage, of which LRU is the in-memory kind; ReadThrough puts a cache in front of a loader.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache stores values by key. Implementations decide how long values are kept, and must be safe
+// for concurrent use; one that fails to reach its storage should report a miss.
+type Cache[V any] interface {
+	Get(ctx context.Context, key string) (V, bool)
+	Set(ctx context.Context, key string, value V)
+	Delete(ctx context.Context, keys ...string)
+	Clear(ctx context.Context)
+}
+
+// LRU is an in-memory Cache holding up to a fixed number of values, each for a fixed time. When it
+// is full, the value used least recently makes room.
+type LRU[V any] struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order has the most recently used entry at the front
+	order *list.List
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// NewLRU returns an empty LRU. A capacity or ttl that is not positive makes a cache that keeps nothing.
+func NewLRU[V any](capacity int, ttl time.Duration) *LRU[V] {
+	return &LRU[V]{capacity: capacity, ttl: ttl, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Get returns the value stored for key, unless it has expired
+func (l *LRU[V]) Get(_ context.Context, key string) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var zero V
+	elem, ok := l.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[V])
+	if !time.Now().Before(entry.expires) {
+		l.remove(elem)
+		return zero, false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores value for key for the cache's TTL
+func (l *LRU[V]) Set(_ context.Context, key string, value V) {
+	if l.capacity <= 0 || l.ttl <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires := time.Now().Add(l.ttl)
+	if elem, ok := l.entries[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		entry.value, entry.expires = value, expires
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry[V]{key: key, value: value, expires: expires})
+	for l.order.Len() > l.capacity {
+		l.remove(l.order.Back())
+	}
+}
+
+// Delete removes keys; keys that are not stored are ignored
+func (l *LRU[V]) Delete(_ context.Context, keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := l.entries[key]; ok {
+			l.remove(elem)
+		}
+	}
+}
+
+// Clear removes every value
+func (l *LRU[V]) Clear(context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = map[string]*list.Element{}
+	l.order.Init()
+}
+
+// Len returns how many values are stored, counting expired ones not yet removed
+func (l *LRU[V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+func (l *LRU[V]) remove(elem *list.Element) {
+	l.order.Remove(elem)
+	delete(l.entries, elem.Value.(*lruEntry[V]).key)
+}
+
+// Stats counts what a ReadThrough did since it was made
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// Loads is how many times the loader ran; concurrent misses for a key share one load
+	Loads int64
+}
+
+// ReadThrough reads values from a cache and loads the ones it misses, storing them for the next
+// reader. Concurrent misses for a key wait for a single load instead of all hitting the loader.
+type ReadThrough[V any] struct {
+	cache Cache[V]
+	group singleflight.Group
+
+	// mu orders storing loaded values against invalidation. generation changes on every
+	// invalidation, and a load that overlapped one is not stored, since it may have read the
+	// value from before the change.
+	mu         sync.Mutex
+	generation uint64
+
+	hits, misses, loads atomic.Int64
+}
+
+// NewReadThrough returns a ReadThrough in front of c
+func NewReadThrough[V any](c Cache[V]) *ReadThrough[V] {
+	return &ReadThrough[V]{cache: c}
+}
+
+// Get returns the value for key from the cache, or from load when it is not cached. Errors from
+// load are returned and not cached.
+func (r *ReadThrough[V]) Get(ctx context.Context, key string, load func(context.Context) (V, error)) (V, error) {
+	if v, ok := r.cache.Get(ctx, key); ok {
+		r.hits.Add(1)
+		return v, nil
+	}
+	r.misses.Add(1)
+
+	v, err, _ := r.group.Do(key, func() (any, error) {
+		r.loads.Add(1)
+		r.mu.Lock()
+		generation := r.generation
+		r.mu.Unlock()
+
+		// the load is shared, so one reader going away must not fail it for the others
+		v, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return v, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.generation == generation {
+			r.cache.Set(ctx, key, v)
+		}
+		return v, nil
+	})
+	return v.(V), err
+}
+
+// Invalidate removes keys, so their next reads load them again
+func (r *ReadThrough[V]) Invalidate(ctx context.Context, keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	r.cache.Delete(ctx, keys...)
+	for _, key := range keys {
+		r.group.Forget(key)
+	}
+}
+
+// InvalidateAll removes every value
+func (r *ReadThrough[V]) InvalidateAll(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	r.cache.Clear(ctx)
+}
+
+// Stats returns the hit, miss and load counts
+func (r *ReadThrough[V]) Stats() Stats {
+	return Stats{Hits: r.hits.Load(), Misses: r.misses.Load(), Loads: r.loads.Load()}
+}
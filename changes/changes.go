@@ -0,0 +1,266 @@
+// Package changes tells every server about the posts and users changed through any of them. A
+// change is announced with Postgres NOTIFY in the transaction that makes it, so it is only heard
+// once committed; each server LISTENs on one connection and hands what it hears to its
+// subscribers. Notifications sent while a server is disconnected are lost, so after reconnecting,
+// and while it cannot, the bus asks a poller for the changes it may have missed. Subscribers may
+// therefore see a change more than once.
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rest_api/models"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// Channel is the notification channel changes are sent on
+const Channel = "rest_api_changes"
+
+// Kinds of changed row
+const (
+	KindPost = models.AggregatePost
+	KindUser = models.AggregateUser
+	// KindAllPosts and KindAllUsers say that any post or user may have changed, for writes that
+	// touch too many to name; their ID is 0
+	KindAllPosts = "posts"
+	KindAllUsers = "users"
+)
+
+// Change operations
+const (
+	OpCreated = "created"
+	OpUpdated = "updated"
+	OpDeleted = "deleted"
+)
+
+// Change is the payload of a notification: which row changed, and how
+type Change struct {
+	Kind string `json:"kind"`
+	ID   uint   `json:"id"`
+	Op   string `json:"op"`
+	// Seq is the ID of the outbox event written with the change, or 0 for changes that leave none
+	Seq uint64 `json:"seq"`
+}
+
+// FromEventType returns the change an event type like "post.updated" describes
+func FromEventType(eventType string, id uint, seq uint64) Change {
+	kind, op, _ := strings.Cut(eventType, ".")
+	return Change{Kind: kind, ID: id, Op: op, Seq: seq}
+}
+
+// Encode returns the notification payload for c
+func Encode(c Change) (string, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// Decode reads a notification payload
+func Decode(payload string) (Change, error) {
+	var c Change
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		return Change{}, err
+	}
+	if c.Kind == "" || (c.ID == 0 && c.Kind != KindAllPosts && c.Kind != KindAllUsers) {
+		return Change{}, fmt.Errorf("changes: incomplete payload %q", payload)
+	}
+	return c, nil
+}
+
+// Notify announces c when tx commits; nothing is sent if it rolls back
+func Notify(tx *gorm.DB, c Change) error {
+	payload, err := Encode(c)
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", Channel, payload).Error
+}
+
+// Poller returns the changes committed since the given time
+type Poller func(ctx context.Context, since time.Time) ([]Change, error)
+
+// Bus listens for changes and hands them to its subscribers
+type Bus struct {
+	// PollInterval is how often the poller is asked for changes while the bus cannot listen
+	PollInterval time.Duration
+	// Slack is how far before a disconnection polls start, for transactions that were committing
+	// while it happened
+	Slack time.Duration
+	// RetryBase and RetryMax bound the wait between reconnection attempts, which doubles each time
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// KeepAlive is how long the connection may stay silent before it is checked
+	KeepAlive time.Duration
+
+	poll      Poller
+	connected atomic.Bool
+
+	mu          sync.Mutex
+	subscribers map[int]func(Change)
+	next        int
+}
+
+// NewBus returns a bus that catches up with poll
+func NewBus(poll Poller) *Bus {
+	return &Bus{
+		PollInterval: 5 * time.Second,
+		Slack:        time.Minute,
+		RetryBase:    time.Second,
+		RetryMax:     30 * time.Second,
+		KeepAlive:    30 * time.Second,
+		poll:         poll,
+		subscribers:  map[int]func(Change){},
+	}
+}
+
+// Subscribe calls fn with every change until the returned function is called. fn runs on the
+// bus's goroutine and should return quickly.
+func (b *Bus) Subscribe(fn func(Change)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish hands changes to the subscribers
+func (b *Bus) Publish(changes ...Change) {
+	b.mu.Lock()
+	subscribers := make([]func(Change), 0, len(b.subscribers))
+	for _, fn := range b.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	b.mu.Unlock()
+
+	for _, c := range changes {
+		for _, fn := range subscribers {
+			fn(c)
+		}
+	}
+}
+
+// Connected reports whether the bus is listening
+func (b *Bus) Connected() bool { return b.connected.Load() }
+
+// Run listens for changes on a connection to dsn until ctx is done, reconnecting whenever the connection is lost. Once
+// listening again it polls for what was missed since the connection was lost, and it keeps
+// polling every PollInterval while it cannot reconnect.
+func (b *Bus) Run(ctx context.Context, dsn string) {
+	// since is where the next poll starts; it is zero while nothing can have been missed
+	var since time.Time
+	failures := 0
+	for ctx.Err() == nil {
+		err := b.listen(ctx, dsn, func() {
+			failures = 0
+			if since.IsZero() {
+				return
+			}
+			if _, err := b.catchUp(ctx, since); err != nil {
+				log.Println("changes: polling failed:", err)
+				return
+			}
+			since = time.Time{}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("changes: listening failed:", err)
+		if since.IsZero() {
+			since = time.Now().Add(-b.Slack)
+		}
+
+		failures++
+		wait := b.RetryBase << min(failures-1, 16)
+		if wait <= 0 || wait > b.RetryMax {
+			wait = b.RetryMax
+		}
+		retry := time.NewTimer(wait)
+		ticker := time.NewTicker(b.PollInterval)
+	waiting:
+		for {
+			select {
+			case <-ctx.Done():
+				retry.Stop()
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				next, err := b.catchUp(ctx, since)
+				if err != nil {
+					log.Println("changes: polling failed:", err)
+					continue
+				}
+				since = next
+			case <-retry.C:
+				break waiting
+			}
+		}
+		ticker.Stop()
+	}
+}
+
+// catchUp publishes the changes the poller returns since the given time, and returns where the
+// next poll should start
+func (b *Bus) catchUp(ctx context.Context, since time.Time) (time.Time, error) {
+	started := time.Now()
+	changes, err := b.poll(ctx, since)
+	if err != nil {
+		return since, err
+	}
+	b.Publish(changes...)
+	return started.Add(-b.Slack), nil
+}
+
+// listen LISTENs on a new connection to dsn and publishes what it hears until the connection fails or
+// ctx is done. listening is called once notifications are being received.
+func (b *Bus) listen(ctx context.Context, dsn string, listening func()) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{Channel}.Sanitize()); err != nil {
+		return err
+	}
+	b.connected.Store(true)
+	defer b.connected.Store(false)
+	listening()
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, b.KeepAlive)
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if waitCtx.Err() == nil {
+				return err
+			}
+			// quiet for a while: make sure the connection is still there
+			if err := conn.Ping(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		c, err := Decode(n.Payload)
+		if err != nil {
+			log.Println("changes: ignoring notification:", err)
+			continue
+		}
+		b.Publish(c)
+	}
+}
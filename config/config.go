@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
@@ -26,4 +28,36 @@ func LoadEnvVars() {
 	if err != nil {
 		log.Fatal("Error: Cannot load .env file")
 	}
-}
\ No newline at end of file
+}
+
+// GetEnv returns the value of the environment variable key, or fallback when it is unset or empty.
+func GetEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// CacheControlPolicy returns the Cache-Control policy for a route, read from CACHE_CONTROL_<route>.
+// "no-cache" lets clients and CDNs store responses but forces revalidation via ETag/Last-Modified.
+func CacheControlPolicy(route string) string {
+	return GetEnv("CACHE_CONTROL_"+route, "no-cache")
+}
+
+// GetEnvDuration parses the environment variable key as a time.Duration, or returns fallback when it is unset or invalid.
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+// GetEnvInt parses the environment variable key as an int, or returns fallback when it is unset, invalid or not positive.
+func GetEnvInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
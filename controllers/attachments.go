@@ -0,0 +1,460 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"rest_api/blobstore"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/thumbnail"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAttachmentMaxBytes = 10 << 20
+	defaultAttachmentTypes    = "image/png,image/jpeg,image/gif,image/webp,application/pdf"
+
+	// sniffBytes is how much of an upload is read to detect its type
+	sniffBytes = 3072
+	// multipartOverhead allows for the boundaries and part headers around the file
+	multipartOverhead = 64 << 10
+)
+
+// AttachmentsResponse represents the response for listing a post's attachments
+type AttachmentsResponse struct {
+	Attachments []models.JsonAttachment `json:"attachments" xml:"attachments>attachment" yaml:"attachments"`
+}
+
+// AttachmentResponse represents the response for a single attachment
+type AttachmentResponse struct {
+	Attachment models.JsonAttachment `json:"attachment" xml:"attachment" yaml:"attachment"`
+}
+
+var (
+	blobStoreOnce sync.Once
+	blobs         blobstore.BlobStore
+)
+
+// blobStore returns the store chosen by BLOB_STORE: "local" (default) keeps blobs under BLOB_DIR,
+// "s3" keeps them in S3_BUCKET at S3_ENDPOINT
+func blobStore() blobstore.BlobStore {
+	blobStoreOnce.Do(func() {
+		switch store := config.GetEnv("BLOB_STORE", "local"); store {
+		case "s3":
+			blobs = blobstore.NewS3(
+				config.GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+				config.GetEnv("S3_BUCKET", ""),
+				config.GetEnv("S3_REGION", "us-east-1"),
+				config.GetEnv("S3_ACCESS_KEY_ID", ""),
+				config.GetEnv("S3_SECRET_ACCESS_KEY", ""),
+			)
+		default:
+			if store != "local" {
+				log.Printf("warning: unknown BLOB_STORE %q, using local", store)
+			}
+			blobs = blobstore.NewLocal(config.GetEnv("BLOB_DIR", "data/blobs"))
+		}
+	})
+	return blobs
+}
+
+// SetBlobStore replaces the store attachments are kept in, e.g. with one built by the caller
+func SetBlobStore(store blobstore.BlobStore) {
+	blobStoreOnce.Do(func() {})
+	blobs = store
+}
+
+// attachmentTypes returns the allowed content types from ATTACHMENT_TYPES
+func attachmentTypes() []string {
+	var types []string
+	for _, t := range strings.Split(config.GetEnv("ATTACHMENT_TYPES", defaultAttachmentTypes), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// mapAttachment converts DB model to API DTO
+func mapAttachment(m models.Attachment) models.JsonAttachment {
+	dto := models.JsonAttachment{
+		ID:          m.ID,
+		PostID:      m.PostID,
+		Filename:    m.Filename,
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		SHA256:      m.SHA256,
+		UploaderID:  m.UploaderID,
+		URL:         fmt.Sprintf("/attachments/%d", m.ID),
+		CreatedAt:   m.CreatedAt.Format(time.RFC3339),
+
+		Width:          m.Width,
+		Height:         m.Height,
+		Blurhash:       m.Blurhash,
+		AverageColor:   m.AverageColor,
+		VariantsStatus: m.VariantsStatus,
+	}
+	// list variants in spec order, smallest first, whatever order they were loaded in
+	for _, spec := range thumbnail.Specs {
+		for _, v := range m.Variants {
+			if v.Name == spec.Name {
+				dto.Variants = append(dto.Variants, models.JsonAttachmentVariant{
+					Name:        v.Name,
+					ContentType: v.ContentType,
+					Width:       v.Width,
+					Height:      v.Height,
+					Size:        v.Size,
+					URL:         variantURL(m.ID, v.Name),
+				})
+			}
+		}
+	}
+	return dto
+}
+
+// attachmentFilename keeps the base name of an uploaded file without control characters
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+// newBlobKey returns a fresh, unguessable key for a blob of postID
+func newBlobKey(postID uint, extension string) (string, error) {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("posts/%d/%s%s", postID, hex.EncodeToString(random[:]), extension), nil
+}
+
+// AttachmentsIndex godoc
+// @Summary List the attachments of a post
+// @Tags attachments
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Success 200 {object} AttachmentsResponse "Attachments, oldest first"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/attachments [get]
+func AttachmentsIndex(c *gin.Context) {
+	var post models.Post
+	result := config.DB.Scopes(VisibleScope(viewerID(c))).First(&post, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	var attachments []models.Attachment
+	config.DB.Preload("Variants").Where("post_id = ?", post.ID).Order("id").Find(&attachments)
+
+	dto := make([]models.JsonAttachment, 0, len(attachments))
+	for _, a := range attachments {
+		dto = append(dto, mapAttachment(a))
+	}
+	respond(c, 200, AttachmentsResponse{Attachments: dto})
+}
+
+// AttachmentsCreate godoc
+// @Summary Attach a file to a post
+// @Description Upload a file as multipart field "file". The type is detected from the file's contents, not its name or the declared
+// @Description Content-Type, and must be one of ATTACHMENT_TYPES (images and PDFs by default). Files over ATTACHMENT_MAX_BYTES are rejected.
+// @Description JPEG, PNG and GIF images are answered with variants_status "pending"; their variants are made in the background.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param file formData file true "File to attach"
+// @Param X-User-ID header int false "Uploading user"
+// @Success 200 {object} AttachmentResponse "Attachment stored"
+// @Failure 400 {object} map[string]string "Missing or empty file"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 413 {object} map[string]string "File too large"
+// @Failure 415 {object} map[string]string "File type not allowed"
+// @Router /posts/{id}/attachments [post]
+func AttachmentsCreate(c *gin.Context) {
+	var post models.Post
+	uploader := viewerID(c)
+	result := config.DB.Scopes(VisibleScope(uploader)).First(&post, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	maxBytes := int64(config.GetEnvInt("ATTACHMENT_MAX_BYTES", defaultAttachmentMaxBytes))
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && header.Size > maxBytes) {
+		c.Error(fmt.Errorf("File is larger than %d bytes", maxBytes))
+		c.Status(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		c.Error(errors.New("Missing multipart field \"file\""))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if header.Size == 0 {
+		c.Error(errors.New("File is empty"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffBytes)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	detected := mimetype.Detect(head[:n])
+	allowed := attachmentTypes()
+	if !isAnyMIME(detected, allowed) {
+		c.Error(fmt.Errorf("File type %s is not allowed, expected one of %s", detected.String(), strings.Join(allowed, ", ")))
+		c.Status(http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	contentType, _, _ := strings.Cut(detected.String(), ";")
+	var content io.Reader = file
+	size := header.Size
+	if hasMetadata(contentType) {
+		// images can carry where and when they were taken; only the pixels are kept
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.Error(err)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		stripped, err := thumbnail.StripMetadata(data, config.GetEnvInt("ATTACHMENT_MAX_PIXELS", defaultAttachmentMaxPixels))
+		switch {
+		case errors.Is(err, thumbnail.ErrMalformed):
+			// not an image any viewer will show, so it is kept as it is, like other files
+			stripped = data
+		case err != nil:
+			c.Error(err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		content, size = bytes.NewReader(stripped), int64(len(stripped))
+	}
+
+	key, err := newBlobKey(post.ID, detected.Extension())
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	hash := sha256.New()
+	if err := blobStore().Put(c.Request.Context(), key, io.TeeReader(content, hash), size, contentType); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	attachment := models.Attachment{
+		PostID:      post.ID,
+		Key:         key,
+		Filename:    attachmentFilename(header.Filename),
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}
+	if uploader != 0 {
+		attachment.UploaderID = &uploader
+	}
+	if thumbnail.Supported(contentType) {
+		attachment.VariantsStatus = models.VariantsPending
+	}
+	if err := config.DB.Create(&attachment).Error; err != nil {
+		_ = blobStore().Delete(c.Request.Context(), key)
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if attachment.VariantsStatus == models.VariantsPending {
+		notifyAttachmentWorker()
+	}
+
+	respond(c, 200, AttachmentResponse{Attachment: mapAttachment(attachment)})
+}
+
+// hasMetadata reports whether files of contentType can carry metadata that StripMetadata removes
+func hasMetadata(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// isAnyMIME reports whether m, or one of its aliases, is in types
+func isAnyMIME(m *mimetype.MIME, types []string) bool {
+	for _, t := range types {
+		if m.Is(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAttachment loads the attachment from the path if the viewer may see its post, writing the error response on failure
+func findAttachment(c *gin.Context) (models.Attachment, bool) {
+	var attachment models.Attachment
+	err := config.DB.Preload("Variants").Where("post_id IN (?)", config.DB.Model(&models.Post{}).Scopes(VisibleScope(viewerID(c))).Select("id")).
+		First(&attachment, c.Param("id")).Error
+	if err != nil {
+		c.Error(errors.New("Attachment not found"))
+		c.Status(http.StatusNotFound)
+		return models.Attachment{}, false
+	}
+	return attachment, true
+}
+
+// AttachmentsDownload godoc
+// @Summary Download an attachment
+// @Description Download the file, or with ?variant= one of its resized copies (thumb, small or medium). Range requests are
+// @Description supported, with If-Range; the ETag is the file's SHA-256, followed by the variant name for variants.
+// @Tags attachments
+// @Produce application/octet-stream
+// @Param id path int true "Attachment ID"
+// @Param variant query string false "Resized copy of an image" Enums(thumb, small, medium)
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Param X-User-ID header int false "Viewing user, who also sees attachments of their own unpublished posts"
+// @Success 200 {file} file "File"
+// @Success 206 {file} file "Requested range"
+// @Success 304 "Not modified"
+// @Failure 400 {object} map[string]string "Unknown variant"
+// @Failure 404 {object} map[string]string "Attachment or variant not found"
+// @Failure 416 {string} string "Range not satisfiable"
+// @Router /attachments/{id} [get]
+func AttachmentsDownload(c *gin.Context) {
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+
+	key, contentType, etag := attachment.Key, attachment.ContentType, attachment.SHA256
+	if name, ok := c.GetQuery("variant"); ok {
+		if _, known := thumbnail.FindSpec(name); !known {
+			c.Error(fmt.Errorf("Unknown variant %q", name))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		found := false
+		for _, v := range attachment.Variants {
+			if v.Name == name {
+				key, contentType, etag, found = v.Key, v.ContentType, attachment.SHA256+"-"+v.Name, true
+			}
+		}
+		if !found {
+			c.Error(fmt.Errorf("Attachment has no %s variant", name))
+			c.Status(http.StatusNotFound)
+			return
+		}
+	}
+
+	blob, err := blobStore().Open(c.Request.Context(), key)
+	if err != nil {
+		c.Error(err)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+		} else {
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+	defer blob.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+	c.Header("ETag", `"`+etag+`"`)
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, attachment.Filename, attachment.CreatedAt, blob)
+}
+
+// AttachmentsDelete godoc
+// @Summary Delete an attachment
+// @Tags attachments
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Attachment ID"
+// @Success 200 {object} AttachmentResponse "Deleted attachment"
+// @Failure 404 {object} map[string]string "Attachment not found"
+// @Router /attachments/{id} [delete]
+func AttachmentsDelete(c *gin.Context) {
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attachment_id = ?", attachment.ID).Delete(&models.AttachmentVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&attachment).Error
+	})
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	// the rows are gone, so a blob left behind by a failed delete is unreachable but harmless
+	keys := []string{attachment.Key}
+	for _, v := range attachment.Variants {
+		keys = append(keys, v.Key)
+	}
+	for _, key := range keys {
+		if err := blobStore().Delete(c.Request.Context(), key); err != nil {
+			log.Printf("attachments: deleting blob %s: %v", key, err)
+		}
+	}
+
+	respond(c, 200, AttachmentResponse{Attachment: mapAttachment(attachment)})
+}
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BulkOpCreate = "create"
+	BulkOpUpdate = "update"
+	BulkOpDelete = "delete"
+
+	BulkModeAtomic     = "atomic"
+	BulkModeBestEffort = "best_effort"
+
+	defaultBulkBatchSize     = 100
+	defaultBulkMaxOperations = 5000
+)
+
+// BulkPostOperation is a single create, update or delete inside a bulk request
+type BulkPostOperation struct {
+	Op     string `json:"op" xml:"op" yaml:"op" example:"create"`
+	ID     uint   `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty" example:"1"`
+	Title  string `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty" example:"My First Post"`
+	Body   string `json:"body,omitempty" xml:"body,omitempty" yaml:"body,omitempty" example:"This is the content of my first post"`
+	UserID *uint  `json:"user_id,omitempty" xml:"user_id,omitempty" yaml:"user_id,omitempty" example:"1"`
+}
+
+// BulkPostsRequest represents the request body for bulk post operations
+type BulkPostsRequest struct {
+	Mode       string              `json:"mode" xml:"mode" yaml:"mode" binding:"omitempty,oneof=atomic best_effort" example:"atomic"`
+	Operations []BulkPostOperation `json:"operations" xml:"operations>operation" yaml:"operations" binding:"required,min=1"`
+}
+
+// BulkPostResult is the outcome of one operation, in request order
+type BulkPostResult struct {
+	Index  int              `json:"index" xml:"index" yaml:"index" example:"0"`
+	Op     string           `json:"op" xml:"op" yaml:"op" example:"create"`
+	Status int              `json:"status" xml:"status" yaml:"status" example:"200"`
+	ID     uint             `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty" example:"1"`
+	Post   *models.JsonPost `json:"post,omitempty" xml:"post,omitempty" yaml:"post,omitempty"`
+	Error  string           `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// BulkPostsResponse represents the response for bulk post operations
+type BulkPostsResponse struct {
+	Results []BulkPostResult `json:"results" xml:"results>result" yaml:"results"`
+}
+
+// PostsBulk godoc
+// @Summary Create, update and delete posts in bulk
+// @Description Apply a mixed list of operations in the order given; runs of consecutive creates are inserted in batches. In "atomic" mode (default) everything runs in one transaction and any failure rolls back the whole request.
+// @Description In "best_effort" mode each operation is applied independently and the response is 207 with a per-item status.
+// @Tags posts
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param operations body BulkPostsRequest true "Bulk operations"
+// @Success 200 {object} BulkPostsResponse "All operations applied"
+// @Success 207 {object} BulkPostsResponse "Per-item results (best_effort mode)"
+// @Failure 400 {object} BulkPostsResponse "Request rolled back (atomic mode)"
+// @Failure 413 {object} map[string]string "Too many operations"
+// @Router /posts/bulk [post]
+func PostsBulk(c *gin.Context) {
+	var body BulkPostsRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	maxOperations := config.GetEnvInt("POSTS_BULK_MAX_OPERATIONS", defaultBulkMaxOperations)
+	if len(body.Operations) > maxOperations {
+		c.Error(fmt.Errorf("Too many operations: %d, maximum is %d", len(body.Operations), maxOperations))
+		c.Status(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]BulkPostResult, len(body.Operations))
+	valid := validateBulkOperations(body.Operations, results)
+
+	if body.Mode == BulkModeBestEffort {
+		applyBulkOperations(config.DB, body.Operations, results, false)
+		invalidatePosts(bulkTargets(body.Operations)...)
+		respond(c, http.StatusMultiStatus, BulkPostsResponse{Results: results})
+		return
+	}
+
+	if valid {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			return applyBulkOperations(tx, body.Operations, results, true)
+		})
+	}
+	if !valid || err != nil {
+		markBulkRolledBack(results)
+		respond(c, http.StatusBadRequest, BulkPostsResponse{Results: results})
+		return
+	}
+	invalidatePosts(bulkTargets(body.Operations)...)
+
+	respond(c, 200, BulkPostsResponse{Results: results})
+}
+
+// bulkTargets lists the IDs of the posts that operations update or delete
+func bulkTargets(ops []BulkPostOperation) []uint {
+	var ids []uint
+	for _, op := range ops {
+		if op.Op == BulkOpUpdate || op.Op == BulkOpDelete {
+			ids = append(ids, op.ID)
+		}
+	}
+	return ids
+}
+
+// validateBulkOperations records a 400 result for every malformed operation and reports whether all were valid
+func validateBulkOperations(ops []BulkPostOperation, results []BulkPostResult) bool {
+	valid := true
+	for i, op := range ops {
+		results[i] = BulkPostResult{Index: i, Op: op.Op, ID: op.ID}
+
+		var msg string
+		switch op.Op {
+		case BulkOpCreate:
+			if op.Title == "" || op.Body == "" || op.UserID == nil || *op.UserID == 0 {
+				msg = "title, body and user_id are required for create"
+			}
+		case BulkOpUpdate, BulkOpDelete:
+			if op.ID == 0 {
+				msg = "id is required for " + op.Op
+			}
+		default:
+			msg = fmt.Sprintf("unknown op %q, expected create, update or delete", op.Op)
+		}
+
+		if msg != "" {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = msg
+			valid = false
+		}
+	}
+	return valid
+}
+
+// applyBulkOperations runs every operation that has no result yet, in request order. Consecutive
+// creates are inserted together with CreateInBatches; each update and delete runs on its own. Each
+// batch and each operation runs in its own savepoint, so in best-effort mode a failure only affects
+// its own items. In atomic mode the first failure is returned so the caller can roll back.
+func applyBulkOperations(db *gorm.DB, ops []BulkPostOperation, results []BulkPostResult, atomic bool) error {
+	batchSize := config.GetEnvInt("POSTS_BULK_BATCH_SIZE", defaultBulkBatchSize)
+
+	var creates []int
+	for i, op := range ops {
+		if results[i].Status != 0 {
+			continue
+		}
+		if op.Op == BulkOpCreate {
+			creates = append(creates, i)
+			continue
+		}
+		// the creates listed before this operation go first
+		if err := createBulkPosts(db, ops, creates, results, atomic, batchSize); err != nil {
+			return err
+		}
+		creates = creates[:0]
+		if err := changeBulkPost(db, op, &results[i]); err != nil && atomic {
+			return err
+		}
+	}
+	return createBulkPosts(db, ops, creates, results, atomic, batchSize)
+}
+
+// createBulkPosts inserts the create operations at the given indexes, batchSize at a time. A batch
+// that fails is retried row by row in best-effort mode, to find the offending items.
+func createBulkPosts(db *gorm.DB, ops []BulkPostOperation, creates []int, results []BulkPostResult, atomic bool, batchSize int) error {
+	for start := 0; start < len(creates); start += batchSize {
+		chunk := creates[start:min(start+batchSize, len(creates))]
+		posts := make([]models.Post, 0, len(chunk))
+		for _, i := range chunk {
+			posts = append(posts, models.Post{Title: ops[i].Title, Body: ops[i].Body, UserID: *ops[i].UserID})
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.CreateInBatches(&posts, batchSize).Error; err != nil {
+				return err
+			}
+			for _, post := range posts {
+				if err := recordPostEvent(tx, webhooks.PostCreated, post.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			for j, i := range chunk {
+				setBulkResult(&results[i], http.StatusOK, &posts[j], nil)
+			}
+			continue
+		}
+		if atomic {
+			for _, i := range chunk {
+				setBulkResult(&results[i], http.StatusBadRequest, nil, err)
+			}
+			return err
+		}
+
+		// Retry the failed batch row by row to find the offending items
+		for j, i := range chunk {
+			post := posts[j]
+			post.ID, post.Slug = 0, nil
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&post).Error; err != nil {
+					return err
+				}
+				return recordPostEvent(tx, webhooks.PostCreated, post.ID)
+			})
+			if err != nil {
+				setBulkResult(&results[i], http.StatusBadRequest, nil, err)
+			} else {
+				setBulkResult(&results[i], http.StatusOK, &post, nil)
+			}
+		}
+	}
+	return nil
+}
+
+// changeBulkPost runs one update or delete operation and records its result
+func changeBulkPost(db *gorm.DB, op BulkPostOperation, result *BulkPostResult) error {
+	var post models.Post
+	status := http.StatusOK
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&post, op.ID).Error; err != nil {
+			status = http.StatusNotFound
+			return errors.New("Post not found")
+		}
+		if op.Op == BulkOpDelete {
+			if err := tx.Delete(&post).Error; err != nil {
+				return err
+			}
+			return recordPostEvent(tx, webhooks.PostDeleted, post.ID)
+		}
+		updates := PostUpdates(UpdatePostRequest{Title: op.Title, Body: op.Body, UserID: op.UserID})
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := savePostUpdates(tx, &post, updates, nil); err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil:
+		setBulkResult(result, status, nil, err)
+	case op.Op == BulkOpDelete:
+		setBulkResult(result, http.StatusOK, nil, nil)
+	default:
+		setBulkResult(result, http.StatusOK, &post, nil)
+	}
+	return err
+}
+
+// setBulkResult fills in the outcome of one operation
+func setBulkResult(r *BulkPostResult, status int, post *models.Post, err error) {
+	r.Status = status
+	if post != nil {
+		dto := mapPost(*post)
+		r.Post = &dto
+		r.ID = post.ID
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// markBulkRolledBack flags every operation that did not fail itself as not applied
+func markBulkRolledBack(results []BulkPostResult) {
+	for i := range results {
+		if results[i].Status == 0 || results[i].Status == http.StatusOK {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Post = nil
+			if results[i].Op == BulkOpCreate {
+				results[i].ID = 0
+			}
+			results[i].Error = "Not applied: the bulk request was rolled back"
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collectionFingerprint summarises a table so list responses can be validated without loading rows
+type collectionFingerprint struct {
+	Count      int64
+	MaxUpdated *time.Time
+	// MaxDeleted is the newest soft delete among the rows, which changes the collection without
+	// touching updated_at
+	MaxDeleted *time.Time
+	// MaxChanged is the newest update or soft delete in the whole table. Rows that stop matching
+	// the filters, say by being unpublished or retagged, take their updated_at with them, so only
+	// the whole table shows when a filtered collection last lost a row.
+	MaxChanged *time.Time
+}
+
+// etag builds a weak validator for the collection
+func (f collectionFingerprint) etag(name string) string {
+	var updated, deleted int64
+	if f.MaxUpdated != nil {
+		updated = f.MaxUpdated.UnixNano()
+	}
+	if f.MaxDeleted != nil {
+		deleted = f.MaxDeleted.UnixNano()
+	}
+	return fmt.Sprintf(`W/"%s-%d-%d-%d"`, name, f.Count, updated, deleted)
+}
+
+// lastModified returns when the collection may last have changed: the newest change to any row
+// of the table (zero when it is empty). It is later than needed, never earlier.
+func (f collectionFingerprint) lastModified() time.Time {
+	if f.MaxChanged == nil {
+		return time.Time{}
+	}
+	return *f.MaxChanged
+}
+
+// fingerprintPosts computes count and max(updated_at) over the non-deleted posts matching filters,
+// max(deleted_at) over the deleted ones, so removing a post also changes the fingerprint, and the
+// newest change to any post for Last-Modified
+func fingerprintPosts(filters scope) (collectionFingerprint, error) {
+	var f collectionFingerprint
+	err := config.DB.Unscoped().Model(&models.Post{}).
+		Scopes(filters).
+		Select(`COUNT(*) FILTER (WHERE posts.deleted_at IS NULL) AS count,
+			MAX(posts.updated_at) FILTER (WHERE posts.deleted_at IS NULL) AS max_updated,
+			MAX(posts.deleted_at) AS max_deleted,
+			GREATEST((SELECT MAX(updated_at) FROM posts), (SELECT MAX(deleted_at) FROM posts)) AS max_changed`).
+		Scan(&f).Error
+	return f, err
+}
+
+// entityETag builds a weak validator for a single row
+func entityETag(name string, id uint, updatedAt time.Time) string {
+	return fmt.Sprintf(`W/"%s-%d-%d"`, name, id, updatedAt.UnixNano())
+}
+
+// notModified sets ETag and Last-Modified on the response and reports whether the
+// request's conditional headers match them. When it returns true a 304 has been written.
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 7232, section 6)
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches performs the weak comparison used by If-None-Match
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
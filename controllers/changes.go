@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"rest_api/changes"
+	"rest_api/config"
+	"rest_api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultChangesPollInterval = 5 * time.Second
+	defaultChangesKeepAlive    = 30 * time.Second
+)
+
+// changeBus tells this server about the posts and users changed through any server
+var changeBus = changes.NewBus(pollChanges)
+
+func init() {
+	// changes with a Seq left an event in the outbox, which the relay of whichever server is quickest handles
+	changeBus.Subscribe(func(c changes.Change) {
+		if c.Seq != 0 {
+			notifyOutboxRelay()
+		}
+	})
+}
+
+// notifyPostsUpdated announces, when tx commits, that posts changed in ways that leave no outbox
+// event, such as their comment and reaction counts
+func notifyPostsUpdated(tx *gorm.DB, ids ...uint) error {
+	return notifyUpdated(tx, changes.KindPost, ids)
+}
+
+// notifyUsersUpdated announces, when tx commits, that users changed in ways that leave no outbox
+// event, such as their follow counts
+func notifyUsersUpdated(tx *gorm.DB, ids ...uint) error {
+	return notifyUpdated(tx, changes.KindUser, ids)
+}
+
+func notifyUpdated(tx *gorm.DB, kind string, ids []uint) error {
+	for _, id := range ids {
+		if err := changes.Notify(tx, changes.Change{Kind: kind, ID: id, Op: changes.OpUpdated}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyAllPostsUpdated announces, when tx commits, a change that may touch any post, such as a tag rename
+func notifyAllPostsUpdated(tx *gorm.DB) error {
+	return changes.Notify(tx, changes.Change{Kind: changes.KindAllPosts, Op: changes.OpUpdated})
+}
+
+// pollChanges reads the changes written to the outbox since the given time, for the notifications
+// missed while the bus was disconnected. Changes that leave no outbox event cannot be read back,
+// so it adds that every post and user may have changed.
+func pollChanges(ctx context.Context, since time.Time) ([]changes.Change, error) {
+	var events []models.OutboxEvent
+	err := config.DB.WithContext(ctx).Select("id", "aggregate_id", "type").
+		Where("created_at >= ?", since).Order("id").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	found := make([]changes.Change, 0, len(events)+2)
+	for _, e := range events {
+		found = append(found, changes.FromEventType(e.Type, e.AggregateID, e.ID))
+	}
+	found = append(found,
+		changes.Change{Kind: changes.KindAllPosts, Op: changes.OpUpdated},
+		changes.Change{Kind: changes.KindAllUsers, Op: changes.OpUpdated})
+	return found, nil
+}
+
+// SubscribeChanges calls fn with every post and user change made through any server, until the
+// returned function is called. A change may be seen more than once.
+func SubscribeChanges(fn func(changes.Change)) (unsubscribe func()) {
+	return changeBus.Subscribe(fn)
+}
+
+// RunChangeBus listens for changes made through any server on a connection to dsn until ctx is done
+func RunChangeBus(ctx context.Context, dsn string) {
+	changeBus.PollInterval = config.GetEnvDuration("CHANGES_POLL_INTERVAL", defaultChangesPollInterval)
+	changeBus.KeepAlive = config.GetEnvDuration("CHANGES_KEEPALIVE", defaultChangesKeepAlive)
+	changeBus.Run(ctx, dsn)
+}
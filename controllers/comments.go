@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CommentsFormatTree = "tree"
+	CommentsFormatFlat = "flat"
+)
+
+// CreateCommentRequest represents the request body for commenting on a post or replying to a comment
+type CreateCommentRequest struct {
+	Body     string `json:"body" xml:"body" yaml:"body" binding:"required" example:"Great post!"`
+	UserID   uint   `json:"user_id" xml:"user_id" yaml:"user_id" binding:"required" example:"1"`
+	ParentID *uint  `json:"parent_id" xml:"parent_id" yaml:"parent_id" example:"1"`
+}
+
+// UpdateCommentRequest represents the request body for editing a comment
+type UpdateCommentRequest struct {
+	Body string `json:"body" xml:"body" yaml:"body" binding:"required" example:"Edited comment"`
+}
+
+// CommentNode is a comment with its depth in the thread and, in tree format, its replies.
+// Deleted comments that still have replies are kept with an empty body so the thread stays intact.
+type CommentNode struct {
+	models.JsonComment `yaml:",inline"`
+	Depth              int           `json:"depth" xml:"depth" yaml:"depth" example:"0"`
+	Replies            []CommentNode `json:"replies,omitempty" xml:"replies>comment,omitempty" yaml:"replies,omitempty"`
+}
+
+// CommentsResponse represents the response for listing the comments of a post
+type CommentsResponse struct {
+	Comments []CommentNode `json:"comments" xml:"comments>comment" yaml:"comments"`
+}
+
+// CommentResponse represents the response for a single comment
+type CommentResponse struct {
+	Comment models.JsonComment `json:"comment" xml:"comment" yaml:"comment"`
+}
+
+// DeleteCommentResponse represents the response for deleting a comment
+type DeleteCommentResponse struct {
+	ID string `json:"id has been deleted" xml:"deleted_id" yaml:"id has been deleted" example:"1"`
+}
+
+// mapComment converts DB model to API DTO
+func mapComment(m models.Comment) models.JsonComment {
+	var deletedAt *string
+	if m.DeletedAt.Valid {
+		s := m.DeletedAt.Time.Format(time.RFC3339)
+		deletedAt = &s
+	}
+	return models.JsonComment{
+		ID:        m.ID,
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: m.UpdatedAt.Format(time.RFC3339),
+		DeletedAt: deletedAt,
+		PostID:    m.PostID,
+		UserID:    m.UserID,
+		ParentID:  m.ParentID,
+		Body:      m.Body,
+	}
+}
+
+// commentThread builds the reply tree of a post's comments, oldest first at every level
+func commentThread(comments []models.Comment) []CommentNode {
+	children := map[uint][]models.Comment{}
+	var roots []models.Comment
+	for _, c := range comments {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var build func(level []models.Comment, depth int) []CommentNode
+	build = func(level []models.Comment, depth int) []CommentNode {
+		nodes := make([]CommentNode, 0, len(level))
+		for _, c := range level {
+			node := CommentNode{JsonComment: mapComment(c), Depth: depth, Replies: build(children[c.ID], depth+1)}
+			if c.DeletedAt.Valid {
+				if len(node.Replies) == 0 {
+					continue
+				}
+				node.Body = ""
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(roots, 0)
+}
+
+// flattenThread lists a comment tree in reading order, keeping each comment's depth
+func flattenThread(nodes []CommentNode, flat []CommentNode) []CommentNode {
+	for _, n := range nodes {
+		replies := n.Replies
+		n.Replies = nil
+		flat = append(flat, n)
+		flat = flattenThread(replies, flat)
+	}
+	return flat
+}
+
+// errCommentsLocked is returned by checkCommentsOpen for posts with locked comments
+var errCommentsLocked = errors.New("Comments on this post are locked")
+
+// checkCommentsOpen locks the post with the given strength inside tx and fails with
+// errCommentsLocked if its comments are locked. Holding the row until tx commits means a
+// concurrent lock waits for the comment, instead of the comment slipping in after it.
+func checkCommentsOpen(tx *gorm.DB, postID uint, strength string) error {
+	var post models.Post
+	if err := tx.Clauses(clause.Locking{Strength: strength}).Select("id", "comments_locked").First(&post, postID).Error; err != nil {
+		return err
+	}
+	if post.CommentsLocked {
+		return errCommentsLocked
+	}
+	return nil
+}
+
+// CommentsIndex godoc
+// @Summary List the comments of a post
+// @Description Get a post's comments as a reply tree, or flattened in reading order with each comment's depth
+// @Tags comments
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param format query string false "tree (default) or flat"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Success 200 {object} CommentsResponse "Comments"
+// @Failure 400 {object} map[string]string "Invalid format"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/comments [get]
+func CommentsIndex(c *gin.Context) {
+	format := c.DefaultQuery("format", CommentsFormatTree)
+	if format != CommentsFormatTree && format != CommentsFormatFlat {
+		c.Error(errors.New("Invalid format, expected tree or flat"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var post models.Post
+	result := config.DB.Scopes(VisibleScope(viewerID(c))).First(&post, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	var comments []models.Comment
+	config.DB.Unscoped().Where("post_id = ?", post.ID).Order("created_at, id").Find(&comments)
+
+	thread := commentThread(comments)
+	if format == CommentsFormatFlat {
+		thread = flattenThread(thread, make([]CommentNode, 0, len(comments)))
+	}
+
+	respond(c, 200, CommentsResponse{Comments: thread})
+}
+
+// CommentsCreate godoc
+// @Summary Comment on a post
+// @Description Add a comment to a post, or a reply when parent_id is set. Posts with locked comments reject new comments.
+// @Tags comments
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param comment body CreateCommentRequest true "Comment data"
+// @Param X-User-ID header int false "Viewing user, who can also comment on their own unpublished posts"
+// @Success 200 {object} CommentResponse "Comment created successfully"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 403 {object} map[string]string "Comments are locked"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/comments [post]
+func CommentsCreate(c *gin.Context) {
+	var body CreateCommentRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var post models.Post
+	result := config.DB.Scopes(VisibleScope(viewerID(c))).First(&post, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := config.DB.First(&models.User{}, body.UserID).Error; err != nil {
+		c.Error(errors.New("User not found"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if body.ParentID != nil {
+		if err := config.DB.Where("post_id = ?", post.ID).First(&models.Comment{}, *body.ParentID).Error; err != nil {
+			c.Error(errors.New("parent_id must be a comment on the same post"))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+	}
+
+	comment := models.Comment{PostID: post.ID, UserID: body.UserID, ParentID: body.ParentID, Body: body.Body}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// the comment count is updated below anyway, so lock the post for update straight away
+		if err := checkCommentsOpen(tx, post.ID, "UPDATE"); err != nil {
+			return err
+		}
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Post{}).Where("id = ?", post.ID).Update("comment_count", gorm.Expr("comment_count + 1")).Error; err != nil {
+			return err
+		}
+		return notifyPostsUpdated(tx, post.ID)
+	})
+
+	if errors.Is(err, errCommentsLocked) {
+		c.Error(err)
+		c.Status(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	invalidatePosts(post.ID)
+
+	respond(c, 200, CommentResponse{Comment: mapComment(comment)})
+}
+
+// CommentsUpdate godoc
+// @Summary Edit a comment
+// @Description Replace the body of a comment. Comments on posts with locked comments cannot be edited.
+// @Tags comments
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Comment ID"
+// @Param comment body UpdateCommentRequest true "Updated comment"
+// @Param X-User-ID header int false "Viewing user, who can also edit comments on their own unpublished posts"
+// @Success 200 {object} CommentResponse "Comment updated successfully"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 403 {object} map[string]string "Comments are locked"
+// @Failure 404 {object} map[string]string "Comment not found"
+// @Router /comments/{id} [patch]
+func CommentsUpdate(c *gin.Context) {
+	var body UpdateCommentRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var comment models.Comment
+	result := config.DB.First(&comment, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Comment not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := config.DB.Scopes(VisibleScope(viewerID(c))).First(&models.Post{}, comment.PostID).Error; err != nil {
+		c.Error(errors.New("Comment not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkCommentsOpen(tx, comment.PostID, "SHARE"); err != nil {
+			return err
+		}
+		return tx.Model(&comment).Update("body", body.Body).Error
+	})
+
+	if errors.Is(err, errCommentsLocked) {
+		c.Error(err)
+		c.Status(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	respond(c, 200, CommentResponse{Comment: mapComment(comment)})
+}
+
+// CommentsDelete godoc
+// @Summary Delete a comment
+// @Description Soft-delete a comment. Its replies stay visible under an empty placeholder.
+// @Tags comments
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Comment ID"
+// @Success 200 {object} DeleteCommentResponse "Comment deleted successfully"
+// @Failure 404 {object} map[string]string "Comment not found"
+// @Router /comments/{id} [delete]
+func CommentsDelete(c *gin.Context) {
+	var comment models.Comment
+	result := config.DB.First(&comment, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Comment not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Post{}).Where("id = ?", comment.PostID).Update("comment_count", gorm.Expr("GREATEST(comment_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+		return notifyPostsUpdated(tx, comment.PostID)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	invalidatePosts(comment.PostID)
+
+	respond(c, 200, DeleteCommentResponse{ID: c.Param("id")})
+}
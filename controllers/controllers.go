@@ -2,57 +2,88 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"rest_api/config"
+	errors_middleware "rest_api/middleware"
 	"rest_api/models"
+	"rest_api/webhooks"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
 )
 
 // CreatePostRequest represents the request body for creating a post
 type CreatePostRequest struct {
-	Title  string `json:"title" binding:"required" example:"My First Post"`
-	Body   string `json:"body" binding:"required" example:"This is the content of my first post"`
-	UserID uint   `json:"user_id" binding:"required" example:"1"`
+	Title      string   `json:"title" xml:"title" yaml:"title" binding:"required" example:"My First Post"`
+	Body       string   `json:"body" xml:"body" yaml:"body" binding:"required" example:"This is the content of my first post"`
+	UserID     uint     `json:"user_id" xml:"user_id" yaml:"user_id" binding:"required" example:"1"`
+	Tags       []string `json:"tags" xml:"tags>tag" yaml:"tags" binding:"dive,max=100" example:"go,databases"`
+	Categories []string `json:"categories" xml:"categories>category" yaml:"categories" binding:"dive,max=100" example:"engineering"`
+	// Status defaults to published; scheduled posts also need PublishAt
+	Status    string     `json:"status" xml:"status" yaml:"status" binding:"omitempty,oneof=draft scheduled published" example:"draft"`
+	PublishAt *time.Time `json:"publish_at" xml:"publish_at" yaml:"publish_at" binding:"required_if=Status scheduled" example:"2030-01-01T09:00:00Z"`
 }
 
 // UpdatePostRequest represents the request body for updating a post
 type UpdatePostRequest struct {
-	Title  string `json:"title" example:"Updated Post Title"`
-	Body   string `json:"body" example:"Updated post content"`
-	UserID *uint  `json:"user_id" example:"2"`
+	Title          string `json:"title" xml:"title" yaml:"title" example:"Updated Post Title"`
+	Body           string `json:"body" xml:"body" yaml:"body" example:"Updated post content"`
+	UserID         *uint  `json:"user_id" xml:"user_id" yaml:"user_id" example:"2"`
+	CommentsLocked *bool  `json:"comments_locked" xml:"comments_locked" yaml:"comments_locked" example:"true"`
+	// Tags and Categories replace the current ones when present; an empty list clears them
+	Tags       []string `json:"tags" xml:"tags>tag" yaml:"tags" binding:"omitempty,dive,max=100" example:"go,databases"`
+	Categories []string `json:"categories" xml:"categories>category" yaml:"categories" binding:"omitempty,dive,max=100" example:"engineering"`
+	// EditorID is credited with the revision an edit creates; the handler sets it from X-User-ID
+	EditorID *uint `json:"-" xml:"-" yaml:"-"`
 }
 
 // CreateUserRequest represents the request body for creating a user
 type CreateUserRequest struct {
-	Name  string              `json:"name" binding:"required" example:"John Doe"`
-	Posts []CreatePostRequest `json:"posts" example:"[{\\\"title\\\":\\\"Hello\\\",\\\"body\\\":\\\"World\\\"}]"`
+	Name  string              `json:"name" xml:"name" yaml:"name" binding:"required" example:"John Doe"`
+	Posts []CreatePostRequest `json:"posts" xml:"posts>post" yaml:"posts" example:"[{\\\"title\\\":\\\"Hello\\\",\\\"body\\\":\\\"World\\\"}]"`
 }
 
 // PostsResponse represents the response for posts endpoints
 type PostsResponse struct {
-	Posts []models.JsonPost `json:"posts"`
+	Posts []models.JsonPost `json:"posts" xml:"posts>post" yaml:"posts"`
 }
 
 // PostResponse represents the response for a single post
 type PostResponse struct {
-	Post models.JsonPost `json:"post"`
+	Post models.JsonPost `json:"post" xml:"post" yaml:"post"`
+}
+
+// DeletePostResponse represents the response for deleting a post
+type DeletePostResponse struct {
+	ID string `json:"id has been deleted" xml:"deleted_id" yaml:"id has been deleted" example:"1"`
 }
 
 // UsersResponse represents the response for users endpoints
 type UsersResponse struct {
-	Users []models.JsonUser `json:"users"`
+	Users []models.JsonUser `json:"users" xml:"users>user" yaml:"users"`
 }
 
 // UserResponse represents the response for a single user
 type UserResponse struct {
-	User models.JsonUser `json:"user"`
+	User models.JsonUser `json:"user" xml:"user" yaml:"user"`
 }
 
+// UpdateUserRequest represents the request body for updating a user and their posts
+type UpdateUserRequest struct {
+	Name          string              `json:"name" xml:"name" yaml:"name" example:"Jane Doe"`
+	AddPosts      []CreatePostRequest `json:"add_posts" xml:"add_posts>post" yaml:"add_posts" example:"[{\\\"title\\\":\\\"Hello\\\",\\\"body\\\":\\\"World\\\"}]"`
+	RemovePostIDs []uint              `json:"remove_post_ids" xml:"remove_post_ids>id" yaml:"remove_post_ids" example:"3,4"`
+}
+
+// UserPostsResponse represents the response for a user together with their posts
 type UserPostsResponse struct {
-	User models.JsonUser `json:"user"`
-	Posts []models.JsonPost `json:"posts"`
+	User  models.JsonUser   `json:"user" xml:"user" yaml:"user"`
+	Posts []models.JsonPost `json:"posts" xml:"posts>post" yaml:"posts"`
 }
 
 // mapPost converts DB model to API DTO
@@ -62,15 +93,77 @@ func mapPost(m models.Post) models.JsonPost {
 		s := m.DeletedAt.Time.Format(time.RFC3339)
 		deletedAt = &s
 	}
+	var publishedAt *string
+	if m.PublishedAt != nil {
+		s := m.PublishedAt.Format(time.RFC3339)
+		publishedAt = &s
+	}
+	var slug string
+	if m.Slug != nil {
+		slug = *m.Slug
+	}
 	return models.JsonPost{
-		ID:        m.ID,
-		CreatedAt: m.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: m.UpdatedAt.Format(time.RFC3339),
-		DeletedAt: deletedAt,
-		Title:     m.Title,
-		Body:      m.Body,
-		UserID:    m.UserID,
+		ID:             m.ID,
+		CreatedAt:      m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      m.UpdatedAt.Format(time.RFC3339),
+		DeletedAt:      deletedAt,
+		Title:          m.Title,
+		Slug:           slug,
+		Body:           m.Body,
+		UserID:         m.UserID,
+		Status:         m.Status,
+		PublishedAt:    publishedAt,
+		CommentCount:   m.CommentCount,
+		CommentsLocked: m.CommentsLocked,
+		Tags:           tagNames(m.Tags),
+		Categories:     categoryNames(m.Categories),
+		ReactionCounts: mapReactionCounts(m.ReactionCounts),
+	}
+}
+
+// mapPosts converts a slice of DB models to API DTOs
+func mapPosts(posts []models.Post) []models.JsonPost {
+	dto := make([]models.JsonPost, 0, len(posts))
+	for _, p := range posts {
+		dto = append(dto, mapPost(p))
+	}
+	return dto
+}
+
+// respond renders obj in the format negotiated from the Accept header (JSON by default)
+func respond(c *gin.Context, code int, obj any) {
+	errors_middleware.Render(c, code, obj)
+}
+
+// PostUpdates collects the non-empty fields of an update request as column updates
+func PostUpdates(body UpdatePostRequest) map[string]any {
+	updates := map[string]any{}
+	if body.Title != "" {
+		updates["title"] = body.Title
+	}
+	if body.Body != "" {
+		updates["body"] = body.Body
+	}
+	if body.UserID != nil {
+		updates["user_id"] = *body.UserID
 	}
+	if body.CommentsLocked != nil {
+		updates["comments_locked"] = *body.CommentsLocked
+	}
+	return updates
+}
+
+// errorStatus maps an error from the shared post and user operations to an HTTP status
+func errorStatus(err error) int {
+	var notFound NotFoundError
+	if errors.As(err, &notFound) {
+		return http.StatusNotFound
+	}
+	var transition TransitionError
+	if errors.As(err, &transition) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
 }
 
 // mapUser converts DB model to API DTO
@@ -81,11 +174,13 @@ func mapUser(m models.User) models.JsonUser {
 		deletedAt = &s
 	}
 	return models.JsonUser{
-		ID:        m.ID,
-		CreatedAt: m.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: m.UpdatedAt.Format(time.RFC3339),
-		DeletedAt: deletedAt,
-		Name:      m.Name,
+		ID:             m.ID,
+		CreatedAt:      m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      m.UpdatedAt.Format(time.RFC3339),
+		DeletedAt:      deletedAt,
+		Name:           m.Name,
+		FollowerCount:  m.FollowerCount,
+		FollowingCount: m.FollowingCount,
 	}
 }
 
@@ -93,8 +188,8 @@ func mapUser(m models.User) models.JsonUser {
 // @Summary Create a new post
 // @Description Create a new blog post and associate with a user via user_id
 // @Tags posts
-// @Accept json
-// @Produce json
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param post body CreatePostRequest true "Post data"
 // @Success 200 {object} PostResponse "Post created successfully"
 // @Failure 400 {object} map[string]string "Bad request"
@@ -108,66 +203,128 @@ func PostsCreate(c *gin.Context) {
 		return
 	}
 
-	post := models.Post{Title: body.Title, Body: body.Body, UserID: body.UserID}
-	result := config.DB.Create(&post)
+	post, err := CreatePost(body)
 
-	if result.Error != nil {
-		c.Error(result.Error)
+	if err != nil {
+		c.Error(err)
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	c.JSON(200, PostResponse{Post: mapPost(post)})
+	respond(c, 200, PostResponse{Post: mapPost(post)})
 }
 
 // PostsIndex godoc
 // @Summary Get all posts
 // @Description Get a list of all blog posts (user_id included)
 // @Tags posts
-// @Produce json
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param user_id query int false "Only posts by this user"
+// @Param updated_since query string false "Only posts updated at or after this RFC 3339 time"
+// @Param tag query string false "Only posts with this tag slug"
+// @Param category query string false "Only posts in this category slug"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Param format query string false "markdown (default), or html to add body_html and toc"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Param If-Modified-Since header string false "Last-Modified from a previous response"
 // @Success 200 {object} PostsResponse "List of posts"
+// @Success 304 "Not modified"
+// @Failure 400 {object} map[string]string "Invalid filter"
 // @Router /posts [get]
 func PostsIndex(c *gin.Context) {
+	filters, err := postFilters(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	format, err := bodyFormat(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	fingerprint, err := fingerprintPosts(filters)
+	if err == nil && notModified(c, fingerprint.etag(formatETagName("posts", format)), fingerprint.lastModified()) {
+		return
+	}
+
 	var posts []models.Post
-	config.DB.Find(&posts)
+	config.DB.Scopes(filters, preloadPostRelations).Find(&posts)
 
-	dto := make([]models.JsonPost, 0, len(posts))
-	for _, p := range posts {
-		dto = append(dto, mapPost(p))
+	dto := mapPosts(posts)
+	if err := renderBodies(format, dto); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
 	}
-	c.JSON(200, PostsResponse{Posts: dto})
+
+	respond(c, 200, PostsResponse{Posts: dto})
 }
 
 // PostsShow godoc
 // @Summary Get a post by ID
-// @Description Get a specific blog post by its ID (user_id included)
+// @Description Get a specific blog post by its ID (user_id included). Unpublished posts are only found by their author.
 // @Tags posts
-// @Produce json
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param id path int true "Post ID"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Param format query string false "markdown (default), or html to add body_html and toc"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Param If-Modified-Since header string false "Last-Modified from a previous response"
 // @Success 200 {object} PostResponse "Post found"
+// @Success 304 "Not modified"
 // @Failure 404 {object} map[string]string "Post not found"
 // @Router /posts/{id} [get]
 func PostsShow(c *gin.Context) {
+	format, err := bodyFormat(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	viewer := viewerID(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	var post models.Post
-	id := c.Param("id")
-	result := config.DB.First(&post, id)
+	if err == nil {
+		post, err = findPost(c.Request.Context(), uint(id))
+	}
 
-	if result.Error != nil {
+	if err != nil || !visibleTo(post, viewer) {
 		c.Error(errors.New("Unable to find a post"))
 		c.Status(http.StatusNotFound)
 		return
 	}
 
-	c.JSON(200, PostResponse{Post: mapPost(post)})
+	respondPost(c, post, format)
+}
+
+// respondPost writes post, or 304 when the client's copy is current
+func respondPost(c *gin.Context, post models.Post, format string) {
+	if notModified(c, entityETag(formatETagName("post", format), post.ID, post.UpdatedAt), post.UpdatedAt) {
+		return
+	}
+
+	dto := []models.JsonPost{mapPost(post)}
+	if err := renderBodies(format, dto); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, 200, PostResponse{Post: dto[0]})
 }
 
 // PostsUpdate godoc
 // @Summary Update a post
-// @Description Update an existing blog post (title, body, and optionally user_id)
+// @Description Update an existing blog post (title, body, and optionally user_id). Title and body changes are kept as a new revision.
 // @Tags posts
-// @Accept json
-// @Produce json
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param id path int true "Post ID"
+// @Param X-User-ID header int false "Editing user, credited with the revision"
 // @Param post body UpdatePostRequest true "Updated post data"
 // @Success 200 {object} PostResponse "Post updated successfully"
 // @Failure 400 {object} map[string]string "Bad request"
@@ -181,67 +338,50 @@ func PostsUpdate(c *gin.Context) {
 		return
 	}
 
-	var post models.Post
-	result := config.DB.First(&post, c.Param("id"))
-
-	if result.Error != nil {
-		c.Error(errors.New("Unable to update a post"))
-		c.Status(http.StatusNotFound)
-		return
+	if editor := viewerID(c); editor != 0 {
+		body.EditorID = &editor
 	}
+	post, err := UpdatePost(c.Param("id"), body)
 
-	updates := map[string]any{}
-	if body.Title != "" {
-		updates["title"] = body.Title
-	}
-	if body.Body != "" {
-		updates["body"] = body.Body
-	}
-	if body.UserID != nil {
-		updates["user_id"] = *body.UserID
-	}
-	if len(updates) > 0 {
-		config.DB.Model(&post).Updates(updates)
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
 	}
 
-	c.JSON(200, PostResponse{Post: mapPost(post)})
+	respond(c, 200, PostResponse{Post: mapPost(post)})
 }
 
 // PostsDelete godoc
 // @Summary Delete a post
 // @Description Delete a blog post by ID
 // @Tags posts
-// @Produce json
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param id path int true "Post ID"
-// @Success 200 {object} map[string]string "Post deleted successfully"
+// @Success 200 {object} DeletePostResponse "Post deleted successfully"
 // @Failure 404 {object} map[string]string "Post not found"
 // @Router /posts/{id} [delete]
 func PostsDelete(c *gin.Context) {
-	var post models.Post
-	result := config.DB.First(&post, c.Param("id"))
+	err := DeletePost(c.Param("id"))
 
-	if result.Error != nil {
-		c.Error(errors.New("Unable to delete a post"))
-		c.Status(http.StatusNotFound)
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
 		return
 	}
 
-	config.DB.Model(&post).Delete(&post)
-
-	c.JSON(
-		200, gin.H{
-			"id has been deleted": c.Param("id"),
-		})
+	respond(c, 200, DeletePostResponse{ID: c.Param("id")})
 }
 
 // UsersCreate godoc
 // @Summary Create a new user
-// @Description Create a new user
+// @Description Create a new user, optionally with posts. The user and its posts are created in one transaction.
+// @Description Nested posts belong to the new user, so their user_id must be omitted.
 // @Tags users
-// @Accept json
-// @Produce json
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param user body CreateUserRequest true "User data"
-// @Success 200 {object} UserResponse "User created successfully"
+// @Success 200 {object} UserPostsResponse "User created successfully"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Router /users [post]
 func UsersCreate(c *gin.Context) {
@@ -253,65 +393,153 @@ func UsersCreate(c *gin.Context) {
 		return
 	}
 
-	user := models.User{Name: body.Name}
-	result := config.DB.Create(&user)
+	user, posts, err := CreateUser(body)
 
-	if result.Error != nil {
+	if err != nil {
+		c.Error(err)
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	// Optionally create associated posts
-	if len(body.Posts) > 0 {
-		posts := make([]models.Post, 0, len(body.Posts))
-		for _, p := range body.Posts {
-			posts = append(posts, models.Post{Title: p.Title, Body: p.Body, UserID: user.ID})
+	respond(c, 200, UserPostsResponse{User: mapUser(user), Posts: mapPosts(posts)})
+}
+
+// validateNestedPosts checks posts submitted inside a user request against the same rules as
+// POST /posts, except for user_id: nested posts always belong to that user, so it must be left out
+func validateNestedPosts(posts []CreatePostRequest) error {
+	v := binding.Validator.Engine().(*validator.Validate)
+	for i, p := range posts {
+		if p.UserID != 0 {
+			return fmt.Errorf("posts[%d]: user_id must not be set on nested posts", i)
 		}
-		if err := config.DB.Create(&posts).Error; err != nil {
-			c.Error(err)
-			c.Status(http.StatusBadRequest)
-			return
+		if err := v.StructExcept(p, "UserID"); err != nil {
+			return fmt.Errorf("posts[%d]: %w", i, err)
 		}
 	}
+	return nil
+}
 
-	c.JSON(200, UserResponse{User: mapUser(user)})
+// createUserPosts inserts nested posts for a user inside tx
+func createUserPosts(tx *gorm.DB, userID uint, requests []CreatePostRequest) ([]models.Post, error) {
+	posts := make([]models.Post, 0, len(requests))
+	for _, p := range requests {
+		post, err := newPost(tx, p)
+		if err != nil {
+			return nil, err
+		}
+		post.UserID = userID
+		posts = append(posts, post)
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+	if err := tx.Create(&posts).Error; err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		if err := recordPostEvent(tx, webhooks.PostCreated, post.ID); err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
 }
 
 // UsersShow godoc
 // @Summary Get a user by ID
 // @Description Get a specific user by their ID
 // @Tags users
-// @Produce json
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Param If-Modified-Since header string false "Last-Modified from a previous response"
 // @Success 200 {object} UserResponse "User found"
+// @Success 304 "Not modified"
 // @Failure 404 {object} map[string]string "User not found"
 // @Router /users/{id} [get]
 func UsersShow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	var user models.User
-	id := c.Param("id")
-	result := config.DB.First(&user, id)
+	if err == nil {
+		user, err = findUser(c.Request.Context(), uint(id))
+	}
 
-	if result.Error != nil {
+	if err != nil {
 		c.Error(errors.New("User not found"))
 		c.Status(http.StatusNotFound)
 		return
 	}
 
-	c.JSON(200, UserResponse{User: mapUser(user)})
+	if notModified(c, entityETag("user", user.ID, user.UpdatedAt), user.UpdatedAt) {
+		return
+	}
+
+	respond(c, 200, UserResponse{User: mapUser(user)})
 }
 
+// UsersUpdate godoc
+// @Summary Update a user
+// @Description Rename a user and add or remove their posts in one transaction
+// @Tags users
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "User ID"
+// @Param user body UpdateUserRequest true "Updated user data"
+// @Success 200 {object} UserPostsResponse "User updated successfully"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /users/{id} [patch]
+func UsersUpdate(c *gin.Context) {
+	var body UpdateUserRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
 
+	user, posts, err := UpdateUser(c.Param("id"), body)
+
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
+	}
+
+	respond(c, 200, UserPostsResponse{User: mapUser(user), Posts: mapPosts(posts)})
+}
+
+// uniqueIDs drops duplicate IDs so they can be compared against affected row counts
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
 
 // UserPostsShow godoc
 // @Summary Get a user by ID
-// @Description Get a specific user posts by user ID
+// @Description Get a specific user posts by user ID. Users see their own drafts when they send X-User-ID.
 // @Tags users
-// @Produce json
+// @Produce json,xml,application/x-yaml,application/x-msgpack
 // @Param id path int true "User ID"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Param format query string false "markdown (default), or html to add body_html and toc"
 // @Success 200 {object} UserPostsResponse "User posts found"
 // @Failure 404 {object} map[string]string "User or user posts not found"
 // @Router /users/{id}/posts [get]
 func UserPostsShow(c *gin.Context) {
+	format, err := bodyFormat(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
 	var user models.User
 	id := c.Param("id")
 	result := config.DB.First(&user, id)
@@ -323,12 +551,14 @@ func UserPostsShow(c *gin.Context) {
 	}
 
 	var posts []models.Post
-	config.DB.Find(&posts, "user_id = ?", id)
+	config.DB.Scopes(preloadPostRelations, VisibleScope(viewerID(c))).Find(&posts, "user_id = ?", id)
 
-	userPosts := make([]models.JsonPost, 0, len(posts))
-	for _, p := range posts {
-		userPosts = append(userPosts, mapPost(p))
+	dto := mapPosts(posts)
+	if err := renderBodies(format, dto); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
 	}
 
-	c.JSON(200, UserPostsResponse{User: mapUser(user), Posts: userPosts})
-}
\ No newline at end of file
+	respond(c, 200, UserPostsResponse{User: mapUser(user), Posts: dto})
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MIMENDJSON = "application/x-ndjson"
+	MIMECSV    = "text/csv"
+
+	ExportCountTrailer    = "X-Export-Count"
+	ExportChecksumTrailer = "X-Export-Sha256"
+
+	// exportFlushEvery controls how many rows are buffered before flushing to the client
+	exportFlushEvery = 500
+)
+
+var (
+	postCSVHeader = []string{"id", "created_at", "updated_at", "title", "body", "user_id"}
+	userCSVHeader = []string{"id", "created_at", "updated_at", "name"}
+)
+
+// exportWriter encodes rows as NDJSON or CSV straight to the response, optionally gzipped,
+// and keeps a row count and a SHA-256 of the uncompressed output for the trailers
+type exportWriter struct {
+	c     *gin.Context
+	out   io.Writer
+	gz    *gzip.Writer
+	csv   *csv.Writer
+	sum   hash.Hash
+	count int
+}
+
+// newExportWriter writes the response headers and, for CSV, the header row
+func newExportWriter(c *gin.Context, format, name string, csvHeader []string) *exportWriter {
+	e := &exportWriter{c: c, sum: sha256.New()}
+
+	ext := "ndjson"
+	if format == MIMECSV {
+		ext = "csv"
+	}
+	c.Header("Content-Type", format+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+name+"."+ext+`"`)
+	c.Header("Trailer", ExportCountTrailer+", "+ExportChecksumTrailer)
+	c.Header("Vary", "Accept, Accept-Encoding")
+
+	var dst io.Writer = c.Writer
+	if acceptsGzip(c) {
+		c.Header("Content-Encoding", "gzip")
+		e.gz = gzip.NewWriter(c.Writer)
+		dst = e.gz
+	}
+	c.Status(http.StatusOK)
+	e.out = io.MultiWriter(dst, e.sum)
+
+	if format == MIMECSV {
+		e.csv = csv.NewWriter(e.out)
+		e.csv.Write(csvHeader)
+	}
+	return e
+}
+
+// write encodes one row; dto is used for NDJSON and fields for CSV
+func (e *exportWriter) write(dto any, fields []string) error {
+	var err error
+	if e.csv != nil {
+		err = e.csv.Write(fields)
+	} else {
+		err = json.NewEncoder(e.out).Encode(dto)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%exportFlushEvery == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+// flush pushes buffered rows through the compressor and to the client
+func (e *exportWriter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	if e.gz != nil {
+		e.gz.Flush()
+	}
+	e.c.Writer.Flush()
+}
+
+// close finishes the body. The count and checksum trailers are only set when the export
+// completed, so a client missing them knows the stream was cut short.
+func (e *exportWriter) close(err error) {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	if e.gz != nil {
+		e.gz.Close()
+	}
+	if err != nil {
+		return
+	}
+	e.c.Writer.Header().Set(ExportCountTrailer, strconv.Itoa(e.count))
+	e.c.Writer.Header().Set(ExportChecksumTrailer, hex.EncodeToString(e.sum.Sum(nil)))
+}
+
+// exportFormat negotiates NDJSON or CSV from the Accept header, writing 406 when neither is acceptable
+func exportFormat(c *gin.Context) (string, bool) {
+	format := c.NegotiateFormat(MIMENDJSON, MIMECSV)
+	if format == "" {
+		c.Error(errors.New("Not acceptable, supported formats: " + MIMENDJSON + ", " + MIMECSV))
+		c.Status(http.StatusNotAcceptable)
+		return "", false
+	}
+	return format, true
+}
+
+// acceptsGzip reports whether the client allows a gzip-encoded response
+func acceptsGzip(c *gin.Context) bool {
+	for _, enc := range strings.Split(c.GetHeader("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(enc, ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// ExportPosts godoc
+// @Summary Export posts
+// @Description Stream all posts as NDJSON or CSV, chosen by the Accept header. Rows are read through a DB cursor.
+// @Description The X-Export-Count and X-Export-Sha256 trailers carry the row count and a checksum of the uncompressed body.
+// @Tags export
+// @Produce application/x-ndjson,text/csv
+// @Param user_id query int false "Only posts by this user"
+// @Param updated_since query string false "Only posts updated at or after this RFC 3339 time"
+// @Success 200 {string} string "Posts, one per line"
+// @Failure 400 {object} map[string]string "Invalid filter"
+// @Failure 406 {object} map[string]string "Unsupported Accept header"
+// @Router /export/posts [get]
+func ExportPosts(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	filters, err := postFilters(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	rows, err := config.DB.Model(&models.Post{}).Scopes(filters).Order("id").Rows()
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w := newExportWriter(c, format, "posts", postCSVHeader)
+	for rows.Next() {
+		var post models.Post
+		if err = config.DB.ScanRows(rows, &post); err != nil {
+			break
+		}
+		dto := mapPost(post)
+		if err = w.write(dto, []string{
+			strconv.FormatUint(uint64(dto.ID), 10), dto.CreatedAt, dto.UpdatedAt,
+			dto.Title, dto.Body, strconv.FormatUint(uint64(dto.UserID), 10),
+		}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	w.close(err)
+}
+
+// ExportUsers godoc
+// @Summary Export users
+// @Description Stream all users as NDJSON or CSV, chosen by the Accept header. Rows are read through a DB cursor.
+// @Description The X-Export-Count and X-Export-Sha256 trailers carry the row count and a checksum of the uncompressed body.
+// @Tags export
+// @Produce application/x-ndjson,text/csv
+// @Param updated_since query string false "Only users updated at or after this RFC 3339 time"
+// @Success 200 {string} string "Users, one per line"
+// @Failure 400 {object} map[string]string "Invalid filter"
+// @Failure 406 {object} map[string]string "Unsupported Accept header"
+// @Router /export/users [get]
+func ExportUsers(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	filters, err := userFilters(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	rows, err := config.DB.Model(&models.User{}).Scopes(filters).Order("id").Rows()
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w := newExportWriter(c, format, "users", userCSVHeader)
+	for rows.Next() {
+		var user models.User
+		if err = config.DB.ScanRows(rows, &user); err != nil {
+			break
+		}
+		dto := mapUser(user)
+		if err = w.write(dto, []string{
+			strconv.FormatUint(uint64(dto.ID), 10), dto.CreatedAt, dto.UpdatedAt, dto.Name,
+		}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	w.close(err)
+}
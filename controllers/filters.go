@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scope narrows a query; filters parsed from the query string are applied with db.Scopes
+type scope = func(*gorm.DB) *gorm.DB
+
+// postFilters parses the optional user_id, updated_since, tag and category list filters and keeps
+// only the posts the viewer may see
+func postFilters(c *gin.Context) (scope, error) {
+	var userID uint64
+	if v := c.Query("user_id"); v != "" {
+		var err error
+		userID, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid user_id %q", v)
+		}
+	}
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		return nil, err
+	}
+
+	postsScope, taxonomyScope := PostsScope(userID, since), TaxonomyScope(c.Query("tag"), c.Query("category"))
+	visibleScope := VisibleScope(viewerID(c))
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(postsScope, taxonomyScope, visibleScope)
+	}, nil
+}
+
+// PostsScope filters posts by author and by last update; zero values leave a filter out
+func PostsScope(userID uint64, since time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userID != 0 {
+			db = db.Where("user_id = ?", userID)
+		}
+		if !since.IsZero() {
+			db = db.Where("updated_at >= ?", since)
+		}
+		return db
+	}
+}
+
+// userFilters parses the optional updated_since list filter
+func userFilters(c *gin.Context) (scope, error) {
+	since, err := parseUpdatedSince(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if !since.IsZero() {
+			db = db.Where("updated_at >= ?", since)
+		}
+		return db
+	}, nil
+}
+
+// parseUpdatedSince reads the updated_since query parameter as an RFC 3339 timestamp
+func parseUpdatedSince(c *gin.Context) (time.Time, error) {
+	return ParseUpdatedSince(c.Query("updated_since"))
+}
+
+// ParseUpdatedSince parses an updated_since filter value; an empty value means no filter
+func ParseUpdatedSince(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	since, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid updated_since %q, expected RFC 3339", v)
+	}
+	return since, nil
+}
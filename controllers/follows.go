@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FollowResponse represents both sides of a follow after it was added or removed
+type FollowResponse struct {
+	Follower models.JsonUser `json:"follower" xml:"follower" yaml:"follower"`
+	Followee models.JsonUser `json:"followee" xml:"followee" yaml:"followee"`
+}
+
+// FollowsResponse represents a page of followers or followed users
+type FollowsResponse struct {
+	Users      []models.JsonUser `json:"users" xml:"users>user" yaml:"users"`
+	NextCursor string            `json:"next_cursor,omitempty" xml:"next_cursor,omitempty" yaml:"next_cursor,omitempty" example:"MTcwMDAwMDAwMDAwMDAwMDAwMDoxMg"`
+}
+
+// FeedResponse represents a page of a user's home feed
+type FeedResponse struct {
+	Posts      []models.JsonPost `json:"posts" xml:"posts>post" yaml:"posts"`
+	NextCursor string            `json:"next_cursor,omitempty" xml:"next_cursor,omitempty" yaml:"next_cursor,omitempty" example:"MTcwMDAwMDAwMDAwMDAwMDAwMDoxMg"`
+}
+
+// followPair loads the follower from :id and the followee from :followee_id, writing the error response on failure
+func followPair(c *gin.Context) (models.User, models.User, bool) {
+	var follower, followee models.User
+	if config.DB.First(&follower, c.Param("id")).Error != nil || config.DB.First(&followee, c.Param("followee_id")).Error != nil {
+		c.Error(errors.New("User not found"))
+		c.Status(http.StatusNotFound)
+		return models.User{}, models.User{}, false
+	}
+	if follower.ID == followee.ID {
+		c.Error(errors.New("Users cannot follow themselves"))
+		c.Status(http.StatusBadRequest)
+		return models.User{}, models.User{}, false
+	}
+	return follower, followee, true
+}
+
+// adjustFollowCounts moves the follower's following_count and the followee's follower_count by delta.
+// The two rows are always updated in ID order, so users following each other at the same time
+// cannot deadlock.
+func adjustFollowCounts(tx *gorm.DB, followerID, followeeID uint, delta int) error {
+	updates := []struct {
+		id     uint
+		column string
+	}{{followerID, "following_count"}, {followeeID, "follower_count"}}
+	if followeeID < followerID {
+		updates[0], updates[1] = updates[1], updates[0]
+	}
+	for _, u := range updates {
+		err := tx.Model(&models.User{}).Where("id = ?", u.id).
+			Update(u.column, gorm.Expr("GREATEST("+u.column+" + ?, 0)", delta)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondFollow reloads both users so the response carries their new counts
+func respondFollow(c *gin.Context, follower, followee models.User) {
+	invalidateUsers(follower.ID, followee.ID)
+	config.DB.First(&follower, follower.ID)
+	config.DB.First(&followee, followee.ID)
+	respond(c, 200, FollowResponse{Follower: mapUser(follower), Followee: mapUser(followee)})
+}
+
+// FollowsPut godoc
+// @Summary Follow a user
+// @Description Make the user follow another user. Following someone already followed changes nothing.
+// @Tags follows
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Follower user ID"
+// @Param followee_id path int true "ID of the user to follow"
+// @Success 200 {object} FollowResponse "Both users with their counts"
+// @Failure 400 {object} map[string]string "Self-follow"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /users/{id}/following/{followee_id} [put]
+func FollowsPut(c *gin.Context) {
+	follower, followee, ok := followPair(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		added := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Follow{FollowerID: follower.ID, FolloweeID: followee.ID})
+		if added.Error != nil || added.RowsAffected == 0 {
+			return added.Error
+		}
+		if err := adjustFollowCounts(tx, follower.ID, followee.ID, 1); err != nil {
+			return err
+		}
+		return notifyUsersUpdated(tx, follower.ID, followee.ID)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respondFollow(c, follower, followee)
+}
+
+// FollowsDelete godoc
+// @Summary Unfollow a user
+// @Description Stop following a user. Unfollowing someone not followed changes nothing.
+// @Tags follows
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Follower user ID"
+// @Param followee_id path int true "ID of the user to unfollow"
+// @Success 200 {object} FollowResponse "Both users with their counts"
+// @Failure 400 {object} map[string]string "Self-follow"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /users/{id}/following/{followee_id} [delete]
+func FollowsDelete(c *gin.Context) {
+	follower, followee, ok := followPair(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		removed := tx.Where("follower_id = ? AND followee_id = ?", follower.ID, followee.ID).Delete(&models.Follow{})
+		if removed.Error != nil || removed.RowsAffected == 0 {
+			return removed.Error
+		}
+		if err := adjustFollowCounts(tx, follower.ID, followee.ID, -1); err != nil {
+			return err
+		}
+		return notifyUsersUpdated(tx, follower.ID, followee.ID)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respondFollow(c, follower, followee)
+}
+
+// listFollows pages through the users on one side of a user's follows, most recent follow first.
+// userColumn is the column matching the user in the path and otherColumn the one to list.
+func listFollows(c *gin.Context, userColumn, otherColumn string) {
+	limit, cursor, err := pageParams(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	result := config.DB.First(&user, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("User not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	var follows []models.Follow
+	config.DB.Where(userColumn+" = ?", user.ID).
+		Scopes(keysetPage("created_at", otherColumn, limit, cursor)).
+		Find(&follows)
+
+	resp := FollowsResponse{Users: make([]models.JsonUser, 0, len(follows))}
+	if len(follows) > limit {
+		follows = follows[:limit]
+		last := follows[limit-1]
+		resp.NextCursor = pageCursor{At: last.CreatedAt, ID: followOther(last, otherColumn)}.String()
+	}
+
+	ids := make([]uint, 0, len(follows))
+	for _, f := range follows {
+		ids = append(ids, followOther(f, otherColumn))
+	}
+	var users []models.User
+	config.DB.Find(&users, "id IN ?", ids)
+	byID := make(map[uint]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	for _, id := range ids {
+		if u, ok := byID[id]; ok {
+			resp.Users = append(resp.Users, mapUser(u))
+		}
+	}
+
+	respond(c, 200, resp)
+}
+
+func followOther(f models.Follow, otherColumn string) uint {
+	if otherColumn == "follower_id" {
+		return f.FollowerID
+	}
+	return f.FolloweeID
+}
+
+// FollowersIndex godoc
+// @Summary List a user's followers
+// @Description Get the users following a user, most recent first, with cursor pagination
+// @Tags follows
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "User ID"
+// @Param limit query int false "Page size, 1 to 100 (default 20)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} FollowsResponse "Followers"
+// @Failure 400 {object} map[string]string "Invalid limit or cursor"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /users/{id}/followers [get]
+func FollowersIndex(c *gin.Context) {
+	listFollows(c, "followee_id", "follower_id")
+}
+
+// FollowingIndex godoc
+// @Summary List the users a user follows
+// @Description Get the users a user follows, most recent first, with cursor pagination
+// @Tags follows
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "User ID"
+// @Param limit query int false "Page size, 1 to 100 (default 20)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} FollowsResponse "Followed users"
+// @Failure 400 {object} map[string]string "Invalid limit or cursor"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /users/{id}/following [get]
+func FollowingIndex(c *gin.Context) {
+	listFollows(c, "follower_id", "followee_id")
+}
+
+// FeedShow godoc
+// @Summary Get a user's home feed
+// @Description Get the posts of everyone the user follows, newest first, with cursor pagination
+// @Tags follows
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "User ID"
+// @Param limit query int false "Page size, 1 to 100 (default 20)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param format query string false "markdown (default), or html to add body_html and toc"
+// @Success 200 {object} FeedResponse "Feed page"
+// @Failure 400 {object} map[string]string "Invalid limit or cursor"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /users/{id}/feed [get]
+func FeedShow(c *gin.Context) {
+	limit, cursor, err := pageParams(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	format, err := bodyFormat(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	result := config.DB.First(&user, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("User not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	// Fan-out on read: for every followed user, read at most one page of their newest live posts
+	// from idx_posts_user_created, then merge those candidates into the page. The cost grows with
+	// the number of follows and the page size, not with how many posts the followed users wrote.
+	before, args := "", []any{}
+	if cursor != nil {
+		before, args = "AND (posts.created_at, posts.id) < (?, ?)", []any{cursor.At, cursor.ID}
+	}
+	args = append(args, limit+1, user.ID, limit+1)
+	var ids []uint
+	err = config.DB.Raw(`SELECT p.id FROM follows f CROSS JOIN LATERAL (
+			SELECT posts.id, posts.created_at FROM posts
+			WHERE posts.user_id = f.followee_id AND posts.deleted_at IS NULL AND posts.status = 'published' `+before+`
+			ORDER BY posts.created_at DESC, posts.id DESC LIMIT ?
+		) p
+		WHERE f.follower_id = ?
+		ORDER BY p.created_at DESC, p.id DESC LIMIT ?`, args...).Scan(&ids).Error
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	posts := []models.Post{}
+	if len(ids) > 0 {
+		config.DB.Scopes(preloadPostRelations).Order("created_at DESC, id DESC").Find(&posts, ids)
+	}
+
+	resp := FeedResponse{}
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		resp.NextCursor = pageCursor{At: last.CreatedAt, ID: last.ID}.String()
+	}
+	resp.Posts = mapPosts(posts)
+	if err := renderBodies(format, resp.Posts); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, 200, resp)
+}
@@ -0,0 +1,526 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/webhooks"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+const (
+	ImportKindUsers = "users"
+	ImportKindPosts = "posts"
+
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	ImportModeAtomic  = "atomic"
+	ImportModeChunked = "chunked"
+
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+
+	defaultImportChunkSize = 500
+)
+
+// errImportRollback aborts an import transaction without reporting an error to the caller
+var errImportRollback = errors.New("import rolled back")
+
+// ImportOptions controls a bulk import run
+type ImportOptions struct {
+	Kind      string // users or posts
+	Format    string // csv or ndjson
+	Mode      string // atomic (one transaction) or chunked (one transaction per chunk, resumable)
+	ChunkSize int    // rows per transaction in chunked mode
+	DryRun    bool   // validate and insert inside a transaction that is always rolled back
+	ResumeJob uint   // continue a chunked job that stopped part way
+}
+
+// ImportJobResponse represents the response for import endpoints
+type ImportJobResponse struct {
+	Job models.JsonImportJob `json:"job" xml:"job" yaml:"job"`
+}
+
+// ImportFormatFromName guesses the import format from a file name or content type
+func ImportFormatFromName(name string) string {
+	switch {
+	case strings.Contains(name, "csv"):
+		return ImportFormatCSV
+	case strings.Contains(name, "ndjson"), strings.Contains(name, "jsonl"), filepath.Ext(name) == ".json":
+		return ImportFormatNDJSON
+	}
+	return ""
+}
+
+// mapImportJob converts DB model to API DTO
+func mapImportJob(m models.ImportJob) models.JsonImportJob {
+	return models.JsonImportJob{
+		ID:            m.ID,
+		CreatedAt:     m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     m.UpdatedAt.Format(time.RFC3339),
+		Kind:          m.Kind,
+		Format:        m.Format,
+		Mode:          m.Mode,
+		DryRun:        m.DryRun,
+		Status:        m.Status,
+		ProcessedRows: m.ProcessedRows,
+		ImportedRows:  m.ImportedRows,
+		FailedRows:    m.FailedRows,
+	}
+}
+
+// RunImport imports users or posts from r, recording progress and per-row errors on an ImportJob.
+// Rows are validated with the same rules as CreateUserRequest and CreatePostRequest. Posts name
+// their author either by user_id or by the author_key given to a user in an earlier users import.
+//
+// In atomic mode (and for dry runs) all rows run in one transaction, which is rolled back if any
+// row fails. In chunked mode every ChunkSize rows are committed together with the job's progress,
+// failed rows are skipped, and a stopped job can be resumed with ResumeJob and the same input.
+// The returned error is only set when the input or options are unusable, not for failed rows.
+func RunImport(opts ImportOptions, r io.Reader) (models.ImportJob, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportModeAtomic
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = config.GetEnvInt("IMPORT_CHUNK_SIZE", defaultImportChunkSize)
+	}
+	if opts.Kind != ImportKindUsers && opts.Kind != ImportKindPosts {
+		return models.ImportJob{}, fmt.Errorf("Invalid kind %q, expected users or posts", opts.Kind)
+	}
+	if opts.Mode != ImportModeAtomic && opts.Mode != ImportModeChunked {
+		return models.ImportJob{}, fmt.Errorf("Invalid mode %q, expected atomic or chunked", opts.Mode)
+	}
+
+	next, err := newImportRowReader(opts.Format, r)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+
+	job, err := startImportJob(opts)
+	if err != nil {
+		return job, err
+	}
+
+	imp := newRowImporter(opts.Kind, next, job)
+	if opts.Mode == ImportModeAtomic || opts.DryRun {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := imp.run(tx, 0); err != nil {
+				return err
+			}
+			if opts.DryRun || imp.failed > 0 {
+				return errImportRollback
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errImportRollback) {
+			imp.recordError(imp.row, nil, err)
+		}
+
+		job.ProcessedRows = imp.row
+		job.ImportedRows = imp.imported
+		job.FailedRows = imp.failed
+		job.Errors = imp.errors.String()
+		job.Status = ImportStatusCompleted
+		if !opts.DryRun && imp.failed > 0 || err != nil && !errors.Is(err, errImportRollback) {
+			job.Status = ImportStatusFailed
+			job.ImportedRows = 0
+		}
+	} else {
+		for !imp.eof && err == nil {
+			err = config.DB.Transaction(func(tx *gorm.DB) error {
+				if err := imp.run(tx, opts.ChunkSize); err != nil {
+					return err
+				}
+				return tx.Model(&models.ImportJob{}).Where("id = ?", job.ID).Updates(imp.progress()).Error
+			})
+		}
+
+		if err != nil {
+			// The failed chunk was rolled back together with its progress, so reload what was
+			// committed; resuming the job continues from there.
+			config.DB.First(&job, job.ID)
+			job.Errors += importErrorLine(imp.row, nil, err)
+			job.Status = ImportStatusFailed
+		} else {
+			job.ProcessedRows = imp.row
+			job.ImportedRows = imp.imported
+			job.FailedRows = imp.failed
+			job.Errors = imp.errors.String()
+			job.Status = ImportStatusCompleted
+		}
+	}
+
+	config.DB.Model(&job).Select("processed_rows", "imported_rows", "failed_rows", "status", "errors").Updates(&job)
+	return job, nil
+}
+
+// startImportJob creates a new job, or loads the chunked job being resumed
+func startImportJob(opts ImportOptions) (models.ImportJob, error) {
+	var job models.ImportJob
+	if opts.ResumeJob == 0 {
+		job = models.ImportJob{Kind: opts.Kind, Format: opts.Format, Mode: opts.Mode, DryRun: opts.DryRun, Status: ImportStatusRunning}
+		return job, config.DB.Create(&job).Error
+	}
+
+	if err := config.DB.First(&job, opts.ResumeJob).Error; err != nil {
+		return job, fmt.Errorf("Import job %d not found", opts.ResumeJob)
+	}
+	if job.Kind != opts.Kind || job.Mode != ImportModeChunked || job.DryRun || opts.DryRun {
+		return job, fmt.Errorf("Import job %d cannot be resumed as a %s %s import", job.ID, opts.Mode, opts.Kind)
+	}
+	if job.Status == ImportStatusCompleted {
+		return job, fmt.Errorf("Import job %d is already completed", job.ID)
+	}
+	job.Status = ImportStatusRunning
+	return job, config.DB.Model(&job).Update("status", job.Status).Error
+}
+
+// importRowFunc returns the next row keyed by column name, or io.EOF
+type importRowFunc func() (map[string]string, error)
+
+// newImportRowReader reads CSV with a header row, or NDJSON objects
+func newImportRowReader(format string, r io.Reader) (importRowFunc, error) {
+	switch format {
+	case ImportFormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CSV header: %w", err)
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		}
+		return func() (map[string]string, error) {
+			record, err := reader.Read()
+			if err != nil {
+				return nil, err
+			}
+			fields := make(map[string]string, len(header))
+			for i, name := range header {
+				if i < len(record) {
+					fields[name] = strings.TrimSpace(record[i])
+				}
+			}
+			return fields, nil
+		}, nil
+	case ImportFormatNDJSON:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		return func() (map[string]string, error) {
+			var obj map[string]any
+			if err := dec.Decode(&obj); err != nil {
+				return nil, err
+			}
+			fields := make(map[string]string, len(obj))
+			for k, v := range obj {
+				if v != nil {
+					fields[strings.ToLower(k)] = strings.TrimSpace(fmt.Sprint(v))
+				}
+			}
+			return fields, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("Invalid format %q, expected csv or ndjson", format)
+}
+
+// rowImporter imports rows one by one, each in its own savepoint
+type rowImporter struct {
+	kind     string
+	next     importRowFunc
+	skip     int
+	row      int
+	imported int
+	failed   int
+	eof      bool
+	keys     map[string]uint
+	errors   bytes.Buffer
+}
+
+func newRowImporter(kind string, next importRowFunc, job models.ImportJob) *rowImporter {
+	imp := &rowImporter{
+		kind:     kind,
+		next:     next,
+		skip:     job.ProcessedRows,
+		imported: job.ImportedRows,
+		failed:   job.FailedRows,
+		keys:     map[string]uint{},
+	}
+	if job.Errors == "" {
+		imp.errors.WriteString("row,error,record\n")
+	} else {
+		imp.errors.WriteString(job.Errors)
+	}
+	return imp
+}
+
+// progress returns the job columns to persist after a committed chunk
+func (imp *rowImporter) progress() map[string]any {
+	return map[string]any{
+		"processed_rows": imp.row,
+		"imported_rows":  imp.imported,
+		"failed_rows":    imp.failed,
+		"errors":         imp.errors.String(),
+	}
+}
+
+// run imports up to limit rows (all remaining when limit is 0). Rows already processed by a
+// resumed job are skipped. Read errors other than EOF abort the run.
+func (imp *rowImporter) run(tx *gorm.DB, limit int) error {
+	for n := 0; limit == 0 || n < limit; {
+		fields, err := imp.next()
+		if err == io.EOF {
+			imp.eof = true
+			return nil
+		}
+		imp.row++
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return fmt.Errorf("row %d: %w", imp.row, err)
+		}
+		if imp.row <= imp.skip {
+			continue
+		}
+		n++
+
+		if parseErr != nil {
+			imp.failed++
+			imp.recordError(imp.row, nil, parseErr)
+			continue
+		}
+
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			if imp.kind == ImportKindUsers {
+				return imp.importUser(tx, fields)
+			}
+			return imp.importPost(tx, fields)
+		})
+		if err != nil {
+			imp.failed++
+			imp.recordError(imp.row, fields, err)
+		} else {
+			imp.imported++
+		}
+	}
+	return nil
+}
+
+// recordError appends a line to the downloadable error report
+func (imp *rowImporter) recordError(row int, fields map[string]string, err error) {
+	imp.errors.WriteString(importErrorLine(row, fields, err))
+}
+
+// importErrorLine formats one CSV line of the error report: row, error, original record as JSON
+func importErrorLine(row int, fields map[string]string, err error) string {
+	record := ""
+	if fields != nil {
+		b, _ := json.Marshal(fields)
+		record = string(b)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{strconv.Itoa(row), err.Error(), record})
+	w.Flush()
+	return buf.String()
+}
+
+// importUser validates a users row as a CreateUserRequest and registers its author key
+func (imp *rowImporter) importUser(tx *gorm.DB, fields map[string]string) error {
+	req := CreateUserRequest{Name: fields["name"]}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return err
+	}
+
+	key := fields["key"]
+	if key != "" {
+		var existing models.UserExternalKey
+		if err := tx.First(&existing, "key = ?", key).Error; err == nil {
+			return fmt.Errorf("author key %q was already imported as user %d", key, existing.UserID)
+		}
+	}
+
+	user := models.User{Name: req.Name}
+	if err := tx.Create(&user).Error; err != nil {
+		return err
+	}
+	if err := recordUserEvent(tx, webhooks.UserCreated, user.ID); err != nil {
+		return err
+	}
+	if key != "" {
+		if err := tx.Create(&models.UserExternalKey{Key: key, UserID: user.ID}).Error; err != nil {
+			return err
+		}
+		imp.keys[key] = user.ID
+	}
+	return nil
+}
+
+// importPost validates a posts row as a CreatePostRequest, resolving author_key to a user ID
+func (imp *rowImporter) importPost(tx *gorm.DB, fields map[string]string) error {
+	var userID uint
+	if v := fields["user_id"]; v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid user_id %q", v)
+		}
+		userID = uint(id)
+	} else if key := fields["author_key"]; key != "" {
+		id, ok := imp.keys[key]
+		if !ok {
+			var mapping models.UserExternalKey
+			if err := tx.First(&mapping, "key = ?", key).Error; err != nil {
+				return fmt.Errorf("unknown author_key %q", key)
+			}
+			id = mapping.UserID
+			imp.keys[key] = id
+		}
+		userID = id
+	}
+
+	req := CreatePostRequest{Title: fields["title"], Body: fields["body"], UserID: userID}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return err
+	}
+
+	post := models.Post{Title: req.Title, Body: req.Body, UserID: req.UserID}
+	if err := tx.Create(&post).Error; err != nil {
+		return err
+	}
+	return recordPostEvent(tx, webhooks.PostCreated, post.ID)
+}
+
+// ImportsCreate godoc
+// @Summary Import users or posts
+// @Description Upload a CSV (with a header row) or NDJSON file, either as multipart field "file" or as the raw request body.
+// @Description Users rows have name and an optional key; posts rows have title, body and either user_id or author_key.
+// @Tags imports
+// @Accept multipart/form-data,text/csv,application/x-ndjson
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param kind query string true "users or posts"
+// @Param format query string false "csv or ndjson (default: from the file name or Content-Type)"
+// @Param mode query string false "atomic (default) or chunked"
+// @Param chunk_size query int false "Rows per transaction in chunked mode"
+// @Param dry_run query bool false "Validate without importing"
+// @Param resume query int false "ID of a chunked job to resume"
+// @Param file formData file false "File to import"
+// @Success 200 {object} ImportJobResponse "Import finished"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 422 {object} ImportJobResponse "Import failed; see GET /imports/{id}/errors"
+// @Router /imports [post]
+func ImportsCreate(c *gin.Context) {
+	opts := ImportOptions{
+		Kind:   c.Query("kind"),
+		Format: c.Query("format"),
+		Mode:   c.Query("mode"),
+		DryRun: c.Query("dry_run") == "true",
+	}
+	if v := c.Query("chunk_size"); v != "" {
+		opts.ChunkSize, _ = strconv.Atoi(v)
+	}
+	if v := c.Query("resume"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.Error(fmt.Errorf("Invalid resume %q", v))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		opts.ResumeJob = uint(id)
+	}
+
+	var input io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.Error(errors.New("Missing multipart field \"file\""))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.Error(err)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		input = file
+		if opts.Format == "" {
+			opts.Format = ImportFormatFromName(header.Filename)
+		}
+	}
+	if opts.Format == "" {
+		opts.Format = ImportFormatFromName(c.ContentType())
+	}
+
+	job, err := RunImport(opts, input)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if job.Status == ImportStatusFailed {
+		status = http.StatusUnprocessableEntity
+	}
+	respond(c, status, ImportJobResponse{Job: mapImportJob(job)})
+}
+
+// ImportsShow godoc
+// @Summary Get an import job
+// @Description Get the progress and counts of an import
+// @Tags imports
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Import job ID"
+// @Success 200 {object} ImportJobResponse "Import job found"
+// @Failure 404 {object} map[string]string "Import job not found"
+// @Router /imports/{id} [get]
+func ImportsShow(c *gin.Context) {
+	var job models.ImportJob
+	result := config.DB.First(&job, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Import job not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	respond(c, 200, ImportJobResponse{Job: mapImportJob(job)})
+}
+
+// ImportErrors godoc
+// @Summary Download import errors
+// @Description Download the per-row errors of an import as CSV (row, error, record)
+// @Tags imports
+// @Produce text/csv
+// @Param id path int true "Import job ID"
+// @Success 200 {string} string "CSV error report"
+// @Failure 404 {object} map[string]string "Import job not found"
+// @Router /imports/{id}/errors [get]
+func ImportErrors(c *gin.Context) {
+	var job models.ImportJob
+	result := config.DB.First(&job, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Import job not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%d-errors.csv"`, job.ID))
+	c.Data(200, "text/csv; charset=utf-8", []byte(job.Errors))
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/webhooks"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostTransitions lists the statuses a post can move to from each status
+var PostTransitions = map[string][]string{
+	models.PostStatusDraft:     {models.PostStatusScheduled, models.PostStatusPublished, models.PostStatusArchived},
+	models.PostStatusScheduled: {models.PostStatusDraft, models.PostStatusScheduled, models.PostStatusPublished, models.PostStatusArchived},
+	models.PostStatusPublished: {models.PostStatusDraft, models.PostStatusArchived},
+	models.PostStatusArchived:  {models.PostStatusDraft},
+}
+
+// SchedulePostRequest represents the request body for scheduling a post
+type SchedulePostRequest struct {
+	PublishAt time.Time `json:"publish_at" xml:"publish_at" yaml:"publish_at" binding:"required" example:"2030-01-01T09:00:00Z"`
+}
+
+// TransitionError is returned when a post cannot move from its current status to the requested one
+type TransitionError struct {
+	From, To string
+}
+
+func (e TransitionError) Error() string {
+	return fmt.Sprintf("Cannot move a %s post to %s", e.From, e.To)
+}
+
+// viewerHeader identifies the user making a request. The API has no authentication yet, so it is
+// only used to show users their own unpublished posts.
+const viewerHeader = "X-User-ID"
+
+// viewerID reads the viewer from the request, or 0 for anonymous requests. Responses that depend
+// on the viewer are marked private so shared caches do not hand one user's drafts to another.
+func viewerID(c *gin.Context) uint {
+	c.Writer.Header().Add("Vary", viewerHeader)
+	id, err := strconv.ParseUint(c.GetHeader(viewerHeader), 10, 64)
+	if err != nil {
+		return 0
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	return uint(id)
+}
+
+// VisibleScope keeps published posts plus, for a signed-in viewer, the viewer's own posts in any status
+func VisibleScope(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db.Where("posts.status = ?", models.PostStatusPublished)
+		}
+		return db.Where("(posts.status = ? OR posts.user_id = ?)", models.PostStatusPublished, viewerID)
+	}
+}
+
+// visibleTo reports whether VisibleScope(viewerID) keeps post
+func visibleTo(post models.Post, viewerID uint) bool {
+	return post.Status == models.PostStatusPublished || (viewerID != 0 && post.UserID == viewerID)
+}
+
+// TransitionPost moves the post with the given ID to status to. publishAt is required when
+// scheduling and ignored otherwise.
+func TransitionPost(id any, to string, publishAt *time.Time) (models.Post, error) {
+	var post models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// lock the row so a transition cannot race the scheduler publishing the same post
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&post, id).Error; err != nil {
+			return NotFoundError{"Unable to find a post"}
+		}
+		if !slices.Contains(PostTransitions[post.Status], to) {
+			return TransitionError{From: post.Status, To: to}
+		}
+
+		from := post.Status
+		updates := map[string]any{"status": to}
+		switch to {
+		case models.PostStatusScheduled:
+			if publishAt == nil || !publishAt.After(time.Now()) {
+				return ValidationError{errors.New("publish_at must be in the future")}
+			}
+			updates["published_at"] = *publishAt
+		case models.PostStatusPublished:
+			updates["published_at"] = time.Now()
+		case models.PostStatusDraft:
+			updates["published_at"] = nil
+		}
+		if err := tx.Model(&post).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPostStatusEvent(tx, webhooks.PostUpdated, post.ID, from)
+	})
+	if err != nil {
+		return models.Post{}, err
+	}
+	invalidatePosts(post.ID)
+
+	if err := config.DB.Scopes(preloadPostRelations).First(&post, post.ID).Error; err != nil {
+		return models.Post{}, err
+	}
+	return post, nil
+}
+
+// PublishDuePosts publishes every scheduled post whose publish time has passed and returns how many
+// it published. Published posts keep their scheduled time as published_at.
+func PublishDuePosts(now time.Time) (int64, error) {
+	var published []models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&published).Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Where("status = ? AND published_at <= ?", models.PostStatusScheduled, now).
+			Update("status", models.PostStatusPublished)
+		if result.Error != nil {
+			return result.Error
+		}
+		for _, post := range published {
+			if err := recordPostStatusEvent(tx, webhooks.PostUpdated, post.ID, models.PostStatusScheduled); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, post := range published {
+		invalidatePosts(post.ID)
+	}
+	return int64(len(published)), nil
+}
+
+// RunScheduler publishes due posts every interval until ctx is done. It runs once straight away,
+// so posts that came due while the server was down are published on startup. The update is a
+// single statement, so several servers can run the scheduler at the same time.
+func RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := PublishDuePosts(time.Now()); err != nil {
+			log.Println("scheduler: publishing due posts failed:", err)
+		} else if n > 0 {
+			log.Printf("scheduler: published %d scheduled posts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// respondTransition writes the post after a transition, or the error that prevented it
+func respondTransition(c *gin.Context, post models.Post, err error) {
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
+	}
+
+	respond(c, 200, PostResponse{Post: mapPost(post)})
+}
+
+// PostsPublish godoc
+// @Summary Publish a post
+// @Description Publish a draft or scheduled post now
+// @Tags posts
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Success 200 {object} PostResponse "Published post"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Transition not allowed"
+// @Router /posts/{id}/publish [post]
+func PostsPublish(c *gin.Context) {
+	post, err := TransitionPost(c.Param("id"), models.PostStatusPublished, nil)
+	respondTransition(c, post, err)
+}
+
+// PostsSchedule godoc
+// @Summary Schedule a post
+// @Description Schedule a draft post, or reschedule a scheduled one, to be published at publish_at
+// @Tags posts
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param schedule body SchedulePostRequest true "Publish time"
+// @Success 200 {object} PostResponse "Scheduled post"
+// @Failure 400 {object} map[string]string "publish_at missing or in the past"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Transition not allowed"
+// @Router /posts/{id}/schedule [post]
+func PostsSchedule(c *gin.Context) {
+	var body SchedulePostRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	post, err := TransitionPost(c.Param("id"), models.PostStatusScheduled, &body.PublishAt)
+	respondTransition(c, post, err)
+}
+
+// PostsUnpublish godoc
+// @Summary Move a post back to draft
+// @Description Unpublish a published post, cancel a scheduled one or restore an archived one as a draft
+// @Tags posts
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Success 200 {object} PostResponse "Draft post"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Transition not allowed"
+// @Router /posts/{id}/unpublish [post]
+func PostsUnpublish(c *gin.Context) {
+	post, err := TransitionPost(c.Param("id"), models.PostStatusDraft, nil)
+	respondTransition(c, post, err)
+}
+
+// PostsArchive godoc
+// @Summary Archive a post
+// @Description Hide a post from public lists without deleting it
+// @Tags posts
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Success 200 {object} PostResponse "Archived post"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Transition not allowed"
+// @Router /posts/{id}/archive [post]
+func PostsArchive(c *gin.Context) {
+	post, err := TransitionPost(c.Param("id"), models.PostStatusArchived, nil)
+	respondTransition(c, post, err)
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"rest_api/cache"
+	"rest_api/changes"
+	"rest_api/config"
+	"rest_api/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLookupCacheSize = 1000
+	defaultLookupCacheTTL  = 30 * time.Second
+)
+
+// postLookups and userLookups cache the posts and users GET /posts/:id and GET /users/:id read.
+// Writes through this server remove what they change straight away; writes through other servers
+// do once the change bus hears about them, including the count changes and tag renames that leave
+// no outbox event. CACHE_TTL bounds how stale anything else can get.
+// They are made on first use, after the environment is loaded.
+var (
+	postLookups = sync.OnceValue(func() *cache.ReadThrough[models.Post] {
+		return cache.NewReadThrough[models.Post](cache.NewLRU[models.Post](
+			config.GetEnvInt("POST_CACHE_SIZE", defaultLookupCacheSize), lookupCacheTTL()))
+	})
+	userLookups = sync.OnceValue(func() *cache.ReadThrough[models.User] {
+		return cache.NewReadThrough[models.User](cache.NewLRU[models.User](
+			config.GetEnvInt("USER_CACHE_SIZE", defaultLookupCacheSize), lookupCacheTTL()))
+	})
+)
+
+// lookupCacheTTL reads CACHE_TTL; 0 turns the lookup caches off
+func lookupCacheTTL() time.Duration {
+	return config.GetEnvDuration("CACHE_TTL", defaultLookupCacheTTL)
+}
+
+func init() {
+	changeBus.Subscribe(func(c changes.Change) {
+		switch c.Kind {
+		case changes.KindPost:
+			invalidatePosts(c.ID)
+		case changes.KindUser:
+			invalidateUsers(c.ID)
+		case changes.KindAllPosts:
+			postLookups().InvalidateAll(context.Background())
+		case changes.KindAllUsers:
+			userLookups().InvalidateAll(context.Background())
+		}
+	})
+}
+
+// LookupCacheStats counts the hits and misses of one lookup cache
+type LookupCacheStats struct {
+	Hits   int64 `json:"hits" xml:"hits" yaml:"hits" example:"940"`
+	Misses int64 `json:"misses" xml:"misses" yaml:"misses" example:"60"`
+	// Loads is how many misses read the database; concurrent misses for one key share a read
+	Loads int64 `json:"loads" xml:"loads" yaml:"loads" example:"52"`
+}
+
+// CacheStatsResponse represents the lookup cache metrics of this server since it started
+type CacheStatsResponse struct {
+	Posts LookupCacheStats `json:"posts" xml:"posts" yaml:"posts"`
+	Users LookupCacheStats `json:"users" xml:"users" yaml:"users"`
+}
+
+func lookupKey(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// findPost returns the post with the given ID and its relations, unless it is deleted
+func findPost(ctx context.Context, id uint) (models.Post, error) {
+	return postLookups().Get(ctx, lookupKey(id), func(ctx context.Context) (models.Post, error) {
+		var post models.Post
+		err := config.DB.WithContext(ctx).Scopes(preloadPostRelations).First(&post, id).Error
+		return post, err
+	})
+}
+
+// findUser returns the user with the given ID
+func findUser(ctx context.Context, id uint) (models.User, error) {
+	return userLookups().Get(ctx, lookupKey(id), func(ctx context.Context) (models.User, error) {
+		var user models.User
+		err := config.DB.WithContext(ctx).First(&user, id).Error
+		return user, err
+	})
+}
+
+// invalidatePosts drops the cached copies of posts after they changed
+func invalidatePosts(ids ...uint) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, lookupKey(id))
+	}
+	postLookups().Invalidate(context.Background(), keys...)
+}
+
+// invalidateUsers drops the cached copies of users after they changed
+func invalidateUsers(ids ...uint) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, lookupKey(id))
+	}
+	userLookups().Invalidate(context.Background(), keys...)
+}
+
+func mapLookupStats(s cache.Stats) LookupCacheStats {
+	return LookupCacheStats{Hits: s.Hits, Misses: s.Misses, Loads: s.Loads}
+}
+
+// CacheStatsShow godoc
+// @Summary Show lookup cache metrics
+// @Description Hits, misses and database reads of the caches in front of GET /posts/:id and GET /users/:id on this server since
+// @Description it started. Admin only.
+// @Tags cache
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Success 200 {object} CacheStatsResponse
+// @Router /cache/stats [get]
+func CacheStatsShow(c *gin.Context) {
+	respond(c, http.StatusOK, CacheStatsResponse{
+		Posts: mapLookupStats(postLookups().Stats()),
+		Users: mapLookupStats(userLookups().Stats()),
+	})
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"fmt"
+	"rest_api/config"
+	"rest_api/markdown"
+	"rest_api/models"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	BodyFormatMarkdown = "markdown"
+	BodyFormatHTML     = "html"
+
+	defaultMarkdownCacheSize = 1000
+)
+
+var (
+	markdownCacheOnce sync.Once
+	markdownCache     *markdown.Cache
+)
+
+// renderCache is created on first use so MARKDOWN_CACHE_SIZE is read after the environment is loaded
+func renderCache() *markdown.Cache {
+	markdownCacheOnce.Do(func() {
+		markdownCache = markdown.NewCache(config.GetEnvInt("MARKDOWN_CACHE_SIZE", defaultMarkdownCacheSize))
+	})
+	return markdownCache
+}
+
+// bodyFormat parses the optional format query parameter of the post endpoints
+func bodyFormat(c *gin.Context) (string, error) {
+	format := c.DefaultQuery("format", BodyFormatMarkdown)
+	if format != BodyFormatMarkdown && format != BodyFormatHTML {
+		return "", fmt.Errorf("Invalid format %q, expected markdown or html", format)
+	}
+	return format, nil
+}
+
+// formatETagName keeps the validators of rendered and plain responses apart
+func formatETagName(name, format string) string {
+	if format == BodyFormatHTML {
+		return name + "-html"
+	}
+	return name
+}
+
+// renderBodies adds body_html and toc to posts when format is html. Renderings are cached by
+// content, so a body is only rendered again after it changes.
+func renderBodies(format string, posts []models.JsonPost) error {
+	if format != BodyFormatHTML {
+		return nil
+	}
+	for i := range posts {
+		rendered, err := renderCache().Render(posts[i].Body)
+		if err != nil {
+			return err
+		}
+		posts[i].BodyHTML = rendered.HTML
+		posts[i].TOC = rendered.TOC
+	}
+	return nil
+}
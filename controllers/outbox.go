@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"rest_api/changes"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/webhooks"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultOutboxMaxAttempts = 10
+	defaultOutboxRetryBase   = time.Second
+	defaultOutboxRetryMax    = 5 * time.Minute
+	defaultOutboxRetention   = 24 * time.Hour
+
+	// outboxErrorLength is how much of a handler failure is kept on the event
+	outboxErrorLength = 1000
+	// outboxPruneInterval is how often processed events are deleted
+	outboxPruneInterval = time.Minute
+)
+
+// OutboxHandler is given every event the relay claims. It runs in the relay's transaction, so what
+// it writes is committed together with the event being marked done; when it fails, its writes are
+// rolled back and the event is tried again later.
+type OutboxHandler func(tx *gorm.DB, event models.OutboxEvent) error
+
+type outboxHandler struct {
+	name   string
+	handle OutboxHandler
+}
+
+// outboxHandlers are called in the order they were registered
+var outboxHandlers []outboxHandler
+
+// RegisterOutboxHandler adds a handler for outbox events. It must be called before the relay
+// starts, from an init function.
+func RegisterOutboxHandler(name string, handle OutboxHandler) {
+	outboxHandlers = append(outboxHandlers, outboxHandler{name: name, handle: handle})
+}
+
+// outboxMetrics counts what the relay of this server has done since it started
+var outboxMetrics struct {
+	dispatched atomic.Int64
+	retried    atomic.Int64
+	failed     atomic.Int64
+	// lastLag is how long the last dispatched event waited in the outbox, in nanoseconds
+	lastLag atomic.Int64
+}
+
+// OutboxStatsResponse represents the outbox metrics
+type OutboxStatsResponse struct {
+	// Pending is how many events are waiting for the relay
+	Pending int64 `json:"pending" xml:"pending" yaml:"pending" example:"3"`
+	// Failed is how many events ran out of attempts
+	Failed int64 `json:"failed" xml:"failed" yaml:"failed" example:"0"`
+	// LagSeconds is the age of the oldest pending event
+	LagSeconds float64 `json:"lag_seconds" xml:"lag_seconds" yaml:"lag_seconds" example:"0.8"`
+	// LastLagSeconds is how long the last event this server dispatched waited
+	LastLagSeconds float64 `json:"last_lag_seconds" xml:"last_lag_seconds" yaml:"last_lag_seconds" example:"0.4"`
+	// Dispatched, Retried and Abandoned count events this server handled since it started
+	Dispatched int64 `json:"dispatched" xml:"dispatched" yaml:"dispatched" example:"1200"`
+	Retried    int64 `json:"retried" xml:"retried" yaml:"retried" example:"2"`
+	Abandoned  int64 `json:"abandoned" xml:"abandoned" yaml:"abandoned" example:"0"`
+}
+
+// writeOutboxEvent adds an event about the given aggregate to the outbox, in the transaction that
+// made the change, so the event is relayed if and only if the change is committed. Every server is
+// told about the change when it commits.
+func writeOutboxEvent(tx *gorm.DB, aggregateType string, aggregateID uint, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := models.OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Type:          eventType,
+		Payload:       string(payload),
+		Status:        models.OutboxPending,
+		AvailableAt:   time.Now(),
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return err
+	}
+	return changes.Notify(tx, changes.FromEventType(eventType, aggregateID, event.ID))
+}
+
+// postEventData is the payload of post events. PreviousStatus is only set by changes of status,
+// so consumers can tell when a post stopped being published.
+type postEventData struct {
+	PostResponse
+	PreviousStatus string `json:"previous_status,omitempty"`
+}
+
+// recordPostEvent writes eventType for the post with the given ID to the outbox, with the post as
+// GET /posts/:id shows it. Deleted posts are sent with their deleted_at.
+func recordPostEvent(tx *gorm.DB, eventType string, postID uint) error {
+	return recordPostStatusEvent(tx, eventType, postID, "")
+}
+
+// recordPostStatusEvent is recordPostEvent for a change that moved the post from status previous
+func recordPostStatusEvent(tx *gorm.DB, eventType string, postID uint, previous string) error {
+	var post models.Post
+	if err := tx.Unscoped().Scopes(preloadPostRelations).First(&post, postID).Error; err != nil {
+		return err
+	}
+	data := postEventData{PostResponse: PostResponse{Post: mapPost(post)}, PreviousStatus: previous}
+	return writeOutboxEvent(tx, models.AggregatePost, post.ID, eventType, data)
+}
+
+// recordUserEvent writes eventType for the user with the given ID to the outbox, as GET /users/:id shows it
+func recordUserEvent(tx *gorm.DB, eventType string, userID uint) error {
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return err
+	}
+	return writeOutboxEvent(tx, models.AggregateUser, user.ID, eventType, UserResponse{User: mapUser(user)})
+}
+
+// RelayOutbox hands every pending event that is due to the outbox handlers, oldest first, and
+// returns how many it handled. An event waits until the earlier events of the same aggregate are
+// done, so handlers see each post's and user's events in order. Events are locked while they are
+// handled and locked rows are skipped, so several servers can run the relay at the same time.
+func RelayOutbox(ctx context.Context) (int, error) {
+	handled := 0
+	for ctx.Err() == nil {
+		var event models.OutboxEvent
+		var handleErr error
+		var outcome map[string]any
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND available_at <= ?", models.OutboxPending, time.Now()).
+				Where(`NOT EXISTS (SELECT 1 FROM outbox earlier WHERE earlier.status = ?
+					AND earlier.aggregate_type = outbox.aggregate_type AND earlier.aggregate_id = outbox.aggregate_id
+					AND earlier.id < outbox.id)`, models.OutboxPending).
+				Order("id").First(&event).Error
+			if err != nil {
+				return err
+			}
+
+			handleErr = tx.Transaction(func(tx *gorm.DB) error {
+				for _, h := range outboxHandlers {
+					if err := h.handle(tx, event); err != nil {
+						return fmt.Errorf("%s: %w", h.name, err)
+					}
+				}
+				return nil
+			})
+			outcome = outboxOutcome(event, handleErr, time.Now())
+			return tx.Model(&event).Updates(outcome).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return handled, nil
+		}
+		if err != nil {
+			return handled, err
+		}
+		handled++
+
+		switch {
+		case handleErr == nil:
+			outboxMetrics.dispatched.Add(1)
+			outboxMetrics.lastLag.Store(int64(time.Since(event.CreatedAt)))
+		case outcome["status"] == models.OutboxFailed:
+			outboxMetrics.failed.Add(1)
+			log.Printf("outbox: giving up on event %d (%s): %v", event.ID, event.Type, handleErr)
+		default:
+			outboxMetrics.retried.Add(1)
+			log.Printf("outbox: event %d (%s) failed, will retry: %v", event.ID, event.Type, handleErr)
+		}
+	}
+	return handled, ctx.Err()
+}
+
+// outboxOutcome returns the updates that record an attempt at handling event ending with err
+func outboxOutcome(event models.OutboxEvent, err error, now time.Time) map[string]any {
+	attempts := event.Attempts + 1
+	updates := map[string]any{"attempts": attempts}
+	switch {
+	case err == nil:
+		updates["status"] = models.OutboxDone
+		updates["processed_at"] = now
+		updates["last_error"] = ""
+	case attempts >= config.GetEnvInt("OUTBOX_MAX_ATTEMPTS", defaultOutboxMaxAttempts):
+		updates["status"] = models.OutboxFailed
+		updates["last_error"] = truncate(err.Error(), outboxErrorLength)
+	default:
+		wait := webhooks.Backoff(attempts,
+			config.GetEnvDuration("OUTBOX_RETRY_BASE", defaultOutboxRetryBase),
+			config.GetEnvDuration("OUTBOX_RETRY_MAX", defaultOutboxRetryMax))
+		updates["available_at"] = now.Add(wait)
+		updates["last_error"] = truncate(err.Error(), outboxErrorLength)
+	}
+	return updates
+}
+
+// pruneOutbox deletes events that were done longer than OUTBOX_RETENTION ago. Failed events are
+// kept until someone looks into them.
+func pruneOutbox() error {
+	before := time.Now().Add(-config.GetEnvDuration("OUTBOX_RETENTION", defaultOutboxRetention))
+	return config.DB.Where("status = ? AND processed_at < ?", models.OutboxDone, before).Delete(&models.OutboxEvent{}).Error
+}
+
+// outboxWork wakes the outbox relay when a change is committed, so it does not wait for the next tick
+var outboxWork = make(chan struct{}, 1)
+
+// notifyOutboxRelay asks the relay to look for pending events
+func notifyOutboxRelay() {
+	select {
+	case outboxWork <- struct{}{}:
+	default:
+	}
+}
+
+// RunOutboxRelay relays outbox events until ctx is done. It runs every interval, when any server
+// commits a change and once straight away, so events written before a crash or restart are relayed.
+func RunOutboxRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		if n, err := RelayOutbox(ctx); err != nil && ctx.Err() == nil {
+			log.Println("outbox: relaying failed:", err)
+		} else if n > 0 {
+			notifyPostStream()
+		}
+		if time.Since(pruned) >= outboxPruneInterval {
+			if err := pruneOutbox(); err != nil {
+				log.Println("outbox: pruning failed:", err)
+			}
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-outboxWork:
+		}
+	}
+}
+
+// OutboxStats reads the outbox backlog and adds this server's relay counters
+func OutboxStats() (OutboxStatsResponse, error) {
+	var backlog struct {
+		Pending int64
+		Failed  int64
+		Oldest  *time.Time
+	}
+	err := config.DB.Model(&models.OutboxEvent{}).
+		Select(`COUNT(*) FILTER (WHERE status = ?) AS pending, COUNT(*) FILTER (WHERE status = ?) AS failed,
+			MIN(created_at) FILTER (WHERE status = ?) AS oldest`, models.OutboxPending, models.OutboxFailed, models.OutboxPending).
+		Where("status IN ?", []string{models.OutboxPending, models.OutboxFailed}).
+		Scan(&backlog).Error
+	if err != nil {
+		return OutboxStatsResponse{}, err
+	}
+
+	stats := OutboxStatsResponse{
+		Pending:        backlog.Pending,
+		Failed:         backlog.Failed,
+		LastLagSeconds: time.Duration(outboxMetrics.lastLag.Load()).Seconds(),
+		Dispatched:     outboxMetrics.dispatched.Load(),
+		Retried:        outboxMetrics.retried.Load(),
+		Abandoned:      outboxMetrics.failed.Load(),
+	}
+	if backlog.Oldest != nil {
+		stats.LagSeconds = time.Since(*backlog.Oldest).Seconds()
+	}
+	return stats, nil
+}
+
+// OutboxStatsShow godoc
+// @Summary Show outbox metrics
+// @Description How many domain events are waiting to be relayed to webhooks and the live stream, how long the oldest has waited,
+// @Description and what this server's relay has done since it started. Admin only.
+// @Tags outbox
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Success 200 {object} OutboxStatsResponse
+// @Router /outbox/stats [get]
+func OutboxStatsShow(c *gin.Context) {
+	stats, err := OutboxStats()
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	respond(c, http.StatusOK, stats)
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageCursor points just past the last row of a page ordered by a timestamp and ID, newest first.
+// Clients get it back as an opaque string and send it unchanged to fetch the next page.
+type pageCursor struct {
+	At time.Time
+	ID uint
+}
+
+func (p pageCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", p.At.UnixNano(), p.ID)))
+}
+
+// parseCursor decodes a cursor produced by pageCursor.String
+func parseCursor(s string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor %q", s)
+	}
+	var nanos int64
+	var id uint
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &nanos, &id); err != nil {
+		return nil, fmt.Errorf("Invalid cursor %q", s)
+	}
+	return &pageCursor{At: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// pageParams parses the optional limit and cursor query parameters
+func pageParams(c *gin.Context) (int, *pageCursor, error) {
+	limit := defaultPageLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return 0, nil, fmt.Errorf("Invalid limit %q, expected 1 to %d", v, maxPageLimit)
+		}
+		limit = n
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := parseCursor(v)
+		if err != nil {
+			return 0, nil, err
+		}
+		return limit, cursor, nil
+	}
+	return limit, nil, nil
+}
+
+// keysetPage orders by the given timestamp and ID columns, newest first, and starts after cursor.
+// It fetches one row more than limit so the caller can tell whether there is a next page.
+func keysetPage(atColumn, idColumn string, limit int, cursor *pageCursor) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cursor != nil {
+			db = db.Where("("+atColumn+", "+idColumn+") < (?, ?)", cursor.At, cursor.ID)
+		}
+		return db.Order(atColumn + " DESC, " + idColumn + " DESC").Limit(limit + 1)
+	}
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReactionTypes are the reactions a user can add to a post
+var ReactionTypes = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// ReactionRequest represents the request body for adding a reaction
+type ReactionRequest struct {
+	UserID uint `json:"user_id" xml:"user_id" yaml:"user_id" form:"user_id" binding:"required" example:"1"`
+}
+
+// ReactionCountsResponse represents a post's reaction counts after a reaction was added or removed
+type ReactionCountsResponse struct {
+	ReactionCounts []models.JsonReactionCount `json:"reaction_counts" xml:"reaction_counts>reaction" yaml:"reaction_counts"`
+}
+
+// ReactionsResponse represents the response for listing who reacted to a post
+type ReactionsResponse struct {
+	Reactions []models.JsonReaction `json:"reactions" xml:"reactions>reaction" yaml:"reactions"`
+}
+
+// mapReactionCounts converts DB models to API DTOs, leaving out types nobody uses any more
+func mapReactionCounts(counts []models.ReactionCount) []models.JsonReactionCount {
+	var out []models.JsonReactionCount
+	for _, c := range counts {
+		if c.Count > 0 {
+			out = append(out, models.JsonReactionCount{Type: c.Type, Count: c.Count})
+		}
+	}
+	return out
+}
+
+// reactionCounts loads the current reaction counts of a post
+func reactionCounts(postID uint) ([]models.JsonReactionCount, error) {
+	var counts []models.ReactionCount
+	err := config.DB.Where("post_id = ? AND count > 0", postID).Order("type").Find(&counts).Error
+	out := mapReactionCounts(counts)
+	if out == nil {
+		out = []models.JsonReactionCount{}
+	}
+	return out, err
+}
+
+// reactionTarget parses the reaction type and loads the post from the path if the viewer can see
+// it, writing the error response on failure
+func reactionTarget(c *gin.Context) (models.Post, string, bool) {
+	reactionType := c.Param("type")
+	if !slices.Contains(ReactionTypes, reactionType) {
+		c.Error(fmt.Errorf("Unknown reaction type %q, expected one of %s", reactionType, strings.Join(ReactionTypes, ", ")))
+		c.Status(http.StatusBadRequest)
+		return models.Post{}, "", false
+	}
+
+	var post models.Post
+	if err := config.DB.Scopes(VisibleScope(viewerID(c))).First(&post, c.Param("id")).Error; err != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return models.Post{}, "", false
+	}
+	return post, reactionType, true
+}
+
+// adjustReactionCount moves a post's counter for reactionType by delta. The counter row is updated
+// in place, so concurrent toggles on the same post serialize on it instead of overwriting each other.
+// The post's updated_at is bumped so cached representations are revalidated.
+func adjustReactionCount(tx *gorm.DB, postID uint, reactionType string, delta int) error {
+	err := tx.Exec(`INSERT INTO reaction_counts (post_id, type, count) VALUES (?, ?, GREATEST(?, 0))
+		ON CONFLICT (post_id, type) DO UPDATE SET count = GREATEST(reaction_counts.count + ?, 0)`,
+		postID, reactionType, delta, delta).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.Post{}).Where("id = ?", postID).UpdateColumn("updated_at", time.Now()).Error
+}
+
+// ReactionsIndex godoc
+// @Summary List the reactions to a post
+// @Description Get who reacted to a post and how, oldest first
+// @Tags reactions
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param type query string false "Only reactions of this type"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Success 200 {object} ReactionsResponse "Reactions"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/reactions [get]
+func ReactionsIndex(c *gin.Context) {
+	var post models.Post
+	result := config.DB.Scopes(VisibleScope(viewerID(c))).First(&post, c.Param("id"))
+
+	if result.Error != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	query := config.DB.Where("post_id = ?", post.ID)
+	if t := c.Query("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+	var reactions []models.Reaction
+	query.Order("created_at, id").Find(&reactions)
+
+	out := make([]models.JsonReaction, 0, len(reactions))
+	for _, r := range reactions {
+		out = append(out, models.JsonReaction{UserID: r.UserID, Type: r.Type, CreatedAt: r.CreatedAt.Format(time.RFC3339)})
+	}
+	respond(c, 200, ReactionsResponse{Reactions: out})
+}
+
+// ReactionsPut godoc
+// @Summary React to a post
+// @Description Add the user's reaction of the given type to a post. Repeating the request changes nothing, so a reaction is only counted once.
+// @Tags reactions
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param type path string true "Reaction type" Enums(like, love, laugh, wow, sad, angry)
+// @Param reaction body ReactionRequest true "Reacting user"
+// @Param X-User-ID header int false "Viewing user, who can also react to their own unpublished posts"
+// @Success 200 {object} ReactionCountsResponse "The post's reaction counts"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/reactions/{type} [put]
+func ReactionsPut(c *gin.Context) {
+	var body ReactionRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	post, reactionType, ok := reactionTarget(c)
+	if !ok {
+		return
+	}
+	if err := config.DB.First(&models.User{}, body.UserID).Error; err != nil {
+		c.Error(errors.New("User not found"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// the unique index makes a repeated or concurrent duplicate insert a no-op, and only
+		// the request that actually inserted the row moves the counter
+		added := tx.Exec(`INSERT INTO reactions (post_id, user_id, type, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (post_id, user_id, type) DO NOTHING`, post.ID, body.UserID, reactionType, time.Now())
+		if added.Error != nil || added.RowsAffected == 0 {
+			return added.Error
+		}
+		if err := adjustReactionCount(tx, post.ID, reactionType, 1); err != nil {
+			return err
+		}
+		return notifyPostsUpdated(tx, post.ID)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	invalidatePosts(post.ID)
+
+	counts, err := reactionCounts(post.ID)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	respond(c, 200, ReactionCountsResponse{ReactionCounts: counts})
+}
+
+// ReactionsDelete godoc
+// @Summary Remove a reaction from a post
+// @Description Remove the user's reaction of the given type from a post. Removing a reaction that is not there changes nothing.
+// @Tags reactions
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param type path string true "Reaction type" Enums(like, love, laugh, wow, sad, angry)
+// @Param user_id query int true "Reacting user"
+// @Param X-User-ID header int false "Viewing user, who can also react to their own unpublished posts"
+// @Success 200 {object} ReactionCountsResponse "The post's reaction counts"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/reactions/{type} [delete]
+func ReactionsDelete(c *gin.Context) {
+	var body ReactionRequest
+	err := c.BindQuery(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	post, reactionType, ok := reactionTarget(c)
+	if !ok {
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		removed := tx.Where("post_id = ? AND user_id = ? AND type = ?", post.ID, body.UserID, reactionType).Delete(&models.Reaction{})
+		if removed.Error != nil || removed.RowsAffected == 0 {
+			return removed.Error
+		}
+		if err := adjustReactionCount(tx, post.ID, reactionType, -1); err != nil {
+			return err
+		}
+		return notifyPostsUpdated(tx, post.ID)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	invalidatePosts(post.ID)
+
+	counts, err := reactionCounts(post.ID)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	respond(c, 200, ReactionCountsResponse{ReactionCounts: counts})
+}
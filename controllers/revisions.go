@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/textdiff"
+	"rest_api/webhooks"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DiffFormatUnified = "unified"
+	DiffFormatWords   = "words"
+	diffContextLines  = 3
+)
+
+// RevisionsResponse represents the response for listing a post's revisions
+type RevisionsResponse struct {
+	Revisions []models.JsonPostRevision `json:"revisions" xml:"revisions>revision" yaml:"revisions"`
+}
+
+// RevisionResponse represents the response for a single revision
+type RevisionResponse struct {
+	Revision models.JsonPostRevision `json:"revision" xml:"revision" yaml:"revision"`
+}
+
+// RestoreRevisionResponse represents the post and the new revision created by a restore
+type RestoreRevisionResponse struct {
+	Post     models.JsonPost         `json:"post" xml:"post" yaml:"post"`
+	Revision models.JsonPostRevision `json:"revision" xml:"revision" yaml:"revision"`
+}
+
+// DiffResponse represents the changes between two revisions. The title is always diffed word by
+// word; the body is a unified diff or a list of word edits depending on the requested format.
+type DiffResponse struct {
+	From      int             `json:"from" xml:"from" yaml:"from" example:"1"`
+	To        int             `json:"to" xml:"to" yaml:"to" example:"2"`
+	Format    string          `json:"format" xml:"format" yaml:"format" example:"unified"`
+	Title     []textdiff.Edit `json:"title" xml:"title>edit" yaml:"title"`
+	Unified   string          `json:"unified,omitempty" xml:"unified,omitempty" yaml:"unified,omitempty" example:"--- rev 1\n+++ rev 2\n"`
+	BodyEdits []textdiff.Edit `json:"body_edits,omitempty" xml:"body_edits>edit,omitempty" yaml:"body_edits,omitempty"`
+}
+
+// mapRevision converts DB model to API DTO
+func mapRevision(m models.PostRevision) models.JsonPostRevision {
+	return models.JsonPostRevision{
+		Number:       m.Number,
+		PostID:       m.PostID,
+		Title:        m.Title,
+		Body:         m.Body,
+		EditorID:     m.EditorID,
+		RestoredFrom: m.RestoredFrom,
+		CreatedAt:    m.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// recordRevision saves the post's current title and body as its next revision. The post row is
+// locked first, if the caller has not already, so concurrent edits get consecutive numbers.
+func recordRevision(tx *gorm.DB, post models.Post, editorID *uint, restoredFrom *int) (models.PostRevision, error) {
+	if err := tx.Exec("SELECT 1 FROM posts WHERE id = ? FOR UPDATE", post.ID).Error; err != nil {
+		return models.PostRevision{}, err
+	}
+	var last int
+	if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return models.PostRevision{}, err
+	}
+
+	revision := models.PostRevision{PostID: post.ID, Number: last + 1, Title: post.Title, Body: post.Body, EditorID: editorID, RestoredFrom: restoredFrom}
+	return revision, tx.Create(&revision).Error
+}
+
+// savePostUpdates applies updates to post and records a revision when they change its title or
+// body. A new title also moves the post to a new slug. post must have been read in tx with a row
+// lock, so it is the version the updates replace.
+func savePostUpdates(tx *gorm.DB, post *models.Post, updates map[string]any, editorID *uint) error {
+	titleChanged, bodyChanged := false, false
+	if title, ok := updates["title"].(string); ok && title != post.Title {
+		post.Title, titleChanged = title, true
+	}
+	if body, ok := updates["body"].(string); ok && body != post.Body {
+		post.Body, bodyChanged = body, true
+	}
+
+	if err := tx.Model(post).Updates(updates).Error; err != nil {
+		return err
+	}
+	if titleChanged {
+		if err := models.UpdatePostSlug(tx, post); err != nil {
+			return err
+		}
+	}
+	if err := recordPostEvent(tx, webhooks.PostUpdated, post.ID); err != nil {
+		return err
+	}
+	if !titleChanged && !bodyChanged {
+		return nil
+	}
+	_, err := recordRevision(tx, *post, editorID, nil)
+	return err
+}
+
+// revisionPost loads the post from the path if the viewer may see it, writing the error response on failure
+func revisionPost(c *gin.Context) (models.Post, bool) {
+	var post models.Post
+	if err := config.DB.Scopes(VisibleScope(viewerID(c))).First(&post, c.Param("id")).Error; err != nil {
+		c.Error(errors.New("Unable to find a post"))
+		c.Status(http.StatusNotFound)
+		return models.Post{}, false
+	}
+	return post, true
+}
+
+// findRevision loads revision number of postID
+func findRevision(db *gorm.DB, postID uint, number string) (models.PostRevision, error) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return models.PostRevision{}, NotFoundError{fmt.Sprintf("Revision %q not found", number)}
+	}
+	var revision models.PostRevision
+	if err := db.Where("post_id = ? AND number = ?", postID, n).First(&revision).Error; err != nil {
+		return models.PostRevision{}, NotFoundError{fmt.Sprintf("Revision %d not found", n)}
+	}
+	return revision, nil
+}
+
+// RevisionsIndex godoc
+// @Summary List the revisions of a post
+// @Description Get every saved version of a post's title and body, newest first
+// @Tags revisions
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Success 200 {object} RevisionsResponse "Revisions"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/revisions [get]
+func RevisionsIndex(c *gin.Context) {
+	post, ok := revisionPost(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.PostRevision
+	config.DB.Where("post_id = ?", post.ID).Order("number DESC").Find(&revisions)
+
+	out := make([]models.JsonPostRevision, 0, len(revisions))
+	for _, r := range revisions {
+		out = append(out, mapRevision(r))
+	}
+	respond(c, 200, RevisionsResponse{Revisions: out})
+}
+
+// RevisionsShow godoc
+// @Summary Get a revision of a post
+// @Description Get one saved version of a post's title and body by its number
+// @Tags revisions
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param rev path int true "Revision number"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Success 200 {object} RevisionResponse "Revision"
+// @Failure 404 {object} map[string]string "Post or revision not found"
+// @Router /posts/{id}/revisions/{rev} [get]
+func RevisionsShow(c *gin.Context) {
+	post, ok := revisionPost(c)
+	if !ok {
+		return
+	}
+
+	revision, err := findRevision(config.DB, post.ID, c.Param("rev"))
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
+	}
+
+	respond(c, 200, RevisionResponse{Revision: mapRevision(revision)})
+}
+
+// RevisionsDiff godoc
+// @Summary Compare two revisions of a post
+// @Description Diff the title and body of two revisions. The body is a unified line diff by default, or word edits with format=words.
+// @Tags revisions
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param from query int false "Old revision (default: the one before to)"
+// @Param to query int false "New revision (default: the latest)"
+// @Param format query string false "unified (default) or words"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Success 200 {object} DiffResponse "Differences"
+// @Failure 400 {object} map[string]string "Invalid format"
+// @Failure 404 {object} map[string]string "Post or revision not found"
+// @Router /posts/{id}/revisions/diff [get]
+func RevisionsDiff(c *gin.Context) {
+	format := c.DefaultQuery("format", DiffFormatUnified)
+	if format != DiffFormatUnified && format != DiffFormatWords {
+		c.Error(errors.New("Invalid format, expected unified or words"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	post, ok := revisionPost(c)
+	if !ok {
+		return
+	}
+
+	to := c.Query("to")
+	if to == "" {
+		var latest int
+		config.DB.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).Select("COALESCE(MAX(number), 0)").Scan(&latest)
+		to = strconv.Itoa(latest)
+	}
+	newer, err := findRevision(config.DB, post.ID, to)
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
+	}
+	from := c.DefaultQuery("from", strconv.Itoa(newer.Number-1))
+	older, err := findRevision(config.DB, post.ID, from)
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
+	}
+
+	resp := DiffResponse{From: older.Number, To: newer.Number, Format: format, Title: textdiff.Words(older.Title, newer.Title)}
+	if format == DiffFormatWords {
+		resp.BodyEdits = textdiff.Words(older.Body, newer.Body)
+	} else {
+		resp.Unified = textdiff.Unified(older.Body, newer.Body, fmt.Sprintf("rev %d", older.Number), fmt.Sprintf("rev %d", newer.Number), diffContextLines)
+	}
+	respond(c, 200, resp)
+}
+
+// RevisionsRestore godoc
+// @Summary Restore a revision of a post
+// @Description Set the post's title and body back to those of an earlier revision. This adds a new revision; history is never rewritten.
+// @Tags revisions
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param id path int true "Post ID"
+// @Param rev path int true "Revision number to restore"
+// @Param X-User-ID header int false "Editing user, credited with the new revision"
+// @Success 200 {object} RestoreRevisionResponse "Restored post and its new revision"
+// @Failure 404 {object} map[string]string "Post or revision not found"
+// @Router /posts/{id}/revisions/{rev}/restore [post]
+func RevisionsRestore(c *gin.Context) {
+	var editorID *uint
+	if editor := viewerID(c); editor != 0 {
+		editorID = &editor
+	}
+
+	var post models.Post
+	var revision models.PostRevision
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&post, c.Param("id")).Error; err != nil {
+			return NotFoundError{"Unable to find a post"}
+		}
+		restored, err := findRevision(tx, post.ID, c.Param("rev"))
+		if err != nil {
+			return err
+		}
+		post.Title, post.Body = restored.Title, restored.Body
+		if err := tx.Model(&post).Updates(map[string]any{"title": post.Title, "body": post.Body}).Error; err != nil {
+			return err
+		}
+		if err := models.UpdatePostSlug(tx, &post); err != nil {
+			return err
+		}
+		if err := recordPostEvent(tx, webhooks.PostUpdated, post.ID); err != nil {
+			return err
+		}
+		revision, err = recordRevision(tx, post, editorID, &restored.Number)
+		return err
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(errorStatus(err))
+		return
+	}
+	invalidatePosts(post.ID)
+
+	config.DB.Scopes(preloadPostRelations).First(&post, post.ID)
+	respond(c, 200, RestoreRevisionResponse{Post: mapPost(post), Revision: mapRevision(revision)})
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"errors"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/webhooks"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The functions in this file hold the validation and persistence behind the post and user
+// write endpoints, so that the gin handlers, GraphQL and gRPC all behave the same way.
+
+// ValidationError marks an error caused by the request rather than by the database
+type ValidationError struct {
+	Err error
+}
+
+func (e ValidationError) Error() string { return e.Err.Error() }
+
+func (e ValidationError) Unwrap() error { return e.Err }
+
+// NotFoundError is returned when the post or user an operation targets does not exist
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string { return e.Message }
+
+// CreatePost validates req and inserts the post
+func CreatePost(req CreatePostRequest) (models.Post, error) {
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return models.Post{}, ValidationError{err}
+	}
+
+	var post models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if post, err = newPost(tx, req); err != nil {
+			return err
+		}
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return recordPostEvent(tx, webhooks.PostCreated, post.ID)
+	})
+	if err != nil {
+		return models.Post{}, err
+	}
+	return post, nil
+}
+
+// newPost builds an unsaved post from req, upserting its tags and categories
+func newPost(tx *gorm.DB, req CreatePostRequest) (models.Post, error) {
+	tags, err := upsertTags(tx, req.Tags)
+	if err != nil {
+		return models.Post{}, err
+	}
+	categories, err := upsertCategories(tx, req.Categories)
+	if err != nil {
+		return models.Post{}, err
+	}
+	post := models.Post{Title: req.Title, Body: req.Body, UserID: req.UserID, Tags: tags, Categories: categories, Status: req.Status}
+	if req.Status == models.PostStatusScheduled {
+		// nested posts and other callers may not have been through the required_if check
+		if req.PublishAt == nil || !req.PublishAt.After(time.Now()) {
+			return models.Post{}, ValidationError{errors.New("publish_at must be in the future")}
+		}
+		post.PublishedAt = req.PublishAt
+	}
+	return post, nil
+}
+
+// UpdatePost applies the non-empty fields of req to the post with the given ID. Tags and
+// categories are replaced when req lists them.
+func UpdatePost(id any, req UpdatePostRequest) (models.Post, error) {
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return models.Post{}, ValidationError{err}
+	}
+
+	var post models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// lock the row so the revision and slug are worked out from the title and body this
+		// update replaces, not from a copy another edit has since changed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&post, id).Error; err != nil {
+			return NotFoundError{"Unable to update a post"}
+		}
+		updates := PostUpdates(req)
+		if req.Tags != nil {
+			tags, err := upsertTags(tx, req.Tags)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&post).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+		if req.Categories != nil {
+			categories, err := upsertCategories(tx, req.Categories)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&post).Association("Categories").Replace(categories); err != nil {
+				return err
+			}
+		}
+		if len(updates) == 0 && (req.Tags != nil || req.Categories != nil) {
+			// keep ETags and updated_since filters in step with the new tags
+			updates["updated_at"] = time.Now()
+		}
+		if len(updates) > 0 {
+			return savePostUpdates(tx, &post, updates, req.EditorID)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Post{}, err
+	}
+	invalidatePosts(post.ID)
+
+	if err := config.DB.Scopes(preloadPostRelations).First(&post, post.ID).Error; err != nil {
+		return models.Post{}, err
+	}
+	return post, nil
+}
+
+// DeletePost soft-deletes the post with the given ID
+func DeletePost(id any) error {
+	var post models.Post
+	if err := config.DB.First(&post, id).Error; err != nil {
+		return NotFoundError{"Unable to delete a post"}
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&post).Error; err != nil {
+			return err
+		}
+		return recordPostEvent(tx, webhooks.PostDeleted, post.ID)
+	})
+	if err != nil {
+		return err
+	}
+	invalidatePosts(post.ID)
+	return nil
+}
+
+// CreateUser creates a user and their nested posts in one transaction
+func CreateUser(req CreateUserRequest) (models.User, []models.Post, error) {
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return models.User{}, nil, ValidationError{err}
+	}
+	if err := validateNestedPosts(req.Posts); err != nil {
+		return models.User{}, nil, ValidationError{err}
+	}
+
+	user := models.User{Name: req.Name}
+	var posts []models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := recordUserEvent(tx, webhooks.UserCreated, user.ID); err != nil {
+			return err
+		}
+		var err error
+		posts, err = createUserPosts(tx, user.ID, req.Posts)
+		return err
+	})
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	return user, posts, nil
+}
+
+// UpdateUser renames a user and adds or removes their posts in one transaction, returning the
+// user's posts afterwards
+func UpdateUser(id any, req UpdateUserRequest) (models.User, []models.Post, error) {
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return models.User{}, nil, ValidationError{err}
+	}
+	if err := validateNestedPosts(req.AddPosts); err != nil {
+		return models.User{}, nil, ValidationError{err}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		return models.User{}, nil, NotFoundError{"User not found"}
+	}
+
+	var posts []models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Name != "" {
+			if err := tx.Model(&user).Update("name", req.Name).Error; err != nil {
+				return err
+			}
+			if err := recordUserEvent(tx, webhooks.UserUpdated, user.ID); err != nil {
+				return err
+			}
+		}
+
+		if len(req.RemovePostIDs) > 0 {
+			removed := tx.Where("user_id = ? AND id IN ?", user.ID, req.RemovePostIDs).Delete(&models.Post{})
+			if removed.Error != nil {
+				return removed.Error
+			}
+			if removed.RowsAffected != int64(len(uniqueIDs(req.RemovePostIDs))) {
+				return ValidationError{errors.New("remove_post_ids contains posts that do not belong to this user")}
+			}
+			for _, id := range uniqueIDs(req.RemovePostIDs) {
+				if err := recordPostEvent(tx, webhooks.PostDeleted, id); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := createUserPosts(tx, user.ID, req.AddPosts); err != nil {
+			return err
+		}
+
+		return tx.Scopes(preloadPostRelations).Find(&posts, "user_id = ?", user.ID).Error
+	})
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	invalidateUsers(user.ID)
+	invalidatePosts(req.RemovePostIDs...)
+	return user, posts, nil
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"rest_api/config"
+	"rest_api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PostsBySlug godoc
+// @Summary Get a post by its slug
+// @Description Get a post by its current slug. A slug the post used before its title changed answers with 301 and the post's current slug in Location.
+// @Description Unpublished posts are only found by their author.
+// @Tags posts
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param slug path string true "Post slug"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Param format query string false "markdown (default), or html to add body_html and toc"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Param If-Modified-Since header string false "Last-Modified from a previous response"
+// @Success 200 {object} PostResponse "Post found"
+// @Success 301 "Former slug, see Location"
+// @Success 304 "Not modified"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/by-slug/{slug} [get]
+func PostsBySlug(c *gin.Context) {
+	format, err := bodyFormat(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	slug := c.Param("slug")
+	visible := VisibleScope(viewerID(c))
+
+	var post models.Post
+	if err := config.DB.Scopes(preloadPostRelations, visible).Where("slug = ?", slug).First(&post).Error; err == nil {
+		respondPost(c, post, format)
+		return
+	}
+
+	var former models.PostSlug
+	if err := config.DB.Where("slug = ?", slug).First(&former).Error; err == nil {
+		if err := config.DB.Scopes(visible).Select("id", "slug").First(&post, former.PostID).Error; err == nil && post.Slug != nil {
+			location := url.URL{Path: "/posts/by-slug/" + *post.Slug, RawQuery: c.Request.URL.RawQuery}
+			c.Redirect(http.StatusMovedPermanently, location.String())
+			return
+		}
+	}
+
+	c.Error(errors.New("Unable to find a post"))
+	c.Status(http.StatusNotFound)
+}
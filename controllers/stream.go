@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/poststream"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPostStreamBacklog   = 1000
+	defaultPostStreamBuffer    = 64
+	defaultPostStreamHeartbeat = 15 * time.Second
+
+	// PostEventRemoved is the stream event sent instead of an update that unpublished a post,
+	// to the clients that may no longer see it
+	PostEventRemoved = "post.removed"
+
+	// postEventPage is how many events are read from post_events at a time
+	postEventPage = 500
+	// postEventGapGrace is how long a poller waits for a skipped event ID to commit
+	postEventGapGrace = 10 * time.Second
+	// postEventPruneInterval is how often old events are deleted
+	postEventPruneInterval = time.Minute
+)
+
+func init() {
+	RegisterOutboxHandler("post_stream", appendPostEvent)
+}
+
+// appendPostEvent is the outbox handler that adds post events to post_events, where the stream
+// servers read them from
+func appendPostEvent(tx *gorm.DB, event models.OutboxEvent) error {
+	if event.AggregateType != models.AggregatePost {
+		return nil
+	}
+	var data postEventData
+	if err := json.Unmarshal([]byte(event.Payload), &data); err != nil {
+		return err
+	}
+	return tx.Create(&models.PostEvent{
+		Type:           event.Type,
+		PostID:         event.AggregateID,
+		UserID:         data.Post.UserID,
+		Status:         data.Post.Status,
+		PreviousStatus: data.PreviousStatus,
+		Payload:        event.Payload,
+	}).Error
+}
+
+// postStream hands the events this server reads from post_events to its stream clients
+var postStream = poststream.NewHub()
+
+// PollPostEvents publishes the events committed after cursor to the stream clients of this server,
+// and returns how many it published
+func PollPostEvents(cursor *poststream.Cursor) (int, error) {
+	published := 0
+	for {
+		query := config.DB.Where("id > ?", cursor.Last())
+		if gaps := cursor.Gaps(); len(gaps) > 0 {
+			query = config.DB.Where("id > ? OR id IN ?", cursor.Last(), gaps)
+		}
+		var events []models.PostEvent
+		if err := query.Order("id").Limit(postEventPage).Find(&events).Error; err != nil {
+			return published, err
+		}
+
+		ids := make([]uint64, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		cursor.Observe(ids, time.Now())
+		postStream.Publish(events...)
+		published += len(events)
+		if len(events) < postEventPage {
+			return published, nil
+		}
+	}
+}
+
+// prunePostEvents keeps the newest POST_STREAM_BACKLOG events, which is as far back as clients can resume
+func prunePostEvents() error {
+	backlog := config.GetEnvInt("POST_STREAM_BACKLOG", defaultPostStreamBacklog)
+	return config.DB.Where("id <= (SELECT MAX(id) FROM post_events) - ?", backlog).Delete(&models.PostEvent{}).Error
+}
+
+// postStreamWork wakes the post stream poller when this server's outbox relay added events, so it
+// does not wait for the next tick
+var postStreamWork = make(chan struct{}, 1)
+
+// notifyPostStream asks the poller to look for new post events
+func notifyPostStream() {
+	select {
+	case postStreamWork <- struct{}{}:
+	default:
+	}
+}
+
+// RunPostStream reads new post events every interval, and when this server's relay added some,
+// until ctx is done and hands them to this server's stream clients. Every server runs its own, so clients see changes made through any of them.
+func RunPostStream(ctx context.Context, interval time.Duration) {
+	var last uint64
+	if err := config.DB.Model(&models.PostEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		log.Println("stream: reading the latest post event failed:", err)
+	}
+	cursor := poststream.NewCursor(last, postEventGapGrace)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		if _, err := PollPostEvents(cursor); err != nil {
+			log.Println("stream: reading post events failed:", err)
+		}
+		if time.Since(pruned) >= postEventPruneInterval {
+			if err := prunePostEvents(); err != nil {
+				log.Println("stream: pruning post events failed:", err)
+			}
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-postStreamWork:
+		}
+	}
+}
+
+// streamFilter keeps the events a viewer may see: changes to published posts, to posts that stop
+// being published, and to the viewer's own posts in any status. A non-zero author keeps only that
+// user's posts.
+func streamFilter(viewer, author uint) func(models.PostEvent) bool {
+	return func(e models.PostEvent) bool {
+		if author != 0 && e.UserID != author {
+			return false
+		}
+		return e.Status == models.PostStatusPublished || e.PreviousStatus == models.PostStatusPublished ||
+			(viewer != 0 && e.UserID == viewer)
+	}
+}
+
+// PostRemovedEvent is the data of a post.removed stream event
+type PostRemovedEvent struct {
+	ID uint `json:"id" example:"1"`
+}
+
+// streamView returns e as viewer may see it. A post that stopped being published is only
+// announced as removed to viewers who can no longer see it, so they take it down.
+func streamView(e models.PostEvent, viewer uint) models.PostEvent {
+	if e.Status == models.PostStatusPublished || (viewer != 0 && e.UserID == viewer) {
+		return e
+	}
+	payload, _ := json.Marshal(PostRemovedEvent{ID: e.PostID})
+	e.Type, e.Payload = PostEventRemoved, string(payload)
+	return e
+}
+
+// lastEventID reads the Last-Event-ID header, or the last_event_id query parameter for clients
+// that cannot set headers. ok is false when neither is given.
+func lastEventID(c *gin.Context) (id uint64, ok bool, err error) {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("last_event_id")
+	}
+	if v == "" {
+		return 0, false, nil
+	}
+	id, err = strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("Invalid Last-Event-ID %q", v)
+	}
+	return id, true, nil
+}
+
+// writePostEvent sends e to the client as an SSE event named after its type
+func writePostEvent(c *gin.Context, e models.PostEvent) {
+	c.Render(-1, sse.Event{Id: strconv.FormatUint(e.ID, 10), Event: e.Type, Data: e.Payload})
+	c.Writer.Flush()
+}
+
+// PostsStream godoc
+// @Summary Stream post changes
+// @Description Server-Sent Events for posts being created, updated and deleted. Each event is named after its type, carries the post as
+// @Description GET /posts/:id shows it, and has an ID. Reconnect with Last-Event-ID to receive what was missed; a "reset" event means
+// @Description it was too far back and the client should reload. A "heartbeat" event is sent when nothing else is. Clients that fall
+// @Description behind are disconnected and should reconnect with Last-Event-ID, which EventSource does by itself. A published post that
+// @Description becomes a draft or is archived is sent as "post.removed" with only its ID to clients that can no longer see it.
+// @Tags posts
+// @Produce text/event-stream
+// @Param user_id query int false "Only posts by this user"
+// @Param Last-Event-ID header int false "ID of the last event received"
+// @Param last_event_id query int false "Same as Last-Event-ID, for clients that cannot set headers"
+// @Param X-User-ID header int false "Viewing user, who also sees changes to their own unpublished posts"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} map[string]string "Invalid user_id or Last-Event-ID"
+// @Router /posts/stream [get]
+func PostsStream(c *gin.Context) {
+	viewer := viewerID(c)
+	var author uint
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.Error(fmt.Errorf("Invalid user_id %q", v))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		author = uint(id)
+	}
+	resumeFrom, resume, err := lastEventID(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// subscribe before reading the backlog so that nothing committed in between is missed
+	match := streamFilter(viewer, author)
+	subscription := postStream.Subscribe(config.GetEnvInt("POST_STREAM_BUFFER", defaultPostStreamBuffer), match)
+	defer postStream.Unsubscribe(subscription)
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	replayed := map[uint64]bool{}
+	if resume {
+		var oldest uint64
+		if err := config.DB.Model(&models.PostEvent{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest).Error; err != nil {
+			log.Println("stream: reading the oldest post event failed:", err)
+			return
+		}
+		if oldest > resumeFrom+1 {
+			c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"reason": "Last-Event-ID is older than the retained events"}})
+		}
+		for after := resumeFrom; ; {
+			var events []models.PostEvent
+			if err := config.DB.Where("id > ?", after).Order("id").Limit(postEventPage).Find(&events).Error; err != nil {
+				log.Println("stream: reading post events failed:", err)
+				return
+			}
+			for _, e := range events {
+				if match(e) {
+					writePostEvent(c, streamView(e, viewer))
+					replayed[e.ID] = true
+				}
+				after = e.ID
+			}
+			if len(events) < postEventPage {
+				break
+			}
+		}
+	}
+
+	interval := config.GetEnvDuration("POST_STREAM_HEARTBEAT", defaultPostStreamHeartbeat)
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-subscription.Dropped:
+			// the client fell behind; ending the response makes it reconnect and resume
+			return
+		case e := <-subscription.Events:
+			if replayed[e.ID] {
+				delete(replayed, e.ID)
+				continue
+			}
+			writePostEvent(c, streamView(e, viewer))
+			heartbeat.Reset(interval)
+		case now := <-heartbeat.C:
+			c.Render(-1, sse.Event{Event: "heartbeat", Data: now.UTC().Format(time.RFC3339)})
+			c.Writer.Flush()
+		}
+	}
+}
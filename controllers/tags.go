@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rest_api/config"
+	"rest_api/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RenameTagRequest represents the request body for renaming a tag
+type RenameTagRequest struct {
+	Name string `json:"name" xml:"name" yaml:"name" binding:"required,max=100" example:"PostgreSQL"`
+}
+
+// MergeTagRequest represents the request body for merging a tag into another
+type MergeTagRequest struct {
+	Into string `json:"into" xml:"into" yaml:"into" binding:"required" example:"databases"`
+}
+
+// TagsResponse represents the response for listing tags or categories
+type TagsResponse struct {
+	Tags []models.JsonTag `json:"tags" xml:"tags>tag" yaml:"tags"`
+}
+
+// TagResponse represents the response for a single tag
+type TagResponse struct {
+	Tag models.JsonTag `json:"tag" xml:"tag" yaml:"tag"`
+}
+
+// upsertTags returns the tags named in names, creating the missing ones
+func upsertTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	return upsertByName(tx, names, func(name, slug string) models.Tag { return models.Tag{Name: name, Slug: slug} })
+}
+
+// upsertCategories returns the categories named in names, creating the missing ones
+func upsertCategories(tx *gorm.DB, names []string) ([]models.Category, error) {
+	return upsertByName(tx, names, func(name, slug string) models.Category { return models.Category{Name: name, Slug: slug} })
+}
+
+// upsertByName inserts a row per distinct slug, leaving existing rows (and their names) as they are
+func upsertByName[T any](tx *gorm.DB, names []string, build func(name, slug string) T) ([]T, error) {
+	if len(names) == 0 {
+		return []T{}, nil
+	}
+
+	rows := make([]T, 0, len(names))
+	slugs := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := models.Slugify(name)
+		if slug == "" {
+			return nil, ValidationError{fmt.Errorf("%q is not a valid name", name)}
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			rows = append(rows, build(name, slug))
+			slugs = append(slugs, slug)
+		}
+	}
+
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "slug"}}, DoNothing: true}).Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	var existing []T
+	if err := tx.Where("slug IN ?", slugs).Order("slug").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// preloadPostRelations loads the tags, categories and reaction counts that mapPost includes
+func preloadPostRelations(db *gorm.DB) *gorm.DB {
+	return db.Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("slug") }).
+		Preload("Categories", func(db *gorm.DB) *gorm.DB { return db.Order("slug") }).
+		Preload("ReactionCounts", func(db *gorm.DB) *gorm.DB { return db.Where("count > 0").Order("type") })
+}
+
+// TaxonomyScope keeps posts with the given tag and category slugs; empty slugs leave a filter out
+func TaxonomyScope(tag, category string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tag != "" {
+			db = db.Where("posts.id IN (?)", config.DB.Table("post_tags").Select("post_tags.post_id").
+				Joins("JOIN tags ON tags.id = post_tags.tag_id").Where("tags.slug = ?", tag))
+		}
+		if category != "" {
+			db = db.Where("posts.id IN (?)", config.DB.Table("post_categories").Select("post_categories.post_id").
+				Joins("JOIN categories ON categories.id = post_categories.category_id").Where("categories.slug = ?", category))
+		}
+		return db
+	}
+}
+
+// tagNames lists the names of tags in the order they were loaded
+func tagNames(tags []models.Tag) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// categoryNames lists the names of categories in the order they were loaded
+func categoryNames(categories []models.Category) []string {
+	if len(categories) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(categories))
+	for _, c := range categories {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// usageCounts lists every row of table with the number of published posts joined to it through joinTable
+func usageCounts(table, joinTable, foreignKey string) ([]models.JsonTag, error) {
+	var counts []models.JsonTag
+	err := config.DB.Table(table).
+		Select(table+".name, "+table+".slug, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN "+joinTable+" ON "+joinTable+"."+foreignKey+" = "+table+".id").
+		Joins("LEFT JOIN posts ON posts.id = "+joinTable+".post_id AND posts.deleted_at IS NULL AND posts.status = ?", models.PostStatusPublished).
+		Group(table + ".id").
+		Order("post_count DESC, " + table + ".slug").
+		Scan(&counts).Error
+	if counts == nil {
+		counts = []models.JsonTag{}
+	}
+	return counts, err
+}
+
+// mapTag converts DB model to API DTO, counting the published posts that carry the tag
+func mapTag(tag models.Tag) models.JsonTag {
+	var count int64
+	config.DB.Table("post_tags").Joins("JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL AND posts.status = ?", models.PostStatusPublished).
+		Where("post_tags.tag_id = ?", tag.ID).Count(&count)
+	return models.JsonTag{Name: tag.Name, Slug: tag.Slug, PostCount: int(count)}
+}
+
+// touchTaggedPosts bumps updated_at on the posts carrying tagID, since their representation changed
+func touchTaggedPosts(tx *gorm.DB, tagID uint) error {
+	return tx.Model(&models.Post{}).
+		Where("id IN (?)", tx.Table("post_tags").Select("post_id").Where("tag_id = ?", tagID)).
+		UpdateColumn("updated_at", time.Now()).Error
+}
+
+// TagsIndex godoc
+// @Summary List tags
+// @Description Get every tag with the number of posts using it, most used first
+// @Tags tags
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Success 200 {object} TagsResponse "Tags with usage counts"
+// @Router /tags [get]
+func TagsIndex(c *gin.Context) {
+	tags, err := usageCounts("tags", "post_tags", "tag_id")
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, 200, TagsResponse{Tags: tags})
+}
+
+// CategoriesIndex godoc
+// @Summary List categories
+// @Description Get every category with the number of posts in it, largest first
+// @Tags tags
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Success 200 {object} TagsResponse "Categories with usage counts"
+// @Router /categories [get]
+func CategoriesIndex(c *gin.Context) {
+	categories, err := usageCounts("categories", "post_categories", "category_id")
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, 200, TagsResponse{Tags: categories})
+}
+
+// TagPosts godoc
+// @Summary Get the posts with a tag
+// @Description Get all posts tagged with the given slug
+// @Tags tags
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Param slug path string true "Tag slug"
+// @Param X-User-ID header int false "Viewing user, who also sees their own unpublished posts"
+// @Param format query string false "markdown (default), or html to add body_html and toc"
+// @Success 200 {object} PostsResponse "Tagged posts"
+// @Failure 404 {object} map[string]string "Tag not found"
+// @Router /tags/{slug}/posts [get]
+func TagPosts(c *gin.Context) {
+	format, err := bodyFormat(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var tag models.Tag
+	result := config.DB.Where("slug = ?", c.Param("slug")).First(&tag)
+
+	if result.Error != nil {
+		c.Error(errors.New("Tag not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	var posts []models.Post
+	config.DB.Scopes(preloadPostRelations, TaxonomyScope(tag.Slug, ""), VisibleScope(viewerID(c))).Order("id").Find(&posts)
+
+	dto := mapPosts(posts)
+	if err := renderBodies(format, dto); err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, 200, PostsResponse{Posts: dto})
+}
+
+// TagsRename godoc
+// @Summary Rename a tag
+// @Description Change a tag's name and slug. Fails with 409 if another tag already has the new slug; merge the tags instead. Admin only.
+// @Tags tags
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param slug path string true "Tag slug"
+// @Param tag body RenameTagRequest true "New name"
+// @Success 200 {object} TagResponse "Tag renamed"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Tag not found"
+// @Failure 409 {object} map[string]string "Slug already taken"
+// @Router /tags/{slug} [patch]
+func TagsRename(c *gin.Context) {
+	var body RenameTagRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	slug := models.Slugify(body.Name)
+	if slug == "" {
+		c.Error(fmt.Errorf("%q is not a valid name", body.Name))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var tag models.Tag
+	result := config.DB.Where("slug = ?", c.Param("slug")).First(&tag)
+
+	if result.Error != nil {
+		c.Error(errors.New("Tag not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if slug != tag.Slug {
+		var taken int64
+		config.DB.Model(&models.Tag{}).Where("slug = ?", slug).Count(&taken)
+		if taken > 0 {
+			c.Error(fmt.Errorf("Tag %q already exists, merge into it instead", slug))
+			c.Status(http.StatusConflict)
+			return
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&tag).Updates(map[string]any{"name": body.Name, "slug": slug}).Error; err != nil {
+			return err
+		}
+		if err := touchTaggedPosts(tx, tag.ID); err != nil {
+			return err
+		}
+		// every post with the tag shows its new name, on every server
+		return notifyAllPostsUpdated(tx)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	postLookups().InvalidateAll(c.Request.Context())
+
+	respond(c, 200, TagResponse{Tag: mapTag(tag)})
+}
+
+// TagsMerge godoc
+// @Summary Merge a tag into another
+// @Description Move every post from the tag in the path to the "into" tag and delete the merged tag. Admin only.
+// @Tags tags
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param slug path string true "Slug of the tag to merge away"
+// @Param merge body MergeTagRequest true "Slug of the tag to keep"
+// @Success 200 {object} TagResponse "The remaining tag"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Tag not found"
+// @Router /tags/{slug}/merge [post]
+func TagsMerge(c *gin.Context) {
+	var body MergeTagRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var source, target models.Tag
+	if config.DB.Where("slug = ?", c.Param("slug")).First(&source).Error != nil ||
+		config.DB.Where("slug = ?", body.Into).First(&target).Error != nil {
+		c.Error(errors.New("Tag not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if source.ID == target.ID {
+		c.Error(errors.New("Cannot merge a tag into itself"))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchTaggedPosts(tx, source.ID); err != nil {
+			return err
+		}
+		moved := tx.Exec(`INSERT INTO post_tags (post_id, tag_id)
+			SELECT post_id, ? FROM post_tags WHERE tag_id = ?
+			ON CONFLICT DO NOTHING`, target.ID, source.ID)
+		if moved.Error != nil {
+			return moved.Error
+		}
+		if err := tx.Exec("DELETE FROM post_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&source).Error; err != nil {
+			return err
+		}
+		return notifyAllPostsUpdated(tx)
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	postLookups().InvalidateAll(c.Request.Context())
+
+	respond(c, 200, TagResponse{Tag: mapTag(target)})
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/thumbnail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultAttachmentMaxPixels = 40_000_000
+	blurhashXComponents        = 4
+	blurhashYComponents        = 3
+)
+
+// attachmentWork wakes the attachment worker when an image is uploaded, so variants do not wait
+// for the next tick. It holds one signal; more uploads before the worker runs need no more.
+var attachmentWork = make(chan struct{}, 1)
+
+// notifyAttachmentWorker asks the worker to look for pending images
+func notifyAttachmentWorker() {
+	select {
+	case attachmentWork <- struct{}{}:
+	default:
+	}
+}
+
+// badImageError marks an attachment that cannot be decoded, as opposed to a failure that is worth retrying
+type badImageError struct {
+	Err error
+}
+
+func (e badImageError) Error() string { return e.Err.Error() }
+
+func (e badImageError) Unwrap() error { return e.Err }
+
+// ProcessPendingAttachments makes the variants of pending images, one at a time and oldest first,
+// and returns how many it processed. Each image is locked while it is processed and locked rows
+// are skipped, so several servers can run the worker at the same time. Images that cannot be
+// decoded are marked failed; other errors leave the image pending for the next run.
+func ProcessPendingAttachments(ctx context.Context) (int, error) {
+	processed := 0
+	for ctx.Err() == nil {
+		found := false
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var attachment models.Attachment
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("variants_status = ?", models.VariantsPending).Order("id").First(&attachment).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+
+			err = tx.Transaction(func(tx *gorm.DB) error {
+				return makeVariants(ctx, tx, &attachment)
+			})
+			var bad badImageError
+			if errors.As(err, &bad) {
+				log.Printf("attachments: attachment %d has no variants: %v", attachment.ID, err)
+				return tx.Model(&attachment).Update("variants_status", models.VariantsFailed).Error
+			}
+			return err
+		})
+		if err != nil || !found {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, ctx.Err()
+}
+
+// makeVariants stores a resized copy of the attachment for every thumbnail spec and records the
+// image's dimensions, blurhash and average color
+func makeVariants(ctx context.Context, tx *gorm.DB, attachment *models.Attachment) error {
+	blob, err := blobStore().Open(ctx, attachment.Key)
+	if err != nil {
+		return err
+	}
+	img, err := thumbnail.Load(blob, config.GetEnvInt("ATTACHMENT_MAX_PIXELS", defaultAttachmentMaxPixels))
+	blob.Close()
+	if err != nil {
+		return badImageError{err}
+	}
+
+	stem := strings.TrimSuffix(attachment.Key, keyExtension(attachment.Key))
+	thumb := img.RGBA
+	for i, spec := range thumbnail.Specs {
+		resized := thumbnail.Resize(img.RGBA, spec.MaxSide)
+		if i == 0 {
+			thumb = resized
+		}
+
+		var buf bytes.Buffer
+		contentType, extension, err := thumbnail.Encode(&buf, resized, img.Format)
+		if err != nil {
+			return err
+		}
+		variant := models.AttachmentVariant{
+			AttachmentID: attachment.ID,
+			Name:         spec.Name,
+			Key:          stem + "-" + spec.Name + extension,
+			ContentType:  contentType,
+			Width:        resized.Bounds().Dx(),
+			Height:       resized.Bounds().Dy(),
+			Size:         int64(buf.Len()),
+		}
+		if err := blobStore().Put(ctx, variant.Key, &buf, variant.Size, contentType); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&variant).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(attachment).Updates(map[string]any{
+		"width":           img.Width(),
+		"height":          img.Height(),
+		"blurhash":        thumbnail.Blurhash(thumb, blurhashXComponents, blurhashYComponents),
+		"average_color":   thumbnail.AverageColor(thumb),
+		"variants_status": models.VariantsReady,
+	}).Error
+}
+
+// keyExtension returns the extension of the last segment of a blob key, including the dot
+func keyExtension(key string) string {
+	name := key[strings.LastIndexByte(key, '/')+1:]
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		return name[i:]
+	}
+	return ""
+}
+
+// RunAttachmentWorker makes the variants of pending images until ctx is done. It runs when an
+// image is uploaded, every interval and once straight away, so images left pending by a restart
+// are picked up.
+func RunAttachmentWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := ProcessPendingAttachments(ctx); err != nil && ctx.Err() == nil {
+			log.Println("attachments: processing pending images failed:", err)
+		} else if n > 0 {
+			log.Printf("attachments: made variants of %d images", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-attachmentWork:
+		}
+	}
+}
+
+// variantURL is where a variant of an attachment is downloaded from
+func variantURL(attachmentID uint, name string) string {
+	return fmt.Sprintf("/attachments/%d?variant=%s", attachmentID, name)
+}
@@ -0,0 +1,650 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/webhooks"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookRetryBase   = 30 * time.Second
+	defaultWebhookRetryMax    = time.Hour
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookConcurrency = 4
+
+	// webhookLeaseMargin is how long past WEBHOOK_TIMEOUT a claimed delivery stays with its worker
+	webhookLeaseMargin = 30 * time.Second
+
+	// webhookErrorLength is how much of a failure is kept in the delivery log
+	webhookErrorLength = 1000
+)
+
+// CreateWebhookRequest represents the request body for subscribing to webhooks
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" xml:"url" yaml:"url" binding:"required,url,max=2048" example:"https://example.com/hooks/posts"`
+	Events []string `json:"events" xml:"events>event" yaml:"events" binding:"required,min=1,dive,oneof=post.created post.updated post.deleted user.created user.updated" example:"post.created,post.updated"`
+	// Secret signs the deliveries; one is generated when it is left out
+	Secret string `json:"secret" xml:"secret" yaml:"secret" binding:"omitempty,min=16,max=255" example:"a-long-random-string"`
+	Active *bool  `json:"active" xml:"active" yaml:"active" example:"true"`
+}
+
+// UpdateWebhookRequest represents the request body for changing a webhook subscription
+type UpdateWebhookRequest struct {
+	URL    string   `json:"url" xml:"url" yaml:"url" binding:"omitempty,url,max=2048" example:"https://example.com/hooks/posts"`
+	Events []string `json:"events" xml:"events>event" yaml:"events" binding:"omitempty,min=1,dive,oneof=post.created post.updated post.deleted user.created user.updated" example:"post.deleted"`
+	Secret string   `json:"secret" xml:"secret" yaml:"secret" binding:"omitempty,min=16,max=255" example:"a-new-long-random-string"`
+	Active *bool    `json:"active" xml:"active" yaml:"active" example:"false"`
+}
+
+// WebhooksResponse represents the response for listing webhook subscriptions
+type WebhooksResponse struct {
+	Webhooks []models.JsonWebhookSubscription `json:"webhooks" xml:"webhooks>webhook" yaml:"webhooks"`
+}
+
+// WebhookResponse represents the response for a single webhook subscription
+type WebhookResponse struct {
+	Webhook models.JsonWebhookSubscription `json:"webhook" xml:"webhook" yaml:"webhook"`
+}
+
+// WebhookDeliveriesResponse represents a page of a subscription's delivery log
+type WebhookDeliveriesResponse struct {
+	Deliveries []models.JsonWebhookDelivery `json:"deliveries" xml:"deliveries>delivery" yaml:"deliveries"`
+	NextCursor string                       `json:"next_cursor,omitempty" xml:"next_cursor,omitempty" yaml:"next_cursor,omitempty" example:"MTcwMDAwMDAwMDAwMDAwMDAwMDoxMg"`
+}
+
+// WebhookDeliveryResponse represents the response for a single delivery
+type WebhookDeliveryResponse struct {
+	Delivery models.JsonWebhookDelivery `json:"delivery" xml:"delivery" yaml:"delivery"`
+}
+
+// webhookEvent is the JSON body of every delivery
+type webhookEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+// mapWebhook converts DB model to API DTO, leaving the secret out
+func mapWebhook(m models.WebhookSubscription) models.JsonWebhookSubscription {
+	return models.JsonWebhookSubscription{
+		ID:        m.ID,
+		URL:       m.URL,
+		Events:    strings.Split(m.Events, ","),
+		Active:    m.Active,
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: m.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// mapWebhookDelivery converts DB model to API DTO
+func mapWebhookDelivery(m models.WebhookDelivery) models.JsonWebhookDelivery {
+	formatTime := func(t *time.Time) *string {
+		if t == nil {
+			return nil
+		}
+		s := t.Format(time.RFC3339)
+		return &s
+	}
+	dto := models.JsonWebhookDelivery{
+		ID:             m.ID,
+		SubscriptionID: m.SubscriptionID,
+		EventID:        m.EventID,
+		EventType:      m.EventType,
+		Status:         m.Status,
+		Attempts:       m.Attempts,
+		LastAttemptAt:  formatTime(m.LastAttemptAt),
+		ResponseStatus: m.ResponseStatus,
+		LastError:      m.LastError,
+		DeliveredAt:    formatTime(m.DeliveredAt),
+		Payload:        m.Payload,
+		CreatedAt:      m.CreatedAt.Format(time.RFC3339),
+	}
+	if m.Status == models.DeliveryPending {
+		dto.NextAttemptAt = formatTime(&m.NextAttemptAt)
+	}
+	return dto
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func init() {
+	RegisterOutboxHandler("webhooks", queueWebhookDeliveries)
+}
+
+// queueWebhookDeliveries is the outbox handler that queues a delivery of the event to every active
+// subscription that wants it. The delivery carries the outbox event's ID, so receivers can tell
+// a retry from a new event.
+func queueWebhookDeliveries(tx *gorm.DB, event models.OutboxEvent) error {
+	var subscriptions []models.WebhookSubscription
+	err := tx.Where("active AND ? = ANY(string_to_array(events, ','))", event.Type).Order("id").Find(&subscriptions).Error
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	id := strconv.FormatUint(event.ID, 10)
+	body, err := json.Marshal(webhookEvent{
+		ID:        id,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt.Format(time.RFC3339),
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventID:        id,
+			EventType:      event.Type,
+			Payload:        string(body),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	return tx.Create(&deliveries).Error
+}
+
+// webhookWork wakes the webhook worker when a delivery is redelivered, so it does not wait for
+// the next tick
+var webhookWork = make(chan struct{}, 1)
+
+// notifyWebhookWorker asks the worker to look for due deliveries
+func notifyWebhookWorker() {
+	select {
+	case webhookWork <- struct{}{}:
+	default:
+	}
+}
+
+// webhookClient sends deliveries. Redirects are not followed: a receiver that moved should have
+// its subscription updated.
+var webhookClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// DeliverDueWebhooks sends every pending delivery of an active subscription whose next attempt is
+// due, oldest first, and returns how many attempts it made. A delivery is claimed in a short
+// transaction that moves its next attempt past the time sending can take, then sent with no
+// transaction open, and its outcome recorded unless someone claimed or redelivered it meanwhile.
+// Claimed deliveries are not due, so several workers and servers can send at the same time.
+func DeliverDueWebhooks(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		delivery, subscription, lease, err := claimWebhookDelivery()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return attempted, nil
+		}
+		if err != nil {
+			return attempted, err
+		}
+
+		status, err := sendWebhook(ctx, subscription, delivery)
+		updates := deliveryOutcome(delivery, status, err, time.Now())
+		if ctx.Err() != nil {
+			// shutting down: hand the delivery back rather than count an attempt
+			updates = map[string]any{"next_attempt_at": delivery.NextAttemptAt}
+		}
+		err = config.DB.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.DeliveryPending, lease).
+			Updates(updates).Error
+		if err != nil {
+			return attempted, err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		attempted++
+	}
+	return attempted, ctx.Err()
+}
+
+// claimWebhookDelivery takes the oldest due delivery by moving its next attempt to the returned
+// lease, which is when another worker may take it over if this one never records an outcome
+func claimWebhookDelivery() (models.WebhookDelivery, models.WebhookSubscription, time.Time, error) {
+	var delivery models.WebhookDelivery
+	var subscription models.WebhookSubscription
+	// Postgres keeps microseconds, and the lease is matched exactly when the outcome is recorded
+	lease := time.Now().Add(config.GetEnvDuration("WEBHOOK_TIMEOUT", defaultWebhookTimeout) + webhookLeaseMargin).
+		Truncate(time.Microsecond)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Where("subscription_id IN (?)", tx.Model(&models.WebhookSubscription{}).Where("active").Select("id")).
+			Order("next_attempt_at, id").First(&delivery).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&subscription, delivery.SubscriptionID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Update("next_attempt_at", lease).Error
+	})
+	return delivery, subscription, lease, err
+}
+
+// deliveryOutcome returns the updates that record an attempt at delivery ending with the given
+// response status and error
+func deliveryOutcome(delivery models.WebhookDelivery, status int, err error, now time.Time) map[string]any {
+	attempts := delivery.Attempts + 1
+	updates := map[string]any{"attempts": attempts, "last_attempt_at": now, "response_status": status}
+	switch {
+	case err == nil:
+		updates["status"] = models.DeliveryDelivered
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case attempts >= config.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts):
+		updates["status"] = models.DeliveryDead
+		updates["last_error"] = truncate(err.Error(), webhookErrorLength)
+	default:
+		wait := webhooks.Backoff(attempts,
+			config.GetEnvDuration("WEBHOOK_RETRY_BASE", defaultWebhookRetryBase),
+			config.GetEnvDuration("WEBHOOK_RETRY_MAX", defaultWebhookRetryMax))
+		updates["next_attempt_at"] = now.Add(wait)
+		updates["last_error"] = truncate(err.Error(), webhookErrorLength)
+	}
+	return updates
+}
+
+// sendWebhook POSTs the delivery's payload to the subscription and returns the response status.
+// Anything but a 2xx response is an error.
+func sendWebhook(ctx context.Context, subscription models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetEnvDuration("WEBHOOK_TIMEOUT", defaultWebhookTimeout))
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rest_api-webhooks/1")
+	req.Header.Set(webhooks.HeaderEvent, delivery.EventType)
+	req.Header.Set(webhooks.HeaderID, delivery.EventID)
+	req.Header.Set(webhooks.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhooks.HeaderSignature, webhooks.Sign(subscription.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// read a little of the body so the connection can be reused; receivers should answer quickly
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// RunWebhookWorker sends due deliveries until ctx is done. It runs every interval, when a delivery
+// is redelivered and once straight away, so deliveries left pending by a restart are sent. Up to
+// WEBHOOK_CONCURRENCY deliveries are sent at once, so one slow receiver does not hold up the rest.
+func RunWebhookWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	concurrency := max(config.GetEnvInt("WEBHOOK_CONCURRENCY", defaultWebhookConcurrency), 1)
+	for {
+		var wg sync.WaitGroup
+		var attempted atomic.Int64
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n, err := DeliverDueWebhooks(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Println("webhooks: delivering failed:", err)
+				}
+				attempted.Add(int64(n))
+			}()
+		}
+		wg.Wait()
+		if n := attempted.Load(); n > 0 {
+			log.Printf("webhooks: made %d delivery attempts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWork:
+		}
+	}
+}
+
+// validWebhookURL checks that deliveries to u can be attempted
+func validWebhookURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("Invalid url %q, expected an http or https URL", u)
+	}
+	return nil
+}
+
+// findWebhook loads the subscription from the path, writing the error response on failure
+func findWebhook(c *gin.Context) (models.WebhookSubscription, bool) {
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, c.Param("id")).Error; err != nil {
+		c.Error(errors.New("Webhook not found"))
+		c.Status(http.StatusNotFound)
+		return models.WebhookSubscription{}, false
+	}
+	return subscription, true
+}
+
+// WebhooksIndex godoc
+// @Summary List webhook subscriptions
+// @Description Admin only.
+// @Tags webhooks
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Success 200 {object} WebhooksResponse "Subscriptions, oldest first"
+// @Router /webhooks [get]
+func WebhooksIndex(c *gin.Context) {
+	var subscriptions []models.WebhookSubscription
+	config.DB.Order("id").Find(&subscriptions)
+
+	dto := make([]models.JsonWebhookSubscription, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		dto = append(dto, mapWebhook(s))
+	}
+	respond(c, 200, WebhooksResponse{Webhooks: dto})
+}
+
+// WebhooksCreate godoc
+// @Summary Subscribe to webhooks
+// @Description Events of the listed types are POSTed to url, signed with secret. The response is the only one that shows the secret. Admin only.
+// @Tags webhooks
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param webhook body CreateWebhookRequest true "Subscription"
+// @Success 200 {object} WebhookResponse "Subscription, with its secret"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Router /webhooks [post]
+func WebhooksCreate(c *gin.Context) {
+	var body CreateWebhookRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if err := validWebhookURL(body.URL); err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if body.Secret == "" {
+		if body.Secret, err = randomHex(32); err != nil {
+			c.Error(err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+	subscription := models.WebhookSubscription{
+		URL:    body.URL,
+		Secret: body.Secret,
+		Events: strings.Join(body.Events, ","),
+		Active: body.Active == nil || *body.Active,
+	}
+	if err := config.DB.Create(&subscription).Error; err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	dto := mapWebhook(subscription)
+	dto.Secret = subscription.Secret
+	respond(c, 200, WebhookResponse{Webhook: dto})
+}
+
+// WebhooksShow godoc
+// @Summary Get a webhook subscription
+// @Description Admin only.
+// @Tags webhooks
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} WebhookResponse "Subscription"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /webhooks/{id} [get]
+func WebhooksShow(c *gin.Context) {
+	subscription, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	respond(c, 200, WebhookResponse{Webhook: mapWebhook(subscription)})
+}
+
+// WebhooksUpdate godoc
+// @Summary Change a webhook subscription
+// @Description Change the url, events or secret, or pause the subscription with "active": false. Deliveries of a paused
+// @Description subscription wait until it is active again. A new secret is shown in the response. Admin only.
+// @Tags webhooks
+// @Accept json,xml,application/x-yaml,application/x-msgpack
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Param webhook body UpdateWebhookRequest true "Fields to change"
+// @Success 200 {object} WebhookResponse "Subscription"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /webhooks/{id} [patch]
+func WebhooksUpdate(c *gin.Context) {
+	var body UpdateWebhookRequest
+	err := c.Bind(&body)
+	if err != nil {
+		c.Error(errors.New(err.Error()))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if body.URL != "" {
+		if err := validWebhookURL(body.URL); err != nil {
+			c.Error(err)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+	}
+
+	subscription, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]any{}
+	if body.URL != "" {
+		updates["url"] = body.URL
+	}
+	if body.Events != nil {
+		updates["events"] = strings.Join(body.Events, ",")
+	}
+	if body.Secret != "" {
+		updates["secret"] = body.Secret
+	}
+	if body.Active != nil {
+		updates["active"] = *body.Active
+	}
+	if len(updates) > 0 {
+		if err := config.DB.Model(&subscription).Updates(updates).Error; err != nil {
+			c.Error(err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+	if body.Active != nil && *body.Active {
+		notifyWebhookWorker()
+	}
+
+	dto := mapWebhook(subscription)
+	if body.Secret != "" {
+		dto.Secret = body.Secret
+	}
+	respond(c, 200, WebhookResponse{Webhook: dto})
+}
+
+// WebhooksDelete godoc
+// @Summary Delete a webhook subscription
+// @Description Delete the subscription and its delivery log. Pending deliveries are dropped. Admin only.
+// @Tags webhooks
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} WebhookResponse "Deleted subscription"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /webhooks/{id} [delete]
+func WebhooksDelete(c *gin.Context) {
+	subscription, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&subscription).Error
+	})
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, 200, WebhookResponse{Webhook: mapWebhook(subscription)})
+}
+
+// WebhookDeliveriesIndex godoc
+// @Summary List a webhook subscription's deliveries
+// @Description The delivery log, newest first, with cursor pagination. Admin only.
+// @Tags webhooks
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Param status query string false "Only deliveries in this status" Enums(pending, delivered, dead)
+// @Param limit query int false "Page size, 1 to 100 (default 20)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} WebhookDeliveriesResponse "Deliveries page"
+// @Failure 400 {object} map[string]string "Invalid status, limit or cursor"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /webhooks/{id}/deliveries [get]
+func WebhookDeliveriesIndex(c *gin.Context) {
+	limit, cursor, err := pageParams(c)
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		c.Error(fmt.Errorf("Invalid status %q, expected pending, delivered or dead", status))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	subscription, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	query := config.DB.Where("subscription_id = ?", subscription.ID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []models.WebhookDelivery
+	query.Scopes(keysetPage("created_at", "id", limit, cursor)).Find(&deliveries)
+
+	resp := WebhookDeliveriesResponse{}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		last := deliveries[limit-1]
+		resp.NextCursor = pageCursor{At: last.CreatedAt, ID: last.ID}.String()
+	}
+	resp.Deliveries = make([]models.JsonWebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, mapWebhookDelivery(d))
+	}
+	respond(c, 200, resp)
+}
+
+// WebhookDeliveriesRedeliver godoc
+// @Summary Send a delivery again
+// @Description Queue the delivery to be sent again straight away with the same payload and a fresh set of attempts, whatever its status. Admin only.
+// @Tags webhooks
+// @Produce json,xml,application/x-yaml,application/x-msgpack
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 200 {object} WebhookDeliveryResponse "Queued delivery"
+// @Failure 404 {object} map[string]string "Webhook or delivery not found"
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func WebhookDeliveriesRedeliver(c *gin.Context) {
+	subscription, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	if err := config.DB.Where("subscription_id = ?", subscription.ID).First(&delivery, c.Param("delivery_id")).Error; err != nil {
+		c.Error(errors.New("Delivery not found"))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	err := config.DB.Model(&delivery).Updates(map[string]any{
+		"status":          models.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error
+	if err != nil {
+		c.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	notifyWebhookWorker()
+
+	respond(c, 200, WebhookDeliveryResponse{Delivery: mapWebhookDelivery(delivery)})
+}
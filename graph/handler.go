@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"rest_api/config"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is a GraphQL request, sent as a JSON body or, for queries, as GET parameters
+type Request struct {
+	Query         string         `json:"query" form:"query"`
+	OperationName string         `json:"operationName" form:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Handler godoc
+// @Summary GraphQL endpoint
+// @Description Execute a GraphQL query or mutation over users and posts. Browsers opening GET /graphql get a GraphiQL playground.
+// @Description Queries deeper than GRAPHQL_MAX_DEPTH or more complex than GRAPHQL_MAX_COMPLEXITY are rejected before they run.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body Request true "GraphQL request"
+// @Success 200 {object} map[string]interface{} "data and errors"
+// @Failure 400 {object} map[string]interface{} "Unparseable, invalid or too expensive query"
+// @Router /graphql [post]
+func Handler(c *gin.Context) {
+	var req Request
+	if c.Request.Method == http.MethodGet {
+		if c.Query("query") == "" && strings.Contains(c.GetHeader("Accept"), "text/html") {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(playgroundHTML))
+			return
+		}
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if vars := c.Query("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeErrors(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		writeErrors(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		writeErrors(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+		return
+	}
+	if validation := graphql.ValidateDocument(&Schema, doc, nil); !validation.IsValid {
+		writeErrors(c, http.StatusBadRequest, validation.Errors)
+		return
+	}
+	if c.Request.Method == http.MethodGet && hasMutation(doc) {
+		writeErrors(c, http.StatusMethodNotAllowed, gqlerrors.FormatErrors(gqlerrors.NewFormattedError("Mutations must be sent with POST")))
+		return
+	}
+	maxDepth := config.GetEnvInt("GRAPHQL_MAX_DEPTH", defaultMaxDepth)
+	maxComplexity := config.GetEnvInt("GRAPHQL_MAX_COMPLEXITY", defaultMaxComplexity)
+	if err := checkLimits(&Schema, doc, req.Variables, maxDepth, maxComplexity); err != nil {
+		writeErrors(c, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        Schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoaders(c.Request.Context(), newLoaders(config.DB)),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+func writeErrors(c *gin.Context, code int, errs []gqlerrors.FormattedError) {
+	c.JSON(code, graphql.Result{Errors: errs})
+}
+
+func hasMutation(doc *ast.Document) bool {
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok && op.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	defaultMaxDepth      = 8
+	defaultMaxComplexity = 1000
+)
+
+// queryLimits measures an already validated document before it is executed. Depth counts nested
+// field levels. Complexity counts every field once, with the selections under a paginated list
+// multiplied by its "first" argument, so it approximates the number of objects a query can return.
+// Introspection fields are not counted, so the playground's schema query is always allowed.
+type queryLimits struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// checkLimits returns an error for the first operation in doc that exceeds maxDepth or maxComplexity
+func checkLimits(schema *graphql.Schema, doc *ast.Document, variables map[string]any, maxDepth, maxComplexity int) error {
+	l := queryLimits{schema: schema, fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			l.fragments[frag.Name.Value] = frag
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		root := schema.QueryType()
+		if op.Operation == ast.OperationTypeMutation {
+			root = schema.MutationType()
+		}
+
+		depth, complexity := l.measure(root, op.SelectionSet)
+		if depth > maxDepth {
+			return gqlerrors.NewFormattedError(fmt.Sprintf("Query depth %d exceeds the maximum of %d", depth, maxDepth))
+		}
+		if complexity > maxComplexity {
+			return gqlerrors.NewFormattedError(fmt.Sprintf("Query complexity %d exceeds the maximum of %d", complexity, maxComplexity))
+		}
+	}
+	return nil
+}
+
+// measure returns the depth and complexity of a selection set on parent
+func (l *queryLimits) measure(parent *graphql.Object, set *ast.SelectionSet) (int, int) {
+	if set == nil || parent == nil {
+		return 0, 0
+	}
+
+	depth, complexity := 0, 0
+	for _, sel := range set.Selections {
+		var d, c int
+		switch sel := sel.(type) {
+		case *ast.Field:
+			d, c = l.measureField(parent, sel)
+		case *ast.InlineFragment:
+			d, c = l.measure(l.conditionType(parent, sel.TypeCondition), sel.SelectionSet)
+		case *ast.FragmentSpread:
+			if frag, ok := l.fragments[sel.Name.Value]; ok {
+				d, c = l.measure(l.conditionType(parent, frag.TypeCondition), frag.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (l *queryLimits) measureField(parent *graphql.Object, field *ast.Field) (int, int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+	def, ok := parent.Fields()[field.Name.Value]
+	if !ok {
+		return 1, 1
+	}
+
+	child, _ := graphql.GetNamed(def.Type).(*graphql.Object)
+	depth, complexity := l.measure(child, field.SelectionSet)
+	return depth + 1, 1 + complexity*l.multiplier(def, field)
+}
+
+// multiplier is the page size requested from a list field, or 1 for other fields
+func (l *queryLimits) multiplier(def *graphql.FieldDefinition, field *ast.Field) int {
+	for _, arg := range def.Args {
+		if arg.Name() != "first" {
+			continue
+		}
+		first, _ := arg.DefaultValue.(int)
+		for _, a := range field.Arguments {
+			if a.Name.Value == "first" {
+				first = l.intValue(a.Value, first)
+			}
+		}
+		return max(first, 1)
+	}
+	return 1
+}
+
+// intValue reads an Int literal or variable, falling back to def
+func (l *queryLimits) intValue(v ast.Value, def int) int {
+	switch v := v.(type) {
+	case *ast.IntValue:
+		if n, err := strconv.Atoi(v.Value); err == nil {
+			return n
+		}
+	case *ast.Variable:
+		switch n := l.variables[v.Name.Value].(type) {
+		case int:
+			return n
+		case float64:
+			return int(n)
+		}
+	}
+	return def
+}
+
+// conditionType resolves a fragment's type condition, defaulting to the enclosing type
+func (l *queryLimits) conditionType(parent *graphql.Object, cond *ast.Named) *graphql.Object {
+	if cond == nil {
+		return parent
+	}
+	if obj, ok := l.schema.Type(cond.Name.Value).(*graphql.Object); ok {
+		return obj
+	}
+	return parent
+}
@@ -0,0 +1,133 @@
+package graph
+
+import (
+	"context"
+	"rest_api/models"
+
+	"gorm.io/gorm"
+)
+
+// loader batches lookups made while resolving one level of a query. load queues a key and returns a
+// thunk; graphql-go resolves thunks breadth-first, so every key queued at a level is fetched by the
+// first thunk that runs, in a single query. A loader belongs to one request and is not shared between
+// goroutines (graphql-go resolves fields serially).
+type loader[K comparable, V any] struct {
+	fetch   func(keys []K) (map[K]V, error)
+	pending []K
+	queued  map[K]bool
+	done    map[K]V
+	failed  map[K]error
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, queued: map[K]bool{}, done: map[K]V{}, failed: map[K]error{}}
+}
+
+func (l *loader[K, V]) load(key K) func() (any, error) {
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	return func() (any, error) {
+		if _, ok := l.done[key]; !ok && l.failed[key] == nil {
+			l.dispatch()
+		}
+		if err := l.failed[key]; err != nil {
+			return nil, err
+		}
+		return l.done[key], nil
+	}
+}
+
+// dispatch fetches every pending key; keys the fetch does not return resolve to the zero value
+func (l *loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.failed[key] = err
+		} else {
+			l.done[key] = values[key]
+		}
+	}
+}
+
+// userPostsKey identifies one page of a user's posts
+type userPostsKey struct {
+	UserID uint
+	First  int
+	Offset int
+}
+
+// loaders holds the per-request batch loaders
+type loaders struct {
+	users     *loader[uint, *models.User]
+	userPosts *loader[userPostsKey, []models.Post]
+}
+
+type loadersKey struct{}
+
+func newLoaders(db *gorm.DB) *loaders {
+	return &loaders{
+		users:     newLoader(func(ids []uint) (map[uint]*models.User, error) { return fetchUsers(db, ids) }),
+		userPosts: newLoader(func(keys []userPostsKey) (map[userPostsKey][]models.Post, error) { return fetchUserPosts(db, keys) }),
+	}
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// fetchUsers loads users by ID with one query
+func fetchUsers(db *gorm.DB, ids []uint) (map[uint]*models.User, error) {
+	var users []models.User
+	if err := db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+	return byID, nil
+}
+
+// fetchUserPosts loads the requested page of posts, newest first, for every user. Keys asking for the
+// same page share one query that numbers each user's posts with a window function.
+func fetchUserPosts(db *gorm.DB, keys []userPostsKey) (map[userPostsKey][]models.Post, error) {
+	pages := map[[2]int][]uint{}
+	for _, key := range keys {
+		page := [2]int{key.First, key.Offset}
+		pages[page] = append(pages[page], key.UserID)
+	}
+
+	byKey := make(map[userPostsKey][]models.Post, len(keys))
+	for page, userIDs := range pages {
+		first, offset := page[0], page[1]
+
+		var posts []models.Post
+		err := db.Raw(`SELECT * FROM (
+				SELECT posts.*, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS row_num
+				FROM posts WHERE user_id IN ? AND deleted_at IS NULL AND status = 'published'
+			) ranked WHERE row_num > ? AND row_num <= ? ORDER BY user_id, row_num`,
+			userIDs, offset, offset+first).Scan(&posts).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, userID := range userIDs {
+			byKey[userPostsKey{UserID: userID, First: first, Offset: offset}] = []models.Post{}
+		}
+		for _, post := range posts {
+			key := userPostsKey{UserID: post.UserID, First: first, Offset: offset}
+			byKey[key] = append(byKey[key], post)
+		}
+	}
+	return byKey, nil
+}
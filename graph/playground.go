@@ -0,0 +1,29 @@
+package graph
+
+// playgroundHTML is a GraphiQL page pointed at /graphql. GraphiQL loads the schema through
+// introspection, which gives the editor completion and the documentation explorer.
+const playgroundHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>GraphQL playground</title>
+  <style>body { margin: 0; height: 100vh; } #graphiql { height: 100vh; }</style>
+  <link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css">
+</head>
+<body>
+  <div id="graphiql">Loading...</div>
+  <script crossorigin src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+  <script>
+    const fetcher = GraphiQL.createFetcher({ url: '/graphql' });
+    ReactDOM.createRoot(document.getElementById('graphiql')).render(
+      React.createElement(GraphiQL, {
+        fetcher,
+        defaultQuery: '{\n  user(id: "1") {\n    name\n    posts(first: 10) {\n      title\n      author { name }\n    }\n  }\n}\n',
+      })
+    );
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,321 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize          = 20
+	defaultUserPostsPageSize = 10
+	maxPageSize              = 100
+)
+
+// Schema is the GraphQL schema served at /graphql
+var Schema graphql.Schema
+
+var userType, postType *graphql.Object
+
+func init() {
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        {Type: graphql.NewNonNull(graphql.ID), Resolve: userField(func(u *models.User) any { return formatID(u.ID) })},
+				"name":      {Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *models.User) any { return u.Name })},
+				"createdAt": {Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *models.User) any { return u.CreatedAt.Format(time.RFC3339) })},
+				"updatedAt": {Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *models.User) any { return u.UpdatedAt.Format(time.RFC3339) })},
+				"posts": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))),
+					Description: "The user's posts, newest first",
+					Args:        pageArgs(defaultUserPostsPageSize),
+					Resolve:     resolveUserPosts,
+				},
+			}
+		}),
+	})
+
+	postType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        {Type: graphql.NewNonNull(graphql.ID), Resolve: postField(func(p *models.Post) any { return formatID(p.ID) })},
+				"title":     {Type: graphql.NewNonNull(graphql.String), Resolve: postField(func(p *models.Post) any { return p.Title })},
+				"body":      {Type: graphql.NewNonNull(graphql.String), Resolve: postField(func(p *models.Post) any { return p.Body })},
+				"userId":    {Type: graphql.NewNonNull(graphql.ID), Resolve: postField(func(p *models.Post) any { return formatID(p.UserID) })},
+				"createdAt": {Type: graphql.NewNonNull(graphql.String), Resolve: postField(func(p *models.Post) any { return p.CreatedAt.Format(time.RFC3339) })},
+				"updatedAt": {Type: graphql.NewNonNull(graphql.String), Resolve: postField(func(p *models.Post) any { return p.UpdatedAt.Format(time.RFC3339) })},
+				"author": {
+					Type: userType,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return loadersFrom(p.Context).users.load(p.Source.(*models.Post).UserID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": {
+				Type:    userType,
+				Args:    graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: resolveUser,
+			},
+			"users": {
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Args:    pageArgs(defaultPageSize),
+				Resolve: resolveUsers,
+			},
+			"post": {
+				Type:    postType,
+				Args:    graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: resolvePost,
+			},
+			"posts": {
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))),
+				Args:    withArgs(pageArgs(defaultPageSize), graphql.FieldConfigArgument{"userId": {Type: graphql.ID}}),
+				Resolve: resolvePosts,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPost": {
+				Type: graphql.NewNonNull(postType),
+				Args: graphql.FieldConfigArgument{
+					"title":  {Type: graphql.NewNonNull(graphql.String)},
+					"body":   {Type: graphql.NewNonNull(graphql.String)},
+					"userId": {Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolveCreatePost,
+			},
+			"updatePost": {
+				Type: graphql.NewNonNull(postType),
+				Args: graphql.FieldConfigArgument{
+					"id":     {Type: graphql.NewNonNull(graphql.ID)},
+					"title":  {Type: graphql.String},
+					"body":   {Type: graphql.String},
+					"userId": {Type: graphql.ID},
+				},
+				Resolve: resolveUpdatePost,
+			},
+			"deletePost": {
+				Type:    graphql.NewNonNull(graphql.ID),
+				Args:    graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: resolveDeletePost,
+			},
+		},
+	})
+
+	var err error
+	Schema, err = graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// pageArgs are the first/offset pagination arguments of list fields
+func pageArgs(defaultFirst int) graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"first":  {Type: graphql.Int, DefaultValue: defaultFirst, Description: fmt.Sprintf("Page size, at most %d", maxPageSize)},
+		"offset": {Type: graphql.Int, DefaultValue: 0},
+	}
+}
+
+func withArgs(args, extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name, arg := range extra {
+		args[name] = arg
+	}
+	return args
+}
+
+func userField(fn func(*models.User) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return fn(p.Source.(*models.User)), nil
+	}
+}
+
+func postField(fn func(*models.Post) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return fn(p.Source.(*models.Post)), nil
+	}
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// parseID reads an ID argument, which graphql-go passes as a string
+func parseID(v any) (uint, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 0)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("Invalid id %q", s)
+	}
+	return uint(id), nil
+}
+
+// page reads and checks the first/offset arguments
+func page(args map[string]any) (int, int, error) {
+	first, _ := args["first"].(int)
+	offset, _ := args["offset"].(int)
+	if first < 0 || first > maxPageSize {
+		return 0, 0, fmt.Errorf("first must be between 0 and %d", maxPageSize)
+	}
+	if offset < 0 {
+		return 0, 0, errors.New("offset must not be negative")
+	}
+	return first, offset, nil
+}
+
+func postPointers(posts []models.Post) []*models.Post {
+	ptrs := make([]*models.Post, len(posts))
+	for i := range posts {
+		ptrs[i] = &posts[i]
+	}
+	return ptrs
+}
+
+func resolveUser(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	return loadersFrom(p.Context).users.load(id), nil
+}
+
+func resolveUsers(p graphql.ResolveParams) (any, error) {
+	first, offset, err := page(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := config.DB.Order("id").Limit(first).Offset(offset).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	ptrs := make([]*models.User, len(users))
+	for i := range users {
+		ptrs[i] = &users[i]
+	}
+	return ptrs, nil
+}
+
+func resolveUserPosts(p graphql.ResolveParams) (any, error) {
+	first, offset, err := page(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	thunk := loadersFrom(p.Context).userPosts.load(userPostsKey{UserID: p.Source.(*models.User).ID, First: first, Offset: offset})
+	return func() (any, error) {
+		posts, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		return postPointers(posts.([]models.Post)), nil
+	}, nil
+}
+
+func resolvePost(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	var post models.Post
+	if err := config.DB.Scopes(controllers.VisibleScope(0)).Limit(1).Find(&post, id).Error; err != nil {
+		return nil, err
+	}
+	if post.ID == 0 {
+		return nil, nil
+	}
+	return &post, nil
+}
+
+func resolvePosts(p graphql.ResolveParams) (any, error) {
+	first, offset, err := page(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	db := config.DB.Scopes(controllers.VisibleScope(0)).Order("id").Limit(first).Offset(offset)
+	if v, ok := p.Args["userId"]; ok {
+		userID, err := parseID(v)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("user_id = ?", userID)
+	}
+
+	var posts []models.Post
+	if err := db.Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return postPointers(posts), nil
+}
+
+// resolveCreatePost mirrors POST /posts
+func resolveCreatePost(p graphql.ResolveParams) (any, error) {
+	userID, err := parseID(p.Args["userId"])
+	if err != nil {
+		return nil, err
+	}
+	title, _ := p.Args["title"].(string)
+	body, _ := p.Args["body"].(string)
+
+	post, err := controllers.CreatePost(controllers.CreatePostRequest{Title: title, Body: body, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// resolveUpdatePost mirrors PATCH /posts/:id
+func resolveUpdatePost(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	var req controllers.UpdatePostRequest
+	req.Title, _ = p.Args["title"].(string)
+	req.Body, _ = p.Args["body"].(string)
+	if v, ok := p.Args["userId"]; ok {
+		userID, err := parseID(v)
+		if err != nil {
+			return nil, err
+		}
+		req.UserID = &userID
+	}
+
+	post, err := controllers.UpdatePost(id, req)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// resolveDeletePost mirrors DELETE /posts/:id and returns the deleted ID
+func resolveDeletePost(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := controllers.DeletePost(id); err != nil {
+		return nil, err
+	}
+	return formatID(id), nil
+}
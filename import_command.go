@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"rest_api/controllers"
+)
+
+// runImportCommand implements `go run . import`, the CLI counterpart of POST /imports.
+// It returns the process exit code: 0 on success, 1 when rows failed, 2 on bad usage.
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	kind := fs.String("kind", "", "what the file contains: users or posts (required)")
+	file := fs.String("file", "", "CSV or NDJSON file to import (required)")
+	format := fs.String("format", "", "csv or ndjson (default: from the file extension)")
+	mode := fs.String("mode", controllers.ImportModeAtomic, "atomic (one transaction) or chunked (resumable)")
+	chunkSize := fs.Int("chunk-size", 0, "rows per transaction in chunked mode (default IMPORT_CHUNK_SIZE or 500)")
+	dryRun := fs.Bool("dry-run", false, "validate every row without importing anything")
+	resume := fs.Uint("resume", 0, "ID of a chunked import job to resume")
+	errorsFile := fs.String("errors", "", "write the per-row error report (CSV) to this file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *kind == "" || *file == "" {
+		fmt.Fprintln(os.Stderr, "import: -kind and -file are required")
+		fs.Usage()
+		return 2
+	}
+	if *format == "" {
+		*format = controllers.ImportFormatFromName(*file)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 2
+	}
+	defer f.Close()
+
+	setupDB()
+	job, err := controllers.RunImport(controllers.ImportOptions{
+		Kind:      *kind,
+		Format:    *format,
+		Mode:      *mode,
+		ChunkSize: *chunkSize,
+		DryRun:    *dryRun,
+		ResumeJob: *resume,
+	}, f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("import job %d %s: %d rows processed, %d imported, %d failed (dry run: %t)\n",
+		job.ID, job.Status, job.ProcessedRows, job.ImportedRows, job.FailedRows, job.DryRun)
+	if *errorsFile != "" {
+		if err := os.WriteFile(*errorsFile, []byte(job.Errors), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		}
+	}
+	if job.Status == controllers.ImportStatusFailed || job.FailedRows > 0 {
+		return 1
+	}
+	return 0
+}
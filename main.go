@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -9,6 +10,10 @@ import (
 	"rest_api/controllers"
 	errors_middleware "rest_api/middleware"
 	"rest_api/models"
+	"rest_api/replay"
+	"rest_api/routes"
+	"rest_api/rpc"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -18,12 +23,16 @@ import (
 
 var logger = log.Default()
 
-func init() {
+// setupDB loads the environment, connects to Postgres and migrates the schema
+func setupDB() {
 	config.LoadEnvVars()
 	config.ConnectToDB()
 
 	// Auto-migrate the database schema (ensure referenced tables first)
-	err := config.DB.AutoMigrate(&models.User{}, &models.Post{})
+	err := config.DB.AutoMigrate(&models.User{}, &models.Tag{}, &models.Category{}, &models.Post{}, &models.PostRevision{}, &models.PostSlug{}, &models.Attachment{}, &models.AttachmentVariant{}, &models.IdempotencyKey{}, &models.UserExternalKey{}, &models.ImportJob{}, &models.Comment{}, &models.Reaction{}, &models.ReactionCount{}, &models.Follow{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.PostEvent{}, &models.OutboxEvent{})
+	if err == nil {
+		err = models.MigrateExtras(config.DB)
+	}
 	if err != nil {
 		log.Fatal("Migration failed:", err)
 	}
@@ -44,7 +53,48 @@ func init() {
 
 // @host localhost:3000
 // @BasePath /
+
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description "Bearer " followed by ADMIN_TOKEN
 func main() {
+	// Subcommand: go run . replay -file requests.jsonl [-target http://localhost:3000]
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay.Main(os.Args[2:], os.Stdout, newReplayHandler))
+	}
+	// Subcommand: go run . import -kind users -file authors.csv [-mode chunked] [-dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImportCommand(os.Args[2:]))
+	}
+
+	setupDB()
+
+	// gRPC services run on their own port and share the DB and post/user operations with the HTTP handlers
+	go func() {
+		if err := rpc.Serve(":" + config.GetEnv("GRPC_PORT", "50051")); err != nil {
+			log.Fatal("gRPC server failed:", err)
+		}
+	}()
+
+	// Publishes scheduled posts when they come due, including any that came due while the server was down
+	go controllers.RunScheduler(context.Background(), config.GetEnvDuration("SCHEDULER_INTERVAL", 15*time.Second))
+
+	// Makes resized variants of uploaded images, including any left pending while the server was down
+	go controllers.RunAttachmentWorker(context.Background(), config.GetEnvDuration("ATTACHMENT_WORKER_INTERVAL", 30*time.Second))
+
+	// Hears about the posts and users changed through any server, over Postgres LISTEN/NOTIFY
+	go controllers.RunChangeBus(context.Background(), config.GetEnv("DB_CONNECTION_STRING", ""))
+
+	// Relays the events written with each change to webhooks and the live stream, including any left by a crash
+	go controllers.RunOutboxRelay(context.Background(), config.GetEnvDuration("OUTBOX_INTERVAL", time.Second))
+
+	// Sends webhook deliveries and their retries, including any left pending while the server was down
+	go controllers.RunWebhookWorker(context.Background(), config.GetEnvDuration("WEBHOOK_WORKER_INTERVAL", 5*time.Second))
+
+	// Reads post changes made through any server and sends them to this server's stream clients
+	go controllers.RunPostStream(context.Background(), config.GetEnvDuration("POST_STREAM_INTERVAL", time.Second))
+
 	logger.Println("hello world")
 	engine := gin.Default()
 	engine.Use(errors_middleware.JSONErrorMiddleware())
@@ -68,18 +118,21 @@ func main() {
 	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
 
 	// API routes
-	engine.POST("/users/", controllers.UsersCreate)
-	engine.GET("/users/:id", controllers.UsersShow)
-	engine.GET("/users/:id/posts", controllers.UserPostsShow)
-	engine.POST("/posts/", controllers.PostsCreate)
-	engine.GET("/posts/", controllers.PostsIndex)
-	engine.GET("/posts/:id", controllers.PostsShow)
-	engine.PATCH("/posts/:id", controllers.PostsUpdate)
-	engine.DELETE("/posts/:id", controllers.PostsDelete)
+	routes.Register(engine)
 
 	engine.Run(":3000") // listen and serve on localhost:3000
 }
 
+// newReplayHandler builds the in-process engine used by the replay subcommand
+func newReplayHandler() http.Handler {
+	setupDB()
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	engine.Use(errors_middleware.JSONErrorMiddleware())
+	routes.Register(engine)
+	return engine
+}
+
 // generateSwaggerJSON builds the OpenAPI spec from code annotations at runtime.
 func generateSwaggerJSON() ([]byte, error) {
 	wd, err := os.Getwd()
@@ -0,0 +1,164 @@
+// Package markdown renders post bodies written in CommonMark with GFM extensions to sanitized HTML.
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Heading is an entry of a rendered document's table of contents
+type Heading struct {
+	Level int    `json:"level" xml:"level" yaml:"level" example:"2"`
+	Text  string `json:"text" xml:"text" yaml:"text" example:"Getting started"`
+	ID    string `json:"id" xml:"id" yaml:"id" example:"getting-started"`
+}
+
+// Rendered is the HTML of a document and its table of contents
+type Rendered struct {
+	HTML string
+	TOC  []Heading
+}
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+	policy = newPolicy()
+)
+
+// newPolicy allows user-generated content plus the heading IDs that anchors and the table of
+// contents link to, and the disabled checkboxes of GFM task lists
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Render converts source to sanitized HTML. Raw HTML in the source is dropped by the renderer and
+// the output is sanitized again, so scripts, event handlers and javascript: links never get through.
+func Render(source string) (Rendered, error) {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src))
+
+	var toc []Heading
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		h := Heading{Level: heading.Level, Text: plainText(heading, src)}
+		if id, ok := heading.AttributeString("id"); ok {
+			if b, ok := id.([]byte); ok {
+				h.ID = string(b)
+			}
+		}
+		toc = append(toc, h)
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return Rendered{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, doc); err != nil {
+		return Rendered{}, err
+	}
+	return Rendered{HTML: policy.Sanitize(buf.String()), TOC: toc}, nil
+}
+
+// plainText joins the text under n without markup
+func plainText(n ast.Node, src []byte) string {
+	var buf bytes.Buffer
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			buf.Write(t.Segment.Value(src))
+			if t.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(t.Value)
+		case *ast.CodeSpan:
+			for s := t.FirstChild(); s != nil; s = s.NextSibling() {
+				if st, ok := s.(*ast.Text); ok {
+					buf.Write(st.Segment.Value(src))
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+// Cache keeps the most recently used renderings. Entries are keyed by a hash of the source, so
+// each revision of a post is rendered once and an edit simply misses the cache.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key      [sha256.Size]byte
+	rendered Rendered
+}
+
+// NewCache returns a cache holding up to size renderings
+func NewCache(size int) *Cache {
+	return &Cache{size: size, order: list.New(), entries: map[[sha256.Size]byte]*list.Element{}}
+}
+
+// Render returns the cached rendering of source, rendering and storing it on a miss
+func (c *Cache) Render(source string) (Rendered, error) {
+	key := sha256.Sum256([]byte(source))
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*cacheEntry).rendered, nil
+	}
+	c.mu.Unlock()
+
+	rendered, err := Render(source)
+	if err != nil {
+		return Rendered{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key: key, rendered: rendered})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return rendered, nil
+}
+
+// Len returns the number of cached renderings
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
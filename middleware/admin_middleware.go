@@ -0,0 +1,26 @@
+package errors_middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"rest_api/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly lets a request through only when it carries "Authorization: Bearer <ADMIN_TOKEN>".
+// With ADMIN_TOKEN unset every request is refused, so admin routes are closed by default.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := config.GetEnv("ADMIN_TOKEN", "")
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			Render(c, http.StatusForbidden, ErrorResponse{Error: "Admin token required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
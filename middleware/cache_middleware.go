@@ -0,0 +1,18 @@
+package errors_middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheControl sets the Cache-Control header on GET and HEAD responses.
+// An empty policy leaves the header untouched.
+func CacheControl(policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy != "" && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+			c.Header("Cache-Control", policy)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,104 @@
+package errors_middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// MIMEYAML2 is the registered YAML media type; gin only knows application/x-yaml
+const MIMEYAML2 = "application/yaml"
+
+// negotiatedFormatKey stores the response format chosen by ContentNegotiation
+const negotiatedFormatKey = "negotiated_format"
+
+// offeredFormats are the response formats Render can produce, in order of preference
+var offeredFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+	MIMEYAML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+}
+
+// acceptedBodyFormats are the request body formats c.Bind understands
+var acceptedBodyFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+	MIMEYAML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+}
+
+// ContentNegotiation picks the response format from the Accept header and checks the request
+// body's Content-Type. It answers 406 when no supported format is acceptable and 415 when a
+// body is sent in an unsupported format, before the handler runs.
+func ContentNegotiation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.NegotiateFormat(offeredFormats...)
+		if format == "" {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, ErrorResponse{
+				Error: "Not acceptable, supported formats: " + strings.Join(offeredFormats, ", "),
+			})
+			return
+		}
+		c.Set(negotiatedFormatKey, format)
+		c.Header("Vary", "Accept")
+
+		if hasBody(c.Request) {
+			contentType := c.ContentType()
+			if !contains(acceptedBodyFormats, contentType) {
+				Render(c, http.StatusUnsupportedMediaType, ErrorResponse{
+					Error: "Unsupported Content-Type " + contentType + ", supported formats: " + strings.Join(acceptedBodyFormats, ", "),
+				})
+				c.Abort()
+				return
+			}
+			// c.Bind only maps application/x-yaml to the YAML binding
+			if contentType == MIMEYAML2 {
+				c.Request.Header.Set("Content-Type", binding.MIMEYAML)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// Render writes obj in the format negotiated for the request, falling back to JSON
+func Render(c *gin.Context, code int, obj any) {
+	switch c.GetString(negotiatedFormatKey) {
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.XML(code, obj)
+	case binding.MIMEYAML, MIMEYAML2:
+		c.YAML(code, obj)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(code, render.MsgPack{Data: obj})
+	default:
+		c.JSON(code, obj)
+	}
+}
+
+// hasBody reports whether the request carries a body that a handler would bind
+func hasBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return r.ContentLength > 0 || r.ContentLength == -1
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -4,7 +4,7 @@ import "github.com/gin-gonic/gin"
 
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error string `json:"error" xml:"error" yaml:"error"`
 }
 
 
@@ -12,9 +12,10 @@ func JSONErrorMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
 		if len(c.Errors) > 0 {
-			c.AbortWithStatusJSON(c.Writer.Status(), ErrorResponse{
+			Render(c, c.Writer.Status(), ErrorResponse{
 				Error: c.Errors[0].Error(),
 			})
+			c.Abort()
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,258 @@
+package errors_middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"rest_api/config"
+	"rest_api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyPollInterval   = 50 * time.Millisecond
+	defaultIdempotencyKeyTTL  = 24 * time.Hour
+	defaultIdempotencyMaxWait = 5 * time.Second
+	defaultIdempotencyLease   = 30 * time.Second
+)
+
+// captureWriter tees the response body so it can be stored for replay
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes POST handlers safe to retry when the client sends an Idempotency-Key header.
+//
+// The first request with a key reserves it in Postgres and, if the handler succeeds (2xx),
+// stores its response. Retries with the same key and body replay that response; the same key
+// with a different body gets 409. A retry arriving while the first request is still in flight
+// waits up to IDEMPOTENCY_MAX_WAIT for it to finish and then fails with 409. Failed requests,
+// including handlers that panic, release the key so they can be retried. An in-flight key is held
+// for IDEMPOTENCY_LEASE and renewed while the handler runs, so if the server dies mid-request a
+// retry takes the key over once the lease lapses. Keys expire after IDEMPOTENCY_KEY_TTL.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Unable to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+
+		deadline := time.Now().Add(config.GetEnvDuration("IDEMPOTENCY_MAX_WAIT", defaultIdempotencyMaxWait))
+		lease := config.GetEnvDuration("IDEMPOTENCY_LEASE", defaultIdempotencyLease)
+		if lease <= 0 {
+			lease = defaultIdempotencyLease
+		}
+		var owner string
+		for {
+			reserved, err := reserveIdempotencyKey(key, hash, lease)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Unable to reserve Idempotency-Key"})
+				return
+			}
+			if reserved != "" {
+				owner = reserved
+				break
+			}
+			if replayIdempotentResponse(c, key, hash, deadline) {
+				return
+			}
+		}
+		defer renewIdempotencyKey(key, owner, lease)()
+
+		// a panicking handler must not leave the key in flight until its lease lapses
+		defer func() {
+			if r := recover(); r != nil {
+				releaseIdempotencyKey(key, owner)
+				panic(r)
+			}
+		}()
+
+		writer := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if len(c.Errors) > 0 || status < 200 || status >= 300 {
+			releaseIdempotencyKey(key, owner)
+			return
+		}
+		result := config.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND owner = ?", key, owner).Updates(map[string]any{
+			"completed":     true,
+			"locked_until":  nil,
+			"status_code":   status,
+			"content_type":  writer.Header().Get("Content-Type"),
+			"response_body": writer.body.Bytes(),
+		})
+		switch {
+		case result.Error != nil:
+			// without a stored response, retries could only wait for a request that has finished
+			log.Printf("idempotency: storing the response for key %q failed: %v", key, result.Error)
+			releaseIdempotencyKey(key, owner)
+		case result.RowsAffected == 0:
+			log.Printf("idempotency: key %q was taken over by a retry before the response was stored", key)
+		}
+	}
+}
+
+// renewIdempotencyKey extends the lease on key every third of lease until the returned function
+// is called, so a slow handler keeps its key while one whose server died loses it
+func renewIdempotencyKey(key, owner string, lease time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := config.DB.Model(&models.IdempotencyKey{}).
+					Where("key = ? AND owner = ? AND NOT completed", key, owner).
+					Update("locked_until", time.Now().Add(lease)).Error
+				if err != nil {
+					log.Printf("idempotency: renewing the lease on key %q failed: %v", key, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// releaseIdempotencyKey deletes the reservation of key so the request can be retried, unless a
+// retry has already taken it over
+func releaseIdempotencyKey(key, owner string) {
+	if err := config.DB.Delete(&models.IdempotencyKey{}, "key = ? AND owner = ?", key, owner).Error; err != nil {
+		log.Printf("idempotency: releasing key %q failed, it stays reserved until its lease lapses: %v", key, err)
+	}
+}
+
+// requestFingerprint hashes everything that makes two requests "the same"
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reserveIdempotencyKey inserts an in-flight row for key held for lease, returning the new
+// owner, or "" if a live row already exists. Expired rows, and in-flight rows whose lease has
+// lapsed, are taken over.
+func reserveIdempotencyKey(key, hash string, lease time.Duration) (string, error) {
+	now := time.Now()
+	err := config.DB.Delete(&models.IdempotencyKey{},
+		"key = ? AND (expires_at < ? OR (NOT completed AND locked_until < ?))", key, now, now).Error
+	if err != nil {
+		return "", err
+	}
+
+	owner, err := newIdempotencyOwner()
+	if err != nil {
+		return "", err
+	}
+	lockedUntil := now.Add(lease)
+	row := models.IdempotencyKey{
+		Key:         key,
+		RequestHash: hash,
+		Owner:       owner,
+		LockedUntil: &lockedUntil,
+		ExpiresAt:   now.Add(config.GetEnvDuration("IDEMPOTENCY_KEY_TTL", defaultIdempotencyKeyTTL)),
+	}
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return "", result.Error
+	}
+	return owner, nil
+}
+
+// newIdempotencyOwner returns a random token identifying one reservation
+func newIdempotencyOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// replayIdempotentResponse answers a retry from the stored row, waiting until deadline for an
+// in-flight original. It returns false if the original released the key or let its lease lapse,
+// so it can be reserved again.
+func replayIdempotentResponse(c *gin.Context, key, hash string, deadline time.Time) bool {
+	for {
+		var row models.IdempotencyKey
+		err := config.DB.First(&row, "key = ?", key).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Unable to look up Idempotency-Key"})
+			return true
+		}
+		if row.RequestHash != hash {
+			c.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: "Idempotency-Key was already used with a different request"})
+			return true
+		}
+		if row.Completed {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(row.StatusCode, row.ContentType, row.ResponseBody)
+			c.Abort()
+			return true
+		}
+		if row.LockedUntil != nil && row.LockedUntil.Before(time.Now()) {
+			// the original's server stopped renewing its lease, so this retry may take over
+			return false
+		}
+		if time.Now().After(deadline) {
+			c.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: "A request with this Idempotency-Key is still in progress"})
+			return true
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return true
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
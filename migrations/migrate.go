@@ -27,7 +27,10 @@ func main() {
 		log.Println("Starting database migration...")
 
 		// Auto-migrate all your models (ensure referenced tables first)
-		err := config.DB.AutoMigrate(&models.User{}, &models.Post{})
+		err := config.DB.AutoMigrate(&models.User{}, &models.Tag{}, &models.Category{}, &models.Post{}, &models.PostRevision{}, &models.PostSlug{}, &models.Attachment{}, &models.AttachmentVariant{}, &models.IdempotencyKey{}, &models.UserExternalKey{}, &models.ImportJob{}, &models.Comment{}, &models.Reaction{}, &models.ReactionCount{}, &models.Follow{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.PostEvent{}, &models.OutboxEvent{})
+		if err == nil {
+			err = models.MigrateExtras(config.DB)
+		}
 		if err != nil {
 			log.Fatal("Migration failed:", err)
 		}
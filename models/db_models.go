@@ -1,16 +1,328 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Name  string
-	Posts []Post `gorm:"foreignKey:UserID"`
+	Name           string
+	Posts          []Post `gorm:"foreignKey:UserID"`
+	FollowerCount  int    `gorm:"not null;default:0"`
+	FollowingCount int    `gorm:"not null;default:0"`
+}
+
+// Follow records that one user follows another. The primary key rules out duplicates and the
+// check constraint rules out self-follows.
+type Follow struct {
+	FollowerID uint      `gorm:"primaryKey;index:idx_follows_follower_created,priority:1;check:chk_follows_not_self,follower_id <> followee_id"`
+	FolloweeID uint      `gorm:"primaryKey;index:idx_follows_followee_created,priority:1"`
+	CreatedAt  time.Time `gorm:"index:idx_follows_follower_created,priority:2;index:idx_follows_followee_created,priority:2"`
 }
 
+// Post statuses. Only published posts are shown to everyone; see PostTransitions for the allowed changes.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+	PostStatusArchived  = "archived"
+)
+
 type Post struct {
 	gorm.Model
-	Title  string
+	Title string
+	// Slug is unique among current slugs and is set from the title after the insert; see PostSlug
+	// for the slugs a post used to have
+	Slug   *string `gorm:"size:255;uniqueIndex"`
 	Body   string
 	UserID uint
+	Status string `gorm:"not null;default:published;size:20;index"`
+	// PublishedAt is when the post was published or, while it is scheduled, when it will be
+	PublishedAt    *time.Time `gorm:"index"`
+	CommentCount   int        `gorm:"not null;default:0"`
+	CommentsLocked bool       `gorm:"not null;default:false"`
+	Tags           []Tag      `gorm:"many2many:post_tags"`
+	Categories     []Category `gorm:"many2many:post_categories"`
+	ReactionCounts []ReactionCount
+}
+
+// BeforeCreate defaults new posts to published, so posts created by imports and bulk
+// operations stay public as they were before posts had a status
+func (p *Post) BeforeCreate(tx *gorm.DB) error {
+	if p.Status == "" {
+		p.Status = PostStatusPublished
+	}
+	if p.Status == PostStatusPublished && p.PublishedAt == nil {
+		now := time.Now()
+		p.PublishedAt = &now
+	}
+	return nil
+}
+
+// AfterCreate gives the post its slug and records its first revision, credited to its author
+func (p *Post) AfterCreate(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	if p.Slug == nil {
+		if err := assignPostSlug(db, p); err != nil {
+			return err
+		}
+	}
+	author := p.UserID
+	revision := PostRevision{PostID: p.ID, Number: 1, Title: p.Title, Body: p.Body, EditorID: &author, CreatedAt: p.CreatedAt}
+	return db.Create(&revision).Error
+}
+
+// PostRevision is the full title and body of a post after one edit. Revisions are numbered from 1
+// per post and never change; restoring an old revision adds a new one.
+type PostRevision struct {
+	ID           uint `gorm:"primaryKey"`
+	PostID       uint `gorm:"not null;uniqueIndex:idx_post_revisions_post_number,priority:1"`
+	Number       int  `gorm:"not null;uniqueIndex:idx_post_revisions_post_number,priority:2"`
+	Title        string
+	Body         string
+	EditorID     *uint `gorm:"index"`
+	RestoredFrom *int
+	CreatedAt    time.Time
+}
+
+// Attachment variant statuses. Images start pending and the attachment worker makes their
+// variants; other files have no variants and an empty status.
+const (
+	VariantsPending = "pending"
+	VariantsReady   = "ready"
+	VariantsFailed  = "failed"
+)
+
+// Attachment is a file uploaded to a post. The bytes live in a blob store under Key; the row
+// keeps what is needed to serve them.
+type Attachment struct {
+	ID          uint   `gorm:"primaryKey"`
+	PostID      uint   `gorm:"not null;index"`
+	Key         string `gorm:"not null;uniqueIndex;size:255"`
+	Filename    string `gorm:"not null;size:255"`
+	ContentType string `gorm:"not null;size:100"`
+	Size        int64  `gorm:"not null"`
+	SHA256      string `gorm:"column:sha256;not null;size:64"`
+	UploaderID  *uint  `gorm:"index"`
+	// Width, Height, Blurhash and AverageColor describe images once their variants are made
+	Width          int
+	Height         int
+	Blurhash       string `gorm:"size:64"`
+	AverageColor   string `gorm:"size:7"`
+	VariantsStatus string `gorm:"not null;default:'';size:20;index"`
+	Variants       []AttachmentVariant
+	CreatedAt      time.Time
+}
+
+// AttachmentVariant is a resized copy of an image attachment, stored in the blob store under Key
+type AttachmentVariant struct {
+	AttachmentID uint   `gorm:"primaryKey"`
+	Name         string `gorm:"primaryKey;size:20"`
+	Key          string `gorm:"not null;uniqueIndex;size:255"`
+	ContentType  string `gorm:"not null;size:100"`
+	Width        int
+	Height       int
+	Size         int64
+}
+
+// Tag is a free-form topic label; tags are created on first use and identified by their slug
+type Tag struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"not null"`
+	Slug      string `gorm:"not null;uniqueIndex;size:100"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Category is a broader grouping of posts, identified by its slug like Tag
+type Category struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"not null"`
+	Slug      string `gorm:"not null;uniqueIndex;size:100"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Comment is a comment on a post; replies point at their parent comment
+type Comment struct {
+	gorm.Model
+	PostID   uint  `gorm:"not null;index"`
+	UserID   uint  `gorm:"not null;index"`
+	ParentID *uint `gorm:"index"`
+	Body     string
+}
+
+// Reaction is one user's reaction of one type to a post; a user can add each type once
+type Reaction struct {
+	ID        uint   `gorm:"primaryKey"`
+	PostID    uint   `gorm:"not null;uniqueIndex:idx_reactions_post_user_type"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_reactions_post_user_type;index"`
+	Type      string `gorm:"not null;size:20;uniqueIndex:idx_reactions_post_user_type"`
+	CreatedAt time.Time
+}
+
+// ReactionCount is the denormalized number of reactions of one type on a post, kept in step
+// with the reactions table so that listing posts does not have to count them
+type ReactionCount struct {
+	PostID uint   `gorm:"primaryKey"`
+	Type   string `gorm:"primaryKey;size:20"`
+	Count  int    `gorm:"not null;default:0"`
+}
+
+// migrateStatements run after AutoMigrate. They add indexes on columns of the embedded
+// gorm.Model, which cannot carry index tags, and partial indexes, and backfill new columns.
+var migrateStatements = []string{
+	// collection Last-Modified headers read the newest updated_at of any post
+	`CREATE INDEX IF NOT EXISTS idx_posts_updated_at ON posts (updated_at)`,
+	// the home feed reads each followed user's newest posts from this index
+	`CREATE INDEX IF NOT EXISTS idx_posts_user_created ON posts (user_id, created_at DESC, id DESC) WHERE deleted_at IS NULL`,
+	// posts created before posts had a status were published when they were created
+	`UPDATE posts SET published_at = created_at WHERE status = 'published' AND published_at IS NULL`,
+	// posts created before revisions were kept start their history with their current content
+	`INSERT INTO post_revisions (post_id, number, title, body, created_at)
+		SELECT id, 1, title, body, updated_at FROM posts
+		WHERE NOT EXISTS (SELECT 1 FROM post_revisions WHERE post_revisions.post_id = posts.id)`,
+	// images uploaded before variants were made get them from the attachment worker
+	`UPDATE attachments SET variants_status = 'pending'
+		WHERE variants_status = '' AND content_type IN ('image/jpeg', 'image/png', 'image/gif')`,
+	// the outbox relay looks for the oldest pending event, and for earlier pending events of the same aggregate
+	`CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (aggregate_type, aggregate_id, id) WHERE status = 'pending'`,
+	`CREATE INDEX IF NOT EXISTS idx_outbox_pending_id ON outbox (id) WHERE status = 'pending'`,
+}
+
+// MigrateExtras runs the statements AutoMigrate cannot express and backfills the columns that
+// need Go to compute; it is safe to run repeatedly
+func MigrateExtras(db *gorm.DB) error {
+	for _, stmt := range migrateStatements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return backfillPostSlugs(db)
+}
+
+// IdempotencyKey stores the outcome of a POST made with an Idempotency-Key header
+type IdempotencyKey struct {
+	Key         string `gorm:"primaryKey;size:255"`
+	RequestHash string `gorm:"size:64"`
+	Completed   bool
+	// Owner identifies the request holding an in-flight key, and LockedUntil is when its hold
+	// lapses unless renewed, so a retry can take over from a server that died mid-request
+	Owner        string `gorm:"size:32"`
+	LockedUntil  *time.Time
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+// UserExternalKey maps an author key from an imported file to the user created for it
+type UserExternalKey struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	UserID    uint   `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// ImportJob tracks a bulk import run so it can be inspected and, in chunked mode, resumed
+type ImportJob struct {
+	gorm.Model
+	Kind          string
+	Format        string
+	Mode          string
+	DryRun        bool
+	Status        string
+	ProcessedRows int
+	ImportedRows  int
+	FailedRows    int
+	Errors        string
+}
+
+// WebhookSubscription asks for events of the listed types to be POSTed to URL, signed with Secret
+type WebhookSubscription struct {
+	ID     uint   `gorm:"primaryKey"`
+	URL    string `gorm:"not null;size:2048"`
+	Secret string `gorm:"not null;size:255"`
+	// Events is a comma-separated list of event types
+	Events    string `gorm:"not null"`
+	Active    bool   `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Webhook delivery statuses. Deliveries stay pending while they have attempts left and become
+// dead when the last one fails.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event sent, or to be sent, to one subscription. Payload is the exact
+// request body, so retries and redeliveries send the same bytes.
+type WebhookDelivery struct {
+	ID             uint      `gorm:"primaryKey"`
+	SubscriptionID uint      `gorm:"not null;index"`
+	EventID        string    `gorm:"not null;size:32;index"`
+	EventType      string    `gorm:"not null;size:50"`
+	Payload        string    `gorm:"not null"`
+	Status         string    `gorm:"not null;size:20;index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int       `gorm:"not null"`
+	NextAttemptAt  time.Time `gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	LastError      string `gorm:"size:1000"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Outbox event statuses. Events are pending until every handler has run, and failed when they
+// ran out of attempts.
+const (
+	OutboxPending = "pending"
+	OutboxDone    = "done"
+	OutboxFailed  = "failed"
+)
+
+// Outbox aggregate types, the kinds of row an event is about
+const (
+	AggregatePost = "post"
+	AggregateUser = "user"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change it describes, and
+// handed to the outbox handlers afterwards by the relay. Payload is the JSON the handlers receive.
+type OutboxEvent struct {
+	ID            uint64 `gorm:"primaryKey"`
+	AggregateType string `gorm:"not null;size:20"`
+	AggregateID   uint   `gorm:"not null"`
+	Type          string `gorm:"not null;size:50"`
+	Payload       string `gorm:"not null"`
+	Status        string `gorm:"not null;size:20"`
+	Attempts      int    `gorm:"not null"`
+	// AvailableAt is when the relay may next try the event
+	AvailableAt time.Time `gorm:"not null"`
+	LastError   string    `gorm:"size:1000"`
+	CreatedAt   time.Time
+	ProcessedAt *time.Time
+}
+
+// TableName keeps the table called outbox
+func (OutboxEvent) TableName() string { return "outbox" }
+
+// PostEvent is a change to a post, kept for the live stream. The newest rows are kept so clients
+// can resume; Status and UserID are copied from the post to decide who may see the event.
+type PostEvent struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Type   string `gorm:"not null;size:50"`
+	PostID uint   `gorm:"not null;index"`
+	UserID uint   `gorm:"not null"`
+	Status string `gorm:"not null;size:20"`
+	// PreviousStatus is the status the change moved the post from, for changes of status
+	PreviousStatus string `gorm:"not null;default:'';size:20"`
+	Payload        string `gorm:"not null"`
+	CreatedAt      time.Time
 }
@@ -1,21 +1,150 @@
 package models
 
+import "rest_api/markdown"
+
 // Post represents a blog post
 type JsonPost struct {
-	ID        uint    `json:"id" example:"1"`
-	CreatedAt string  `json:"created_at" example:"2023-01-01T00:00:00Z"`
-	UpdatedAt string  `json:"updated_at" example:"2023-01-01T00:00:00Z"`
-	DeletedAt *string `json:"deleted_at,omitempty" example:"null"`
-	Title     string  `json:"title" example:"My First Post"`
-	Body      string  `json:"body" example:"This is the content of my first post"`
-	UserID    uint    `json:"user_id" example:"1"`
+	ID             uint                `json:"id" xml:"id" yaml:"id" example:"1"`
+	CreatedAt      string              `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt      string              `json:"updated_at" xml:"updated_at" yaml:"updated_at" example:"2023-01-01T00:00:00Z"`
+	DeletedAt      *string             `json:"deleted_at,omitempty" xml:"deleted_at,omitempty" yaml:"deleted_at,omitempty" example:"null"`
+	Title          string              `json:"title" xml:"title" yaml:"title" example:"My First Post"`
+	Slug           string              `json:"slug" xml:"slug" yaml:"slug" example:"my-first-post"`
+	Body           string              `json:"body" xml:"body" yaml:"body" example:"This is the content of my first post"`
+	BodyHTML       string              `json:"body_html,omitempty" xml:"body_html,omitempty" yaml:"body_html,omitempty" example:"<p>This is the content of my first post</p>"`
+	TOC            []markdown.Heading  `json:"toc,omitempty" xml:"toc>heading,omitempty" yaml:"toc,omitempty"`
+	UserID         uint                `json:"user_id" xml:"user_id" yaml:"user_id" example:"1"`
+	Status         string              `json:"status" xml:"status" yaml:"status" example:"published"`
+	PublishedAt    *string             `json:"published_at,omitempty" xml:"published_at,omitempty" yaml:"published_at,omitempty" example:"2023-01-01T00:00:00Z"`
+	CommentCount   int                 `json:"comment_count" xml:"comment_count" yaml:"comment_count" example:"3"`
+	CommentsLocked bool                `json:"comments_locked" xml:"comments_locked" yaml:"comments_locked" example:"false"`
+	Tags           []string            `json:"tags,omitempty" xml:"tags>tag,omitempty" yaml:"tags,omitempty" example:"go,databases"`
+	Categories     []string            `json:"categories,omitempty" xml:"categories>category,omitempty" yaml:"categories,omitempty" example:"engineering"`
+	ReactionCounts []JsonReactionCount `json:"reaction_counts,omitempty" xml:"reaction_counts>reaction,omitempty" yaml:"reaction_counts,omitempty"`
+}
+
+// PostRevision represents one saved version of a post's title and body
+type JsonPostRevision struct {
+	Number       int    `json:"number" xml:"number" yaml:"number" example:"2"`
+	PostID       uint   `json:"post_id" xml:"post_id" yaml:"post_id" example:"1"`
+	Title        string `json:"title" xml:"title" yaml:"title" example:"My First Post"`
+	Body         string `json:"body" xml:"body" yaml:"body" example:"This is the content of my first post"`
+	EditorID     *uint  `json:"editor_id,omitempty" xml:"editor_id,omitempty" yaml:"editor_id,omitempty" example:"1"`
+	RestoredFrom *int   `json:"restored_from,omitempty" xml:"restored_from,omitempty" yaml:"restored_from,omitempty" example:"1"`
+	CreatedAt    string `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// Attachment represents a file attached to a post
+type JsonAttachment struct {
+	ID             uint                    `json:"id" xml:"id" yaml:"id" example:"1"`
+	PostID         uint                    `json:"post_id" xml:"post_id" yaml:"post_id" example:"1"`
+	Filename       string                  `json:"filename" xml:"filename" yaml:"filename" example:"diagram.png"`
+	ContentType    string                  `json:"content_type" xml:"content_type" yaml:"content_type" example:"image/png"`
+	Size           int64                   `json:"size" xml:"size" yaml:"size" example:"48213"`
+	SHA256         string                  `json:"sha256" xml:"sha256" yaml:"sha256" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	UploaderID     *uint                   `json:"uploader_id,omitempty" xml:"uploader_id,omitempty" yaml:"uploader_id,omitempty" example:"1"`
+	URL            string                  `json:"url" xml:"url" yaml:"url" example:"/attachments/1"`
+	Width          int                     `json:"width,omitempty" xml:"width,omitempty" yaml:"width,omitempty" example:"1600"`
+	Height         int                     `json:"height,omitempty" xml:"height,omitempty" yaml:"height,omitempty" example:"900"`
+	Blurhash       string                  `json:"blurhash,omitempty" xml:"blurhash,omitempty" yaml:"blurhash,omitempty" example:"LEHV6nWB2yk8pyo0adR*.7kCMdnj"`
+	AverageColor   string                  `json:"average_color,omitempty" xml:"average_color,omitempty" yaml:"average_color,omitempty" example:"#6a8caf"`
+	VariantsStatus string                  `json:"variants_status,omitempty" xml:"variants_status,omitempty" yaml:"variants_status,omitempty" example:"ready"`
+	Variants       []JsonAttachmentVariant `json:"variants,omitempty" xml:"variants>variant,omitempty" yaml:"variants,omitempty"`
+	CreatedAt      string                  `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// AttachmentVariant represents a resized copy of an image attachment
+type JsonAttachmentVariant struct {
+	Name        string `json:"name" xml:"name" yaml:"name" example:"thumb"`
+	ContentType string `json:"content_type" xml:"content_type" yaml:"content_type" example:"image/jpeg"`
+	Width       int    `json:"width" xml:"width" yaml:"width" example:"160"`
+	Height      int    `json:"height" xml:"height" yaml:"height" example:"90"`
+	Size        int64  `json:"size" xml:"size" yaml:"size" example:"5120"`
+	URL         string `json:"url" xml:"url" yaml:"url" example:"/attachments/1?variant=thumb"`
+}
+
+// ReactionCount represents how many reactions of a type a post has
+type JsonReactionCount struct {
+	Type  string `json:"type" xml:"type" yaml:"type" example:"like"`
+	Count int    `json:"count" xml:"count" yaml:"count" example:"4"`
+}
+
+// Reaction represents a user's reaction to a post
+type JsonReaction struct {
+	UserID    uint   `json:"user_id" xml:"user_id" yaml:"user_id" example:"1"`
+	Type      string `json:"type" xml:"type" yaml:"type" example:"like"`
+	CreatedAt string `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// Tag represents a tag or category with the number of posts using it
+type JsonTag struct {
+	Name      string `json:"name" xml:"name" yaml:"name" example:"Databases"`
+	Slug      string `json:"slug" xml:"slug" yaml:"slug" example:"databases"`
+	PostCount int    `json:"post_count" xml:"post_count" yaml:"post_count" example:"12"`
+}
+
+// Comment represents a comment on a post
+type JsonComment struct {
+	ID        uint    `json:"id" xml:"id" yaml:"id" example:"1"`
+	CreatedAt string  `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt string  `json:"updated_at" xml:"updated_at" yaml:"updated_at" example:"2023-01-01T00:00:00Z"`
+	DeletedAt *string `json:"deleted_at,omitempty" xml:"deleted_at,omitempty" yaml:"deleted_at,omitempty" example:"null"`
+	PostID    uint    `json:"post_id" xml:"post_id" yaml:"post_id" example:"1"`
+	UserID    uint    `json:"user_id" xml:"user_id" yaml:"user_id" example:"1"`
+	ParentID  *uint   `json:"parent_id,omitempty" xml:"parent_id,omitempty" yaml:"parent_id,omitempty" example:"1"`
+	Body      string  `json:"body" xml:"body" yaml:"body" example:"Great post!"`
 }
 
 // User represents a user
 type JsonUser struct {
-	ID        uint    `json:"id" example:"1"`
-	CreatedAt string  `json:"created_at" example:"2023-01-01T00:00:00Z"`
-	UpdatedAt string  `json:"updated_at" example:"2023-01-01T00:00:00Z"`
-	DeletedAt *string `json:"deleted_at,omitempty" example:"null"`
-	Name      string  `json:"name" example:"John Doe"`
+	ID             uint    `json:"id" xml:"id" yaml:"id" example:"1"`
+	CreatedAt      string  `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt      string  `json:"updated_at" xml:"updated_at" yaml:"updated_at" example:"2023-01-01T00:00:00Z"`
+	DeletedAt      *string `json:"deleted_at,omitempty" xml:"deleted_at,omitempty" yaml:"deleted_at,omitempty" example:"null"`
+	Name           string  `json:"name" xml:"name" yaml:"name" example:"John Doe"`
+	FollowerCount  int     `json:"follower_count" xml:"follower_count" yaml:"follower_count" example:"10"`
+	FollowingCount int     `json:"following_count" xml:"following_count" yaml:"following_count" example:"5"`
+}
+
+// ImportJob represents the state of a bulk import
+type JsonImportJob struct {
+	ID            uint   `json:"id" xml:"id" yaml:"id" example:"1"`
+	CreatedAt     string `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt     string `json:"updated_at" xml:"updated_at" yaml:"updated_at" example:"2023-01-01T00:00:00Z"`
+	Kind          string `json:"kind" xml:"kind" yaml:"kind" example:"posts"`
+	Format        string `json:"format" xml:"format" yaml:"format" example:"csv"`
+	Mode          string `json:"mode" xml:"mode" yaml:"mode" example:"chunked"`
+	DryRun        bool   `json:"dry_run" xml:"dry_run" yaml:"dry_run" example:"false"`
+	Status        string `json:"status" xml:"status" yaml:"status" example:"completed"`
+	ProcessedRows int    `json:"processed_rows" xml:"processed_rows" yaml:"processed_rows" example:"1000"`
+	ImportedRows  int    `json:"imported_rows" xml:"imported_rows" yaml:"imported_rows" example:"998"`
+	FailedRows    int    `json:"failed_rows" xml:"failed_rows" yaml:"failed_rows" example:"2"`
+}
+
+// WebhookSubscription represents a webhook subscription. The secret is only shown when it is set.
+type JsonWebhookSubscription struct {
+	ID        uint     `json:"id" xml:"id" yaml:"id" example:"1"`
+	URL       string   `json:"url" xml:"url" yaml:"url" example:"https://example.com/hooks/posts"`
+	Events    []string `json:"events" xml:"events>event" yaml:"events" example:"post.created,post.updated"`
+	Active    bool     `json:"active" xml:"active" yaml:"active" example:"true"`
+	Secret    string   `json:"secret,omitempty" xml:"secret,omitempty" yaml:"secret,omitempty" example:"8c1f0e4b9a7d..."`
+	CreatedAt string   `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt string   `json:"updated_at" xml:"updated_at" yaml:"updated_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// WebhookDelivery represents one event sent to a webhook subscription
+type JsonWebhookDelivery struct {
+	ID             uint    `json:"id" xml:"id" yaml:"id" example:"1"`
+	SubscriptionID uint    `json:"subscription_id" xml:"subscription_id" yaml:"subscription_id" example:"1"`
+	EventID        string  `json:"event_id" xml:"event_id" yaml:"event_id" example:"3f2b8c0d9e1a4b5c6d7e8f9a0b1c2d3e"`
+	EventType      string  `json:"event_type" xml:"event_type" yaml:"event_type" example:"post.created"`
+	Status         string  `json:"status" xml:"status" yaml:"status" example:"pending"`
+	Attempts       int     `json:"attempts" xml:"attempts" yaml:"attempts" example:"2"`
+	NextAttemptAt  *string `json:"next_attempt_at,omitempty" xml:"next_attempt_at,omitempty" yaml:"next_attempt_at,omitempty" example:"2023-01-01T00:01:00Z"`
+	LastAttemptAt  *string `json:"last_attempt_at,omitempty" xml:"last_attempt_at,omitempty" yaml:"last_attempt_at,omitempty" example:"2023-01-01T00:00:30Z"`
+	ResponseStatus int     `json:"response_status,omitempty" xml:"response_status,omitempty" yaml:"response_status,omitempty" example:"503"`
+	LastError      string  `json:"last_error,omitempty" xml:"last_error,omitempty" yaml:"last_error,omitempty" example:"unexpected status 503"`
+	DeliveredAt    *string `json:"delivered_at,omitempty" xml:"delivered_at,omitempty" yaml:"delivered_at,omitempty" example:"2023-01-01T00:01:00Z"`
+	Payload        string  `json:"payload" xml:"payload" yaml:"payload" example:"{\"id\":\"3f2b...\",\"type\":\"post.created\",\"data\":{}}"`
+	CreatedAt      string  `json:"created_at" xml:"created_at" yaml:"created_at" example:"2023-01-01T00:00:00Z"`
 }
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPostSlugLength = 200
+	fallbackPostSlug  = "post"
+)
+
+// PostSlug is a slug a post used to have. Former slugs keep pointing at the post so that old
+// links can be redirected to its current slug.
+type PostSlug struct {
+	Slug      string `gorm:"primaryKey;size:255"`
+	PostID    uint   `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// Slugify lowercases name and joins its letters and digits with single dashes. Letters of every
+// script are kept, and name is normalized first so that composed and decomposed accents agree.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(norm.NFC.String(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// postSlugBase is the slug a title asks for, cut at a dash to fit the column once a counter is appended
+func postSlugBase(title string) string {
+	slug := Slugify(title)
+	if slug == "" {
+		return fallbackPostSlug
+	}
+	if len(slug) <= maxPostSlugLength {
+		return slug
+	}
+	cut := strings.ToValidUTF8(slug[:maxPostSlugLength], "")
+	if i := strings.LastIndexByte(cut, '-'); i > 0 {
+		cut = cut[:i]
+	}
+	return cut
+}
+
+// uniquePostSlug returns base, or else the first of base-2, base-3, ... that no other post uses as
+// its current or a former slug. Posts asking for the same base take turns through an advisory
+// lock held until the transaction ends; the unique index on posts.slug is the last line of defence.
+func uniquePostSlug(tx *gorm.DB, base string, postID uint) (string, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "post_slug:"+base).Error; err != nil {
+		return "", err
+	}
+
+	// slugs hold only letters, digits and dashes, so base needs no LIKE escaping
+	var taken []string
+	err := tx.Raw(`SELECT slug FROM posts WHERE (slug = ? OR slug LIKE ?) AND id <> ?
+		UNION SELECT slug FROM post_slugs WHERE (slug = ? OR slug LIKE ?) AND post_id <> ?`,
+		base, base+"-%", postID, base, base+"-%", postID).Scan(&taken).Error
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool, len(taken))
+	for _, s := range taken {
+		used[s] = true
+	}
+
+	slug := base
+	for n := 2; used[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// assignPostSlug gives a post without a slug one derived from its title. It runs after the insert
+// so that posts created together in one batch see each other's slugs.
+func assignPostSlug(tx *gorm.DB, p *Post) error {
+	slug, err := uniquePostSlug(tx, postSlugBase(p.Title), p.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&Post{}).Where("id = ?", p.ID).UpdateColumn("slug", slug).Error; err != nil {
+		return err
+	}
+	p.Slug = &slug
+	return nil
+}
+
+// UpdatePostSlug follows a change of the post's title. When the title asks for a different slug
+// the post moves to it and the old one is kept as a former slug; a post can take back one of its
+// own former slugs.
+func UpdatePostSlug(tx *gorm.DB, p *Post) error {
+	slug, err := uniquePostSlug(tx, postSlugBase(p.Title), p.ID)
+	if err != nil || (p.Slug != nil && *p.Slug == slug) {
+		return err
+	}
+
+	if p.Slug != nil {
+		if err := tx.Create(&PostSlug{Slug: *p.Slug, PostID: p.ID}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("slug = ? AND post_id = ?", slug, p.ID).Delete(&PostSlug{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Post{}).Where("id = ?", p.ID).UpdateColumn("slug", slug).Error; err != nil {
+		return err
+	}
+	p.Slug = &slug
+	return nil
+}
+
+// backfillPostSlugs gives the posts created before posts had slugs one, oldest first
+func backfillPostSlugs(db *gorm.DB) error {
+	var posts []Post
+	return db.Unscoped().Select("id", "title").Where("slug IS NULL").Order("id").
+		FindInBatches(&posts, 500, func(tx *gorm.DB, batch int) error {
+			for i := range posts {
+				if err := assignPostSlug(db, &posts[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
@@ -0,0 +1,143 @@
+// Package poststream fans post change events out to the clients of GET /posts/stream. The events
+// themselves live in the post_events table; each server polls it and publishes new rows to its
+// own Hub, so a client sees every change whichever server it is connected to.
+package poststream
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"rest_api/models"
+)
+
+// Subscription receives the events its filter matches until it is unsubscribed or dropped
+type Subscription struct {
+	// Events delivers matching events in the order they were published
+	Events <-chan models.PostEvent
+	// Dropped is closed when the subscriber fell behind and was dropped; it should reconnect and
+	// resume from the last event it received
+	Dropped <-chan struct{}
+
+	events  chan models.PostEvent
+	dropped chan struct{}
+	match   func(models.PostEvent) bool
+}
+
+// Hub hands published events to its subscriptions
+type Hub struct {
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// NewHub returns a hub with no subscriptions
+func NewHub() *Hub {
+	return &Hub{subscriptions: map[*Subscription]struct{}{}}
+}
+
+// Subscribe registers a subscription for the events match accepts. Up to buffer events are held
+// for it; a subscriber that lets more pile up is dropped rather than holding up the others.
+func (h *Hub) Subscribe(buffer int, match func(models.PostEvent) bool) *Subscription {
+	s := &Subscription{
+		events:  make(chan models.PostEvent, buffer),
+		dropped: make(chan struct{}),
+		match:   match,
+	}
+	s.Events, s.Dropped = s.events, s.dropped
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes s; it is safe to call more than once and after s was dropped
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscriptions, s)
+}
+
+// Publish hands events to every subscription that matches them, without blocking
+func (h *Hub) Publish(events ...models.PostEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscriptions {
+		for _, e := range events {
+			if !s.match(e) {
+				continue
+			}
+			select {
+			case s.events <- e:
+				continue
+			default:
+			}
+			delete(h.subscriptions, s)
+			close(s.dropped)
+			break
+		}
+	}
+}
+
+// Len returns how many subscriptions the hub has
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscriptions)
+}
+
+// maxTrackedGap is the widest jump in IDs whose missing IDs are still waited for
+const maxTrackedGap = 1000
+
+// Cursor tracks how far a poller has read post_events. IDs come from a sequence and are handed out
+// when a row is inserted, not when it commits, so a row with a lower ID can become visible after a
+// higher one. The cursor remembers the IDs it skipped over and keeps asking for them for a grace
+// period, after which the transaction that took them is assumed to have rolled back.
+type Cursor struct {
+	last  uint64
+	grace time.Duration
+	gaps  map[uint64]time.Time
+}
+
+// NewCursor returns a cursor positioned after last
+func NewCursor(last uint64, grace time.Duration) *Cursor {
+	return &Cursor{last: last, grace: grace, gaps: map[uint64]time.Time{}}
+}
+
+// Last returns the highest ID seen
+func (c *Cursor) Last() uint64 { return c.last }
+
+// Gaps returns the skipped IDs that are still expected, lowest first
+func (c *Cursor) Gaps() []uint64 {
+	gaps := make([]uint64, 0, len(c.gaps))
+	for id := range c.gaps {
+		gaps = append(gaps, id)
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return gaps
+}
+
+// Observe records the IDs a poll returned, in ascending order, and forgets gaps older than the
+// grace period
+func (c *Cursor) Observe(ids []uint64, now time.Time) {
+	for _, id := range ids {
+		if _, ok := c.gaps[id]; ok {
+			delete(c.gaps, id)
+			continue
+		}
+		if id <= c.last {
+			continue
+		}
+		if id-c.last <= maxTrackedGap {
+			for missing := c.last + 1; missing < id; missing++ {
+				c.gaps[missing] = now
+			}
+		}
+		c.last = id
+	}
+	for id, seen := range c.gaps {
+		if now.Sub(seen) > c.grace {
+			delete(c.gaps, id)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package replay
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Main runs the replay subcommand and returns the process exit code: 0 when every request
+// succeeded and matched, 1 on errors or mismatches, 2 on bad usage. newHandler builds the
+// in-process engine and is only called when no -target is given.
+func Main(args []string, stdout io.Writer, newHandler func() http.Handler) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	file := fs.String("file", "", "JSONL file with recorded requests (required)")
+	target := fs.String("target", "", "base URL of a running server, e.g. http://localhost:3000 (default: in-process engine)")
+	concurrency := fs.Int("concurrency", 1, "number of parallel requests")
+	rate := fs.Float64("rate", 0, "maximum requests per second, 0 for unlimited")
+	dryRun := fs.Bool("dry-run", false, "parse and list the requests without sending them")
+	timeout := fs.Duration("timeout", 30*time.Second, "per-request timeout for -target")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(stdout, "replay: -file is required")
+		fs.Usage()
+		return 2
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(stdout, "replay: %v\n", err)
+		return 2
+	}
+	records, err := LoadRecords(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(stdout, "replay: %s: %v\n", *file, err)
+		return 2
+	}
+
+	if *dryRun {
+		for i, rec := range records {
+			fmt.Fprintf(stdout, "#%d %s %s (%d bytes)\n", i, rec.Method, rec.Path, len(rec.payload()))
+		}
+		fmt.Fprintf(stdout, "dry run: %d requests, nothing sent\n", len(records))
+		return 0
+	}
+
+	var transport Transport
+	if *target != "" {
+		transport = HTTPTransport(*target, &http.Client{Timeout: *timeout})
+	} else {
+		transport = HandlerTransport(newHandler())
+	}
+
+	results := Run(context.Background(), records, transport, Options{Concurrency: *concurrency, Rate: *rate})
+	summary := Summarize(results)
+	WriteReport(stdout, results, summary)
+	if summary.Failed() {
+		return 1
+	}
+	return 0
+}
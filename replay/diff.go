@@ -0,0 +1,95 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DiffJSON compares two JSON documents and describes every difference by its path.
+// Object keys listed in ignore are skipped at any depth. A body that is not valid JSON
+// is compared byte for byte.
+func DiffJSON(expected, actual []byte, ignore []string) []string {
+	var want, got any
+	errWant := json.Unmarshal(expected, &want)
+	errGot := json.Unmarshal(actual, &got)
+	if errWant != nil || errGot != nil {
+		if bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(actual)) {
+			return nil
+		}
+		return []string{fmt.Sprintf("body: expected %q, got %q", expected, actual)}
+	}
+
+	skip := make(map[string]bool, len(ignore))
+	for _, k := range ignore {
+		skip[k] = true
+	}
+	var diffs []string
+	diffValues("$", want, got, skip, &diffs)
+	return diffs
+}
+
+func diffValues(path string, want, got any, skip map[string]bool, diffs *[]string) {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected object, got %s", path, describe(got)))
+			return
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, seen := w[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if skip[k] {
+				continue
+			}
+			wv, inWant := w[k]
+			gv, inGot := g[k]
+			switch {
+			case !inGot:
+				*diffs = append(*diffs, fmt.Sprintf("%s.%s: missing", path, k))
+			case !inWant:
+				*diffs = append(*diffs, fmt.Sprintf("%s.%s: unexpected %s", path, k, describe(gv)))
+			default:
+				diffValues(path+"."+k, wv, gv, skip, diffs)
+			}
+		}
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected array, got %s", path, describe(got)))
+			return
+		}
+		if len(w) != len(g) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected %d items, got %d", path, len(w), len(g)))
+		}
+		for i := 0; i < min(len(w), len(g)); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), w[i], g[i], skip, diffs)
+		}
+	default:
+		if want != got {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", path, describe(want), describe(got)))
+		}
+	}
+}
+
+// describe renders a decoded JSON value compactly for diff messages
+func describe(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(b) > 80 {
+		return string(b[:77]) + "..."
+	}
+	return string(b)
+}
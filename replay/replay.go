@@ -0,0 +1,216 @@
+// Package replay reads recorded API requests from JSONL and replays them against a running
+// server or an in-process http.Handler, comparing responses with the expected ones.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is one recorded request, optionally with the response it is expected to produce
+type Record struct {
+	Name     string            `json:"name"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Headers  map[string]string `json:"headers"`
+	Body     json.RawMessage   `json:"body"`
+	Expected *Expected         `json:"expected"`
+}
+
+// Expected describes the response a record should get. Keys listed in Ignore are skipped
+// at any depth when comparing bodies (useful for ids and timestamps).
+type Expected struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+	Ignore []string        `json:"ignore"`
+}
+
+// Label names the record in reports
+func (r Record) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Method + " " + r.Path
+}
+
+// payload returns the bytes to send: a JSON string body is sent verbatim, any other JSON value as-is
+func (r Record) payload() []byte {
+	body := bytes.TrimSpace(r.Body)
+	if len(body) == 0 || string(body) == "null" {
+		return nil
+	}
+	if body[0] == '"' {
+		var s string
+		if err := json.Unmarshal(body, &s); err == nil {
+			return []byte(s)
+		}
+	}
+	return body
+}
+
+// LoadRecords parses JSONL records, skipping blank lines and lines starting with '#'
+func LoadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rec.Method = strings.ToUpper(rec.Method)
+		if rec.Method == "" || !strings.HasPrefix(rec.Path, "/") {
+			return nil, fmt.Errorf("line %d: method and an absolute path are required", line)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// Transport sends a request and returns the response status and body
+type Transport func(req *http.Request) (int, []byte, error)
+
+// HandlerTransport serves requests in-process with h
+func HandlerTransport(h http.Handler) Transport {
+	return func(req *http.Request) (int, []byte, error) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.Bytes(), nil
+	}
+}
+
+// HTTPTransport sends requests to the server at baseURL
+func HTTPTransport(baseURL string, client *http.Client) Transport {
+	base := strings.TrimRight(baseURL, "/")
+	return func(req *http.Request) (int, []byte, error) {
+		out := req.Clone(req.Context())
+		u, err := url.Parse(base + req.URL.RequestURI())
+		if err != nil {
+			return 0, nil, err
+		}
+		out.URL = u
+		out.Host = u.Host
+		out.RequestURI = ""
+		resp, err := client.Do(out)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, body, err
+	}
+}
+
+// Options controls how records are replayed
+type Options struct {
+	Concurrency int     // number of parallel workers, at least 1
+	Rate        float64 // requests per second across all workers, 0 means unlimited
+}
+
+// Result is the outcome of replaying one record
+type Result struct {
+	Index   int
+	Record  Record
+	Status  int
+	Latency time.Duration
+	Body    []byte
+	Err     error
+	Diffs   []string
+}
+
+// Mismatched reports whether the response differs from the record's expectation
+func (r Result) Mismatched() bool {
+	return r.Err == nil && len(r.Diffs) > 0
+}
+
+// Run replays records with transport and returns one result per record, in input order
+func Run(ctx context.Context, records []Record, transport Transport, opts Options) []Result {
+	results := make([]Result, len(records))
+	workers := max(opts.Concurrency, 1)
+
+	var limiter <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if limiter != nil {
+					select {
+					case <-limiter:
+					case <-ctx.Done():
+					}
+				}
+				results[i] = replayOne(ctx, i, records[i], transport)
+			}
+		}()
+	}
+
+	for i := range records {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// replayOne sends a single record and compares the response with its expectation
+func replayOne(ctx context.Context, index int, rec Record, transport Transport) Result {
+	res := Result{Index: index, Record: rec}
+	if err := ctx.Err(); err != nil {
+		res.Err = err
+		return res
+	}
+
+	payload := rec.payload()
+	req, err := http.NewRequestWithContext(ctx, rec.Method, rec.Path, bytes.NewReader(payload))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	for k, v := range rec.Headers {
+		req.Header.Set(k, v)
+	}
+	if payload != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	res.Status, res.Body, res.Err = transport(req)
+	res.Latency = time.Since(start)
+	if res.Err != nil || rec.Expected == nil {
+		return res
+	}
+
+	if rec.Expected.Status != 0 && rec.Expected.Status != res.Status {
+		res.Diffs = append(res.Diffs, fmt.Sprintf("status: expected %d, got %d", rec.Expected.Status, res.Status))
+	}
+	if len(bytes.TrimSpace(rec.Expected.Body)) > 0 {
+		res.Diffs = append(res.Diffs, DiffJSON(rec.Expected.Body, res.Body, rec.Expected.Ignore)...)
+	}
+	return res
+}
@@ -0,0 +1,89 @@
+package replay
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Summary aggregates replay results
+type Summary struct {
+	Total       int
+	Errors      int
+	Mismatches  int
+	StatusCodes map[int]int
+	LatencyMin  time.Duration
+	LatencyAvg  time.Duration
+	LatencyP50  time.Duration
+	LatencyP95  time.Duration
+	LatencyMax  time.Duration
+}
+
+// Failed reports whether any request errored or did not match its expectation
+func (s Summary) Failed() bool {
+	return s.Errors > 0 || s.Mismatches > 0
+}
+
+// Summarize computes status code counts and latency percentiles over results
+func Summarize(results []Result) Summary {
+	s := Summary{Total: len(results), StatusCodes: map[int]int{}}
+	latencies := make([]time.Duration, 0, len(results))
+	var total time.Duration
+	for _, r := range results {
+		if r.Err != nil {
+			s.Errors++
+			continue
+		}
+		if r.Mismatched() {
+			s.Mismatches++
+		}
+		s.StatusCodes[r.Status]++
+		latencies = append(latencies, r.Latency)
+		total += r.Latency
+	}
+	if len(latencies) == 0 {
+		return s
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.LatencyMin = latencies[0]
+	s.LatencyMax = latencies[len(latencies)-1]
+	s.LatencyAvg = total / time.Duration(len(latencies))
+	s.LatencyP50 = percentile(latencies, 50)
+	s.LatencyP95 = percentile(latencies, 95)
+	return s
+}
+
+// percentile uses the nearest-rank method on sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// WriteReport prints failures followed by the summary
+func WriteReport(w io.Writer, results []Result, s Summary) {
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "ERROR    #%d %s: %v\n", r.Index, r.Record.Label(), r.Err)
+		case r.Mismatched():
+			fmt.Fprintf(w, "MISMATCH #%d %s\n", r.Index, r.Record.Label())
+			for _, d := range r.Diffs {
+				fmt.Fprintf(w, "    %s\n", d)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nrequests: %d, errors: %d, mismatches: %d\n", s.Total, s.Errors, s.Mismatches)
+	codes := make([]int, 0, len(s.StatusCodes))
+	for code := range s.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %d: %d\n", code, s.StatusCodes[code])
+	}
+	fmt.Fprintf(w, "latency min %v, avg %v, p50 %v, p95 %v, max %v\n",
+		s.LatencyMin, s.LatencyAvg, s.LatencyP50, s.LatencyP95, s.LatencyMax)
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/graph"
+	errors_middleware "rest_api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Register adds the API routes to engine. It is shared by the server, the replay tool and the tests.
+func Register(engine *gin.Engine) {
+	// Routes that render JSON, XML, YAML or MessagePack depending on Accept and Content-Type
+	api := engine.Group("/", errors_middleware.ContentNegotiation())
+	api.POST("/users/", errors_middleware.Idempotency(), controllers.UsersCreate)
+	api.GET("/users/:id", errors_middleware.CacheControl(config.CacheControlPolicy("USERS_SHOW")), controllers.UsersShow)
+	api.PATCH("/users/:id", controllers.UsersUpdate)
+	api.GET("/users/:id/posts", controllers.UserPostsShow)
+	api.GET("/users/:id/feed", controllers.FeedShow)
+	api.GET("/users/:id/followers", controllers.FollowersIndex)
+	api.GET("/users/:id/following", controllers.FollowingIndex)
+	api.PUT("/users/:id/following/:followee_id", controllers.FollowsPut)
+	api.DELETE("/users/:id/following/:followee_id", controllers.FollowsDelete)
+	api.POST("/posts/", errors_middleware.Idempotency(), controllers.PostsCreate)
+	api.POST("/posts/bulk", controllers.PostsBulk)
+	api.GET("/posts/", errors_middleware.CacheControl(config.CacheControlPolicy("POSTS_INDEX")), controllers.PostsIndex)
+	api.GET("/posts/:id", errors_middleware.CacheControl(config.CacheControlPolicy("POSTS_SHOW")), controllers.PostsShow)
+	api.GET("/posts/by-slug/:slug", errors_middleware.CacheControl(config.CacheControlPolicy("POSTS_SHOW")), controllers.PostsBySlug)
+	api.PATCH("/posts/:id", controllers.PostsUpdate)
+	api.DELETE("/posts/:id", controllers.PostsDelete)
+	api.POST("/posts/:id/publish", controllers.PostsPublish)
+	api.POST("/posts/:id/schedule", controllers.PostsSchedule)
+	api.POST("/posts/:id/unpublish", controllers.PostsUnpublish)
+	api.POST("/posts/:id/archive", controllers.PostsArchive)
+	api.GET("/posts/:id/revisions", controllers.RevisionsIndex)
+	api.GET("/posts/:id/revisions/diff", controllers.RevisionsDiff)
+	api.GET("/posts/:id/revisions/:rev", controllers.RevisionsShow)
+	api.POST("/posts/:id/revisions/:rev/restore", controllers.RevisionsRestore)
+	api.GET("/posts/:id/comments", controllers.CommentsIndex)
+	api.POST("/posts/:id/comments", controllers.CommentsCreate)
+	api.GET("/posts/:id/attachments", controllers.AttachmentsIndex)
+	api.DELETE("/attachments/:id", controllers.AttachmentsDelete)
+	api.GET("/posts/:id/reactions", controllers.ReactionsIndex)
+	api.PUT("/posts/:id/reactions/:type", controllers.ReactionsPut)
+	api.DELETE("/posts/:id/reactions/:type", controllers.ReactionsDelete)
+	api.PATCH("/comments/:id", controllers.CommentsUpdate)
+	api.DELETE("/comments/:id", controllers.CommentsDelete)
+	api.GET("/tags", controllers.TagsIndex)
+	api.GET("/categories", controllers.CategoriesIndex)
+	api.GET("/tags/:slug/posts", controllers.TagPosts)
+	api.PATCH("/tags/:slug", errors_middleware.AdminOnly(), controllers.TagsRename)
+	api.POST("/tags/:slug/merge", errors_middleware.AdminOnly(), controllers.TagsMerge)
+	api.GET("/imports/:id", controllers.ImportsShow)
+	api.GET("/webhooks", errors_middleware.AdminOnly(), controllers.WebhooksIndex)
+	api.POST("/webhooks", errors_middleware.AdminOnly(), controllers.WebhooksCreate)
+	api.GET("/webhooks/:id", errors_middleware.AdminOnly(), controllers.WebhooksShow)
+	api.PATCH("/webhooks/:id", errors_middleware.AdminOnly(), controllers.WebhooksUpdate)
+	api.DELETE("/webhooks/:id", errors_middleware.AdminOnly(), controllers.WebhooksDelete)
+	api.GET("/webhooks/:id/deliveries", errors_middleware.AdminOnly(), controllers.WebhookDeliveriesIndex)
+	api.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", errors_middleware.AdminOnly(), controllers.WebhookDeliveriesRedeliver)
+	api.GET("/outbox/stats", errors_middleware.AdminOnly(), controllers.OutboxStatsShow)
+	api.GET("/cache/stats", errors_middleware.AdminOnly(), controllers.CacheStatsShow)
+
+	// Routes with their own formats
+	engine.POST("/posts/:id/attachments", controllers.AttachmentsCreate)
+	engine.GET("/attachments/:id", controllers.AttachmentsDownload)
+	engine.GET("/posts/stream", controllers.PostsStream)
+	engine.GET("/export/posts", controllers.ExportPosts)
+	engine.GET("/export/users", controllers.ExportUsers)
+	engine.POST("/imports", controllers.ImportsCreate)
+	engine.GET("/imports/:id/errors", controllers.ImportErrors)
+	engine.GET("/graphql", graph.Handler)
+	engine.POST("/graphql", graph.Handler)
+}
@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/rpc/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// postsServer implements pb.PostsServiceServer on top of the same operations as the /posts endpoints
+type postsServer struct {
+	pb.UnimplementedPostsServiceServer
+}
+
+func (s *postsServer) CreatePost(ctx context.Context, req *pb.CreatePostRequest) (*pb.PostResponse, error) {
+	post, err := controllers.CreatePost(controllers.CreatePostRequest{
+		Title:  req.GetTitle(),
+		Body:   req.GetBody(),
+		UserID: uint(req.GetUserId()),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.PostResponse{Post: mapPost(post)}, nil
+}
+
+func (s *postsServer) GetPost(ctx context.Context, req *pb.GetPostRequest) (*pb.PostResponse, error) {
+	var post models.Post
+	if err := config.DB.WithContext(ctx).Scopes(controllers.VisibleScope(0)).First(&post, req.GetId()).Error; err != nil {
+		return nil, status.Error(codes.NotFound, "Unable to find a post")
+	}
+	return &pb.PostResponse{Post: mapPost(post)}, nil
+}
+
+// ListPosts streams the matching posts through a DB cursor
+func (s *postsServer) ListPosts(req *pb.ListPostsRequest, stream pb.PostsService_ListPostsServer) error {
+	since, err := controllers.ParseUpdatedSince(req.GetUpdatedSince())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	db := config.DB.WithContext(stream.Context())
+	rows, err := db.Model(&models.Post{}).Scopes(controllers.PostsScope(req.GetUserId(), since), controllers.VisibleScope(0)).Order("id").Rows()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post models.Post
+		if err := db.ScanRows(rows, &post); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(mapPost(post)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+func (s *postsServer) UpdatePost(ctx context.Context, req *pb.UpdatePostRequest) (*pb.PostResponse, error) {
+	body := controllers.UpdatePostRequest{Title: req.GetTitle(), Body: req.GetBody()}
+	if req.UserId != nil {
+		userID := uint(req.GetUserId())
+		body.UserID = &userID
+	}
+
+	post, err := controllers.UpdatePost(req.GetId(), body)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.PostResponse{Post: mapPost(post)}, nil
+}
+
+func (s *postsServer) DeletePost(ctx context.Context, req *pb.DeletePostRequest) (*pb.DeletePostResponse, error) {
+	if err := controllers.DeletePost(req.GetId()); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.DeletePostResponse{Id: req.GetId()}, nil
+}
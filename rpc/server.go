@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"errors"
+	"net"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/rpc/pb"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// NewServer builds a gRPC server with the posts and users services, the standard health service
+// and server reflection
+func NewServer() *grpc.Server {
+	server := grpc.NewServer()
+	pb.RegisterPostsServiceServer(server, &postsServer{})
+	pb.RegisterUsersServiceServer(server, &usersServer{})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.PostsService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(pb.UsersService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
+
+// Serve listens on addr and serves gRPC until the listener fails
+func Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return NewServer().Serve(listener)
+}
+
+// statusError maps an error from the shared post and user operations to a gRPC status
+func statusError(err error) error {
+	var notFound controllers.NotFoundError
+	var invalid controllers.ValidationError
+	switch {
+	case errors.As(err, &notFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// mapPost converts DB model to protobuf message
+func mapPost(m models.Post) *pb.Post {
+	post := &pb.Post{
+		Id:        uint64(m.ID),
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: m.UpdatedAt.Format(time.RFC3339),
+		Title:     m.Title,
+		Body:      m.Body,
+		UserId:    uint64(m.UserID),
+	}
+	if m.DeletedAt.Valid {
+		deletedAt := m.DeletedAt.Time.Format(time.RFC3339)
+		post.DeletedAt = &deletedAt
+	}
+	return post
+}
+
+// mapPosts converts a slice of DB models to protobuf messages
+func mapPosts(posts []models.Post) []*pb.Post {
+	messages := make([]*pb.Post, 0, len(posts))
+	for _, p := range posts {
+		messages = append(messages, mapPost(p))
+	}
+	return messages
+}
+
+// mapUser converts DB model to protobuf message
+func mapUser(m models.User) *pb.User {
+	user := &pb.User{
+		Id:        uint64(m.ID),
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: m.UpdatedAt.Format(time.RFC3339),
+		Name:      m.Name,
+	}
+	if m.DeletedAt.Valid {
+		deletedAt := m.DeletedAt.Time.Format(time.RFC3339)
+		user.DeletedAt = &deletedAt
+	}
+	return user
+}
+
+// newPosts converts nested posts to the request type shared with the HTTP handlers
+func newPosts(posts []*pb.NewPost) []controllers.CreatePostRequest {
+	requests := make([]controllers.CreatePostRequest, 0, len(posts))
+	for _, p := range posts {
+		requests = append(requests, controllers.CreatePostRequest{Title: p.GetTitle(), Body: p.GetBody()})
+	}
+	return requests
+}
@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/rpc/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// usersServer implements pb.UsersServiceServer on top of the same operations as the /users endpoints
+type usersServer struct {
+	pb.UnimplementedUsersServiceServer
+}
+
+func (s *usersServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.UserPostsResponse, error) {
+	user, posts, err := controllers.CreateUser(controllers.CreateUserRequest{
+		Name:  req.GetName(),
+		Posts: newPosts(req.GetPosts()),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.UserPostsResponse{User: mapUser(user), Posts: mapPosts(posts)}, nil
+}
+
+func (s *usersServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.UserResponse, error) {
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, req.GetId()).Error; err != nil {
+		return nil, status.Error(codes.NotFound, "User not found")
+	}
+	return &pb.UserResponse{User: mapUser(user)}, nil
+}
+
+func (s *usersServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UserPostsResponse, error) {
+	removeIDs := make([]uint, 0, len(req.GetRemovePostIds()))
+	for _, id := range req.GetRemovePostIds() {
+		removeIDs = append(removeIDs, uint(id))
+	}
+
+	user, posts, err := controllers.UpdateUser(req.GetId(), controllers.UpdateUserRequest{
+		Name:          req.GetName(),
+		AddPosts:      newPosts(req.GetAddPosts()),
+		RemovePostIDs: removeIDs,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.UserPostsResponse{User: mapUser(user), Posts: mapPosts(posts)}, nil
+}
+
+// ListUserPosts streams a user's posts through a DB cursor
+func (s *usersServer) ListUserPosts(req *pb.ListUserPostsRequest, stream pb.UsersService_ListUserPostsServer) error {
+	db := config.DB.WithContext(stream.Context())
+
+	var user models.User
+	if err := db.First(&user, req.GetUserId()).Error; err != nil {
+		return status.Error(codes.NotFound, "User not found")
+	}
+
+	rows, err := db.Model(&models.Post{}).Where("user_id = ?", user.ID).Scopes(controllers.VisibleScope(0)).Order("id").Rows()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post models.Post
+		if err := db.ScanRows(rows, &post); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(mapPost(post)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
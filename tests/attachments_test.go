@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"rest_api/blobstore"
+	"rest_api/controllers"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pngBytes starts with the PNG signature, which is what type detection looks at
+var pngBytes = append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), bytes.Repeat([]byte{7}, 100)...)
+
+func uploadAttachment(router http.Handler, postID uint, filename string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", filename)
+	part.Write(content)
+	mw.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/posts/"+testutils.Itoa(postID)+"/attachments", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAttachments_UploadAndDownload(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+	controllers.SetBlobStore(blobstore.NewLocal(t.TempDir()))
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	// the declared name says text, the contents say PNG
+	w := uploadAttachment(router, p.ID, "diagram.txt", pngBytes)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.AttachmentResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "image/png", resp.Attachment.ContentType)
+	assert.Equal(t, "diagram.txt", resp.Attachment.Filename)
+	assert.Equal(t, int64(len(pngBytes)), resp.Attachment.Size)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/attachments", nil)
+	router.ServeHTTP(w, req)
+	var list controllers.AttachmentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Attachments, 1)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", resp.Attachment.URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, pngBytes, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", resp.Attachment.URL, nil)
+	req.Header.Set("Range", "bytes=1-3")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "PNG", w.Body.String())
+	assert.Equal(t, "bytes 1-3/"+testutils.Itoa(uint(len(pngBytes))), w.Header().Get("Content-Range"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", resp.Attachment.URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", resp.Attachment.URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAttachments_RejectsTypeAndSize(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+	controllers.SetBlobStore(blobstore.NewLocal(t.TempDir()))
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	// a script named like an image is still a script
+	w := uploadAttachment(router, p.ID, "cat.png", []byte("<html><script>alert(1)</script></html>"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	os.Setenv("ATTACHMENT_MAX_BYTES", "64")
+	defer os.Unsetenv("ATTACHMENT_MAX_BYTES")
+	w = uploadAttachment(router, p.ID, "big.png", pngBytes)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "larger than 64 bytes"))
+}
+
+func TestAttachments_ImageVariants(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+	controllers.SetBlobStore(blobstore.NewLocal(t.TempDir()))
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	var img bytes.Buffer
+	assert.NoError(t, png.Encode(&img, solidImage(800, 400, color.RGBA{0, 128, 255, 255})))
+
+	router := NewRouter()
+	w := uploadAttachment(router, p.ID, "wide.png", img.Bytes())
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.AttachmentResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "pending", resp.Attachment.VariantsStatus)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", resp.Attachment.URL+"?variant=thumb", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	n, err := controllers.ProcessPendingAttachments(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/attachments", nil)
+	router.ServeHTTP(w, req)
+	var list controllers.AttachmentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Attachments, 1)
+	got := list.Attachments[0]
+	assert.Equal(t, "ready", got.VariantsStatus)
+	assert.Equal(t, 800, got.Width)
+	assert.Equal(t, 400, got.Height)
+	assert.Equal(t, "#0080ff", got.AverageColor)
+	assert.Len(t, got.Blurhash, 28)
+	assert.Len(t, got.Variants, 3)
+	assert.Equal(t, "thumb", got.Variants[0].Name)
+	assert.Equal(t, 160, got.Variants[0].Width)
+	assert.Equal(t, 80, got.Variants[0].Height)
+	// medium is larger than the original, which is kept at its own size
+	assert.Equal(t, 800, got.Variants[2].Width)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", got.Variants[0].URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	cfg, err := png.DecodeConfig(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 160, cfg.Width)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", resp.Attachment.URL+"?variant=huge", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", resp.Attachment.URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAttachments_OriginalHasNoEXIF(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+	controllers.SetBlobStore(blobstore.NewLocal(t.TempDir()))
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	var img bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&img, solidImage(40, 20, color.RGBA{200, 0, 0, 255}), nil))
+	photo := withOrientation(img.Bytes(), 1)
+
+	router := NewRouter()
+	w := uploadAttachment(router, p.ID, "photo.jpg", photo)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.AttachmentResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "image/jpeg", resp.Attachment.ContentType)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", resp.Attachment.URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, bytes.Contains(w.Body.Bytes(), []byte("Exif\x00\x00")))
+	assert.Equal(t, resp.Attachment.Size, int64(w.Body.Len()))
+	sum := sha256.Sum256(w.Body.Bytes())
+	assert.Equal(t, hex.EncodeToString(sum[:]), resp.Attachment.SHA256)
+	_, err = jpeg.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+}
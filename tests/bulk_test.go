@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosts_Bulk_Atomic_OK(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	toUpdate, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	toDelete, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"operations":[
+		{"op":"create","title":"Bulk 1","body":"b1","user_id":%d},
+		{"op":"update","id":%d,"title":"Bulk Updated"},
+		{"op":"delete","id":%d},
+		{"op":"create","title":"Bulk 2","body":"b2","user_id":%d}
+	]}`, u.ID, toUpdate.ID, toDelete.ID, u.ID))
+	req, _ := http.NewRequest("POST", "/posts/bulk", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.BulkPostsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 4, len(resp.Results))
+	for _, r := range resp.Results {
+		assert.Equal(t, http.StatusOK, r.Status)
+	}
+	assert.Equal(t, "Bulk Updated", resp.Results[1].Post.Title)
+
+	var count int64
+	config.DB.Model(&models.Post{}).Where("user_id = ?", u.ID).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestPosts_Bulk_RunsInRequestOrder(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	existing, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"operations":[
+		{"op":"create","title":"Ordered 1","body":"b1","user_id":%d},
+		{"op":"update","id":%d,"title":"Ordered Update"},
+		{"op":"create","title":"Ordered 2","body":"b2","user_id":%d},
+		{"op":"delete","id":%d}
+	]}`, u.ID, existing.ID, u.ID, existing.ID))
+	req, _ := http.NewRequest("POST", "/posts/bulk", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.BulkPostsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Results, 4)
+
+	// the outbox records the operations in the order they ran
+	var types []string
+	config.DB.Model(&models.OutboxEvent{}).
+		Where("aggregate_type = ? AND aggregate_id IN ?", models.AggregatePost, []uint{resp.Results[0].ID, existing.ID, resp.Results[2].ID}).
+		Order("id").Pluck("type", &types)
+	assert.Equal(t, []string{"post.created", "post.updated", "post.created", "post.deleted"}, types)
+}
+
+func TestPosts_Bulk_Atomic_RollsBack(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"operations":[
+		{"op":"create","title":"Bulk 1","body":"b1","user_id":%d},
+		{"op":"delete","id":99999999}
+	]}`, u.ID))
+	req, _ := http.NewRequest("POST", "/posts/bulk", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp controllers.BulkPostsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusFailedDependency, resp.Results[0].Status)
+	assert.Equal(t, http.StatusNotFound, resp.Results[1].Status)
+
+	var count int64
+	config.DB.Model(&models.Post{}).Where("user_id = ?", u.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestPosts_Bulk_BestEffort_PerItemStatus(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"mode":"best_effort","operations":[
+		{"op":"create","title":"Good","body":"ok","user_id":%d},
+		{"op":"create","title":"Bad user","body":"fk","user_id":99999999},
+		{"op":"create","title":"Missing body","user_id":%d},
+		{"op":"update","id":99999999,"title":"Nope"}
+	]}`, u.ID, u.ID))
+	req, _ := http.NewRequest("POST", "/posts/bulk", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var resp controllers.BulkPostsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusOK, resp.Results[0].Status)
+	assert.Equal(t, http.StatusBadRequest, resp.Results[1].Status)
+	assert.Equal(t, http.StatusBadRequest, resp.Results[2].Status)
+	assert.Equal(t, http.StatusNotFound, resp.Results[3].Status)
+
+	var count int64
+	config.DB.Model(&models.Post{}).Where("user_id = ?", u.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"rest_api/cache"
+	"rest_api/controllers"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_LRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU[int](2, time.Minute)
+	lru.Set(ctx, "a", 1)
+	lru.Set(ctx, "b", 2)
+	_, _ = lru.Get(ctx, "a")
+	lru.Set(ctx, "c", 3)
+
+	_, ok := lru.Get(ctx, "b")
+	assert.False(t, ok, "b was used least recently")
+	v, ok := lru.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, lru.Len())
+
+	lru.Delete(ctx, "a", "missing")
+	_, ok = lru.Get(ctx, "a")
+	assert.False(t, ok)
+	lru.Clear(ctx)
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestCache_LRUExpires(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU[string](10, 20*time.Millisecond)
+	lru.Set(ctx, "k", "v")
+	_, ok := lru.Get(ctx, "k")
+	assert.True(t, ok)
+	time.Sleep(30 * time.Millisecond)
+	_, ok = lru.Get(ctx, "k")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Len())
+
+	off := cache.NewLRU[string](10, 0)
+	off.Set(ctx, "k", "v")
+	_, ok = off.Get(ctx, "k")
+	assert.False(t, ok)
+}
+
+func TestCache_ReadThroughSharesLoads(t *testing.T) {
+	ctx := context.Background()
+	reads := cache.NewReadThrough[string](cache.NewLRU[string](10, time.Minute))
+	release := make(chan struct{})
+	load := func(context.Context) (string, error) {
+		<-release
+		return "loaded", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := reads.Get(ctx, "k", load)
+			assert.NoError(t, err)
+			assert.Equal(t, "loaded", v)
+		}()
+	}
+	// let every reader miss before the load finishes
+	for reads.Stats().Misses < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	v, err := reads.Get(ctx, "k", load)
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded", v)
+	assert.Equal(t, cache.Stats{Hits: 1, Misses: 5, Loads: 1}, reads.Stats())
+}
+
+func TestCache_ReadThroughInvalidation(t *testing.T) {
+	ctx := context.Background()
+	reads := cache.NewReadThrough[int](cache.NewLRU[int](10, time.Minute))
+	value := 1
+	load := func(context.Context) (int, error) { return value, nil }
+
+	v, _ := reads.Get(ctx, "k", load)
+	assert.Equal(t, 1, v)
+	value = 2
+	v, _ = reads.Get(ctx, "k", load)
+	assert.Equal(t, 1, v, "served from the cache")
+	reads.Invalidate(ctx, "k")
+	v, _ = reads.Get(ctx, "k", load)
+	assert.Equal(t, 2, v)
+
+	// a load that overlaps an invalidation may have read the old value, so it is not stored
+	stale := func(context.Context) (int, error) {
+		reads.Invalidate(ctx, "other")
+		return 0, nil
+	}
+	reads.InvalidateAll(ctx)
+	v, _ = reads.Get(ctx, "k", stale)
+	assert.Equal(t, 0, v)
+	v, _ = reads.Get(ctx, "k", load)
+	assert.Equal(t, 2, v)
+
+	// errors are not cached
+	failed := errors.New("database unavailable")
+	reads.InvalidateAll(ctx)
+	_, err := reads.Get(ctx, "k", func(context.Context) (int, error) { return 0, failed })
+	assert.ErrorIs(t, err, failed)
+	v, err = reads.Get(ctx, "k", load)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+}
+
+func TestCache_StatsAdminOnly(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/cache/stats", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCache_PostsShowHitsAndInvalidates(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	router := NewRouter()
+	created := postRequest(t, router, "POST", "/posts/", `{"title":"Cached","body":"Body","user_id":`+testutils.Itoa(u.ID)+`}`)
+	url := "/posts/" + testutils.Itoa(created.Post.ID)
+
+	stats := func() controllers.CacheStatsResponse {
+		w := adminRequest(router, "GET", "/cache/stats", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp controllers.CacheStatsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	before := stats()
+
+	assert.Equal(t, "Cached", postRequest(t, router, "GET", url, "").Post.Title)
+	assert.Equal(t, "Cached", postRequest(t, router, "GET", url, "").Post.Title)
+	after := stats()
+	assert.Equal(t, before.Posts.Misses+1, after.Posts.Misses)
+	assert.Equal(t, before.Posts.Hits+1, after.Posts.Hits)
+
+	// the update removes the cached copy, so the next read sees it
+	postRequest(t, router, "PATCH", url, `{"title":"Changed"}`)
+	assert.Equal(t, "Changed", postRequest(t, router, "GET", url, "").Post.Title)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", url, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", url, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
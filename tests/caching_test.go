@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosts_Show_NotModified_ETag(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().WithName("Cache User").Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+	req.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestPosts_Show_NotModified_IfModifiedSince(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+	req.Header.Set("If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPosts_Index_ETagChangesWithCollection(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	_, err = pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/", nil)
+	req.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// A new post changes the fingerprint
+	_, err = pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/", nil)
+	req.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestPosts_Index_IfModifiedSinceSeesDelete(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	// the post was last edited a while ago, so the delete is clearly newer
+	assert.NoError(t, config.DB.Model(&models.Post{}).Where("id = ?", p.ID).
+		UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+
+	url := "/posts/?user_id=" + testutils.Itoa(u.ID)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, lastModified)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/posts/"+testutils.Itoa(p.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the deleted post must not be kept by a client revalidating with If-Modified-Since
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"id":`+testutils.Itoa(p.ID)+`,`)
+}
+
+func TestPosts_Index_IfModifiedSinceSeesPostLeavingFilter(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	kept, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	leaving, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	// both posts were last edited a while ago, so unpublishing one is clearly newer
+	assert.NoError(t, config.DB.Model(&models.Post{}).Where("id IN ?", []uint{kept.ID, leaving.ID}).
+		UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+
+	url := "/posts/?user_id=" + testutils.Itoa(u.ID)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, lastModified)
+
+	assert.Equal(t, http.StatusOK, transition(router, leaving.ID, "unpublish", "").Code)
+
+	// the post is no longer public, so a client revalidating with If-Modified-Since must not keep it
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":`+testutils.Itoa(kept.ID)+`,`)
+	assert.NotContains(t, w.Body.String(), `"id":`+testutils.Itoa(leaving.ID)+`,`)
+}
+
+func TestUsers_Show_NotModified_ETag(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/"+testutils.Itoa(u.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w2 := httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/users/"+testutils.Itoa(u.ID), nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	router.ServeHTTP(w2, req)
+	assert.Equal(t, http.StatusNotModified, w2.Code)
+}
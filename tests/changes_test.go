@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"rest_api/changes"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"gorm.io/gorm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChanges_Payload(t *testing.T) {
+	c := changes.FromEventType("post.updated", 12, 345)
+	assert.Equal(t, changes.Change{Kind: changes.KindPost, ID: 12, Op: changes.OpUpdated, Seq: 345}, c)
+
+	payload, err := changes.Encode(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"kind":"post","id":12,"op":"updated","seq":345}`, payload)
+	decoded, err := changes.Decode(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, c, decoded)
+
+	_, err = changes.Decode(`{"op":"updated"}`)
+	assert.Error(t, err)
+	_, err = changes.Decode(`{"kind":"post","op":"updated"}`)
+	assert.Error(t, err)
+	// changes to every post or user name no row
+	all, err := changes.Decode(`{"kind":"posts","op":"updated"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, changes.Change{Kind: changes.KindAllPosts, Op: changes.OpUpdated}, all)
+	_, err = changes.Decode(`not json`)
+	assert.Error(t, err)
+}
+
+func TestChanges_SubscribeAndUnsubscribe(t *testing.T) {
+	bus := changes.NewBus(nil)
+	var first, second []changes.Change
+	unsubscribe := bus.Subscribe(func(c changes.Change) { first = append(first, c) })
+	bus.Subscribe(func(c changes.Change) { second = append(second, c) })
+
+	user := changes.Change{Kind: changes.KindUser, ID: 1, Op: changes.OpCreated}
+	bus.Publish(user)
+	unsubscribe()
+	bus.Publish(user)
+
+	assert.Len(t, first, 1)
+	assert.Len(t, second, 2)
+}
+
+func TestChanges_PollsWhileDisconnected(t *testing.T) {
+	missed := changes.Change{Kind: changes.KindPost, ID: 7, Op: changes.OpDeleted, Seq: 99}
+	polled := make(chan time.Time, 10)
+	bus := changes.NewBus(func(_ context.Context, since time.Time) ([]changes.Change, error) {
+		polled <- since
+		return []changes.Change{missed}, nil
+	})
+	bus.PollInterval = 10 * time.Millisecond
+	bus.RetryBase = time.Hour
+	received := make(chan changes.Change, 10)
+	bus.Subscribe(func(c changes.Change) { received <- c })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := time.Now()
+	// nothing listens on port 1, so the bus cannot connect and falls back to polling
+	go bus.Run(ctx, "postgres://rest_api@127.0.0.1:1/rest_api?connect_timeout=1")
+
+	select {
+	case since := <-polled:
+		// polls start a little before the connection was lost
+		assert.True(t, since.Before(started))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bus did not poll while disconnected")
+	}
+	assert.Equal(t, missed, <-received)
+	assert.False(t, bus.Connected())
+}
+
+func TestChanges_ReactionClearsOtherServersCache(t *testing.T) {
+	// notifications are only sent on commit, so this test writes outside a test transaction and
+	// removes its rows when it is done
+	db := testutils.ConfigureTestDB()
+	dsn := os.Getenv("DB_CONNECTION_STRING")
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	defer func() {
+		db.Exec("DELETE FROM reactions WHERE post_id = ?", p.ID)
+		db.Exec("DELETE FROM reaction_counts WHERE post_id = ?", p.ID)
+		db.Unscoped().Delete(&models.Post{}, p.ID)
+		db.Unscoped().Delete(&models.User{}, u.ID)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// remote stands in for another server's bus, and this server's bus feeds its lookup caches
+	remote := changes.NewBus(func(context.Context, time.Time) ([]changes.Change, error) { return nil, nil })
+	heard := make(chan changes.Change, 10)
+	remote.Subscribe(func(c changes.Change) { heard <- c })
+	go remote.Run(ctx, dsn)
+	go controllers.RunChangeBus(ctx, dsn)
+	for deadline := time.Now().Add(5 * time.Second); !remote.Connected(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the bus did not connect")
+		}
+	}
+
+	// a reaction made through this server is announced to the others
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, putReaction(router, p.ID, u.ID, "like").Code)
+	var announced changes.Change
+	select {
+	case announced = <-heard:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reaction was not announced")
+	}
+	assert.Equal(t, changes.Change{Kind: changes.KindPost, ID: p.ID, Op: changes.OpUpdated}, announced)
+
+	reactions := func() []models.JsonReactionCount {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+		router.ServeHTTP(w, req)
+		var resp controllers.PostResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Post.ReactionCounts
+	}
+	assert.Equal(t, []models.JsonReactionCount{{Type: "like", Count: 1}}, reactions())
+
+	// the same reaction made through another server drops this server's cached copy; the
+	// announcement is repeated until this server's bus is listening
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO reactions (post_id, user_id, type, created_at) VALUES (?, ?, 'love', ?)", p.ID, u.ID, time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ReactionCount{PostID: p.ID, Type: "love", Count: 1}).Error
+	})
+	assert.NoError(t, err)
+	want := []models.JsonReactionCount{{Type: "like", Count: 1}, {Type: "love", Count: 1}}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		assert.NoError(t, db.Transaction(func(tx *gorm.DB) error { return changes.Notify(tx, announced) }))
+		got := reactions()
+		if assert.ObjectsAreEqual(want, got) {
+			break
+		}
+		if time.Now().After(deadline) {
+			assert.Equal(t, want, got, "the other server's reaction never reached the cache")
+			break
+		}
+	}
+}
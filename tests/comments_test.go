@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComments_Create_Reply_CountsOnPost(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	var cb testutils.CommentBuilder
+	parent, err := cb.New().WithPostID(p.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"body":"A reply","user_id":%d,"parent_id":%d}`, u.ID, parent.ID))
+	req, _ := http.NewRequest("POST", "/posts/"+testutils.Itoa(p.ID)+"/comments", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.CommentResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "A reply", resp.Comment.Body)
+	assert.Equal(t, parent.ID, *resp.Comment.ParentID)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+	router.ServeHTTP(w, req)
+	var postResp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &postResp))
+	assert.Equal(t, 2, postResp.Post.CommentCount)
+}
+
+func TestComments_Create_ParentOnOtherPost(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p1, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	p2, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	var cb testutils.CommentBuilder
+	other, err := cb.New().WithPostID(p2.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"body":"Wrong thread","user_id":%d,"parent_id":%d}`, u.ID, other.ID))
+	req, _ := http.NewRequest("POST", "/posts/"+testutils.Itoa(p1.ID)+"/comments", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestComments_Index_TreeAndFlat(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	var cb testutils.CommentBuilder
+	root, err := cb.New().WithBody("root").WithPostID(p.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	reply, err := cb.New().WithBody("reply").WithPostID(p.ID).WithUserID(u.ID).WithParentID(root.ID).Create()
+	assert.NoError(t, err)
+	_, err = cb.New().WithBody("nested").WithPostID(p.ID).WithUserID(u.ID).WithParentID(reply.ID).Create()
+	assert.NoError(t, err)
+	_, err = cb.New().WithBody("second").WithPostID(p.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/comments", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var tree controllers.CommentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	assert.Equal(t, 2, len(tree.Comments))
+	assert.Equal(t, "root", tree.Comments[0].Body)
+	assert.Equal(t, "reply", tree.Comments[0].Replies[0].Body)
+	assert.Equal(t, "nested", tree.Comments[0].Replies[0].Replies[0].Body)
+	assert.Equal(t, 2, tree.Comments[0].Replies[0].Replies[0].Depth)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/comments?format=flat", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var flat controllers.CommentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &flat))
+	var bodies []string
+	var depths []int
+	for _, c := range flat.Comments {
+		bodies = append(bodies, c.Body)
+		depths = append(depths, c.Depth)
+		assert.Empty(t, c.Replies)
+	}
+	assert.Equal(t, []string{"root", "reply", "nested", "second"}, bodies)
+	assert.Equal(t, []int{0, 1, 2, 0}, depths)
+}
+
+func TestComments_Delete_KeepsRepliesUnderPlaceholder(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	var cb testutils.CommentBuilder
+	root, err := cb.New().WithBody("root").WithPostID(p.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	_, err = cb.New().WithBody("reply").WithPostID(p.ID).WithUserID(u.ID).WithParentID(root.ID).Create()
+	assert.NoError(t, err)
+	leaf, err := cb.New().WithBody("leaf").WithPostID(p.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	for _, id := range []uint{root.ID, leaf.ID} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/comments/"+testutils.Itoa(id), nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/comments", nil)
+	router.ServeHTTP(w, req)
+	var tree controllers.CommentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	assert.Equal(t, 1, len(tree.Comments))
+	assert.NotNil(t, tree.Comments[0].DeletedAt)
+	assert.Equal(t, "", tree.Comments[0].Body)
+	assert.Equal(t, "reply", tree.Comments[0].Replies[0].Body)
+
+	var post models.Post
+	config.DB.First(&post, p.ID)
+	assert.Equal(t, 1, post.CommentCount)
+}
+
+func TestComments_Locked(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	var cb testutils.CommentBuilder
+	existing, err := cb.New().WithPostID(p.ID).WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/posts/"+testutils.Itoa(p.ID), bytes.NewReader([]byte(`{"comments_locked":true}`)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"body":"Too late","user_id":%d}`, u.ID))
+	req, _ = http.NewRequest("POST", "/posts/"+testutils.Itoa(p.ID)+"/comments", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/comments/"+testutils.Itoa(existing.ID), bytes.NewReader([]byte(`{"body":"Edited"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/controllers"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+)
+
+func TestContent_Users_Show_XML(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().WithName("Xml User").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/"+testutils.Itoa(u.ID), nil)
+	req.Header.Set("Accept", "application/xml")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/xml")
+
+	var resp controllers.UserResponse
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Xml User", resp.User.Name)
+}
+
+func TestContent_Users_Create_YAMLBody_MsgPackResponse(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader([]byte("name: Yaml User\nposts:\n  - title: Hello\n    body: World\n")))
+	req.Header.Set("Content-Type", "application/yaml")
+	req.Header.Set("Accept", "application/x-msgpack")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.UserPostsResponse
+	assert.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), new(codec.MsgpackHandle)).Decode(&resp))
+	assert.Equal(t, "Yaml User", resp.User.Name)
+	assert.Equal(t, 1, len(resp.Posts))
+}
+
+func TestContent_Posts_Index_YAML(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	_, err = pb.New().WithTitle("Yaml Post").WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/?user_id="+testutils.Itoa(u.ID), nil)
+	req.Header.Set("Accept", "application/x-yaml")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.PostsResponse
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, len(resp.Posts))
+	assert.Equal(t, "Yaml Post", resp.Posts[0].Title)
+}
+
+func TestContent_NotAcceptable(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/1", nil)
+	req.Header.Set("Accept", "application/pdf")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestContent_UnsupportedMediaType(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader([]byte("name=Plain")))
+	req.Header.Set("Content-Type", "text/plain")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
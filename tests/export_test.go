@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport_Posts_NDJSON(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	for i := 0; i < 3; i++ {
+		_, err = pb.New().WithUserID(u.ID).Create()
+		assert.NoError(t, err)
+	}
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export/posts?user_id="+testutils.Itoa(u.ID), nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/x-ndjson")
+
+	var posts []models.JsonPost
+	scanner := bufio.NewScanner(bytes.NewReader(w.Body.Bytes()))
+	for scanner.Scan() {
+		var p models.JsonPost
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &p))
+		posts = append(posts, p)
+	}
+	assert.Equal(t, 3, len(posts))
+
+	sum := sha256.Sum256(w.Body.Bytes())
+	trailer := w.Result().Trailer
+	assert.Equal(t, "3", trailer.Get("X-Export-Count"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), trailer.Get("X-Export-Sha256"))
+}
+
+func TestExport_Users_CSV_Gzip(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	_, err = ub.New().WithName("Exported, with comma").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export/users", nil)
+	req.Header.Set("Accept", "text/csv")
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	raw, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+
+	rows, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "created_at", "updated_at", "name"}, rows[0])
+	assert.Equal(t, "Exported, with comma", rows[len(rows)-1][3])
+
+	sum := sha256.Sum256(raw)
+	assert.Equal(t, hex.EncodeToString(sum[:]), w.Result().Trailer.Get("X-Export-Sha256"))
+}
+
+func TestExport_Posts_NotAcceptable(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export/posts", nil)
+	req.Header.Set("Accept", "application/pdf")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestExport_Posts_InvalidFilter(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export/posts?updated_since=yesterday", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/controllers"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func follow(router http.Handler, method string, followerID, followeeID uint) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, "/users/"+testutils.Itoa(followerID)+"/following/"+testutils.Itoa(followeeID), nil)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestFollows_Put_Delete_Counts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u1, err := ub.New().Create()
+	assert.NoError(t, err)
+	u2, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, follow(router, "PUT", u1.ID, u2.ID).Code)
+	w := follow(router, "PUT", u1.ID, u2.ID)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.FollowResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Follower.FollowingCount)
+	assert.Equal(t, 1, resp.Followee.FollowerCount)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/"+testutils.Itoa(u2.ID)+"/followers", nil)
+	router.ServeHTTP(w, req)
+	var list controllers.FollowsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Users, 1) {
+		assert.Equal(t, u1.ID, list.Users[0].ID)
+	}
+
+	assert.Equal(t, http.StatusOK, follow(router, "DELETE", u1.ID, u2.ID).Code)
+	w = follow(router, "DELETE", u1.ID, u2.ID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 0, resp.Follower.FollowingCount)
+	assert.Equal(t, 0, resp.Followee.FollowerCount)
+}
+
+func TestFollows_Put_Self(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusBadRequest, follow(router, "PUT", u.ID, u.ID).Code)
+}
+
+func TestFeed_FollowedPostsNewestFirst_Paginated(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	reader, err := ub.New().Create()
+	assert.NoError(t, err)
+	a, err := ub.New().Create()
+	assert.NoError(t, err)
+	b, err := ub.New().Create()
+	assert.NoError(t, err)
+	stranger, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	var pb testutils.PostBuilder
+	p1, err := pb.New().WithUserID(a.ID).Create()
+	assert.NoError(t, err)
+	_, err = pb.New().WithUserID(stranger.ID).Create()
+	assert.NoError(t, err)
+	p2, err := pb.New().WithUserID(b.ID).Create()
+	assert.NoError(t, err)
+	p3, err := pb.New().WithUserID(a.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, follow(router, "PUT", reader.ID, a.ID).Code)
+	assert.Equal(t, http.StatusOK, follow(router, "PUT", reader.ID, b.ID).Code)
+
+	var got []uint
+	path := "/users/" + testutils.Itoa(reader.ID) + "/feed?limit=2"
+	for page := 0; page < 3; page++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp controllers.FeedResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		for _, p := range resp.Posts {
+			got = append(got, p.ID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		path = "/users/" + testutils.Itoa(reader.ID) + "/feed?limit=2&cursor=" + resp.NextCursor
+	}
+	assert.Equal(t, []uint{p3.ID, p2.ID, p1.ID}, got)
+}
+
+func TestFeed_InvalidCursor(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/1/feed?cursor=not-a-cursor", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rest_api/config"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, query string, variables map[string]any) (int, graphQLResponse) {
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	NewRouter().ServeHTTP(w, req)
+
+	var resp graphQLResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+// countQueries counts the SELECTs run by GORM until the returned function is called
+func countQueries(db *gorm.DB) (*int, func()) {
+	n := new(int)
+	inc := func(*gorm.DB) { *n++ }
+	db.Callback().Query().After("gorm:query").Register("test:count_query", inc)
+	db.Callback().Row().After("gorm:row").Register("test:count_row", inc)
+	return n, func() {
+		db.Callback().Query().Remove("test:count_query")
+		db.Callback().Row().Remove("test:count_row")
+	}
+}
+
+func TestGraphQL_UsersWithPostsAndAuthors_Batched(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	var pb testutils.PostBuilder
+	for i := 0; i < 3; i++ {
+		u, err := ub.New().WithName(fmt.Sprintf("Graph User %d", i)).Create()
+		assert.NoError(t, err)
+		_, err = pb.New().WithTitle("older").WithUserID(u.ID).Create()
+		assert.NoError(t, err)
+		_, err = pb.New().WithTitle("newer").WithUserID(u.ID).Create()
+		assert.NoError(t, err)
+	}
+
+	queries, stop := countQueries(config.DB)
+	code, resp := postGraphQL(t, `{ users(first: 100) { name posts(first: 1) { title author { name } } } }`, nil)
+	stop()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.Errors)
+
+	var users []struct {
+		Name  string
+		Posts []struct {
+			Title  string
+			Author struct{ Name string }
+		}
+	}
+	assert.NoError(t, json.Unmarshal(resp.Data["users"], &users))
+	found := 0
+	for _, u := range users {
+		if !strings.HasPrefix(u.Name, "Graph User") {
+			continue
+		}
+		found++
+		assert.Equal(t, 1, len(u.Posts))
+		assert.Equal(t, "newer", u.Posts[0].Title)
+		assert.Equal(t, u.Name, u.Posts[0].Author.Name)
+	}
+	assert.Equal(t, 3, found)
+	// users, one page of posts for every user, one batch of authors
+	assert.Equal(t, 3, *queries)
+}
+
+func TestGraphQL_PostMutations(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	code, resp := postGraphQL(t, `mutation($userId: ID!) { createPost(title: "Graph", body: "QL", userId: $userId) { id title userId } }`,
+		map[string]any{"userId": testutils.Itoa(u.ID)})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.Errors)
+	var created struct{ ID, Title, UserID string }
+	assert.NoError(t, json.Unmarshal(resp.Data["createPost"], &created))
+	assert.Equal(t, "Graph", created.Title)
+
+	_, resp = postGraphQL(t, `mutation($id: ID!) { updatePost(id: $id, title: "Graph Updated") { title body } }`, map[string]any{"id": created.ID})
+	assert.Empty(t, resp.Errors)
+	var updated struct{ Title, Body string }
+	assert.NoError(t, json.Unmarshal(resp.Data["updatePost"], &updated))
+	assert.Equal(t, "Graph Updated", updated.Title)
+	assert.Equal(t, "QL", updated.Body)
+
+	_, resp = postGraphQL(t, `mutation($id: ID!) { deletePost(id: $id) }`, map[string]any{"id": created.ID})
+	assert.Empty(t, resp.Errors)
+
+	var count int64
+	config.DB.Model(&models.Post{}).Where("id = ?", created.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	_, resp = postGraphQL(t, `mutation($id: ID!) { deletePost(id: $id) }`, map[string]any{"id": created.ID})
+	assert.Equal(t, 1, len(resp.Errors))
+	assert.Equal(t, "Unable to delete a post", resp.Errors[0].Message)
+}
+
+func TestGraphQL_DepthLimit(t *testing.T) {
+	code, resp := postGraphQL(t, `{ posts { author { posts { author { posts { author { posts { author { name } } } } } } } } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, 1, len(resp.Errors))
+	assert.Contains(t, resp.Errors[0].Message, "depth")
+}
+
+func TestGraphQL_ComplexityLimit(t *testing.T) {
+	code, resp := postGraphQL(t, `query($n: Int) { users(first: $n) { posts(first: 100) { title body } } }`, map[string]any{"n": 100})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, 1, len(resp.Errors))
+	assert.Contains(t, resp.Errors[0].Message, "complexity")
+}
+
+func TestGraphQL_InvalidQuery(t *testing.T) {
+	code, resp := postGraphQL(t, `{ posts { password } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, 1, len(resp.Errors))
+}
+
+func TestGraphQL_Introspection(t *testing.T) {
+	code, resp := postGraphQL(t, `{ __schema { queryType { name } mutationType { name } } }`, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"queryType":{"name":"Query"},"mutationType":{"name":"Mutation"}}`, string(resp.Data["__schema"]))
+}
+
+func TestGraphQL_Playground(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/graphql", nil)
+	req.Header.Set("Accept", "text/html")
+	NewRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "graphiql")
+}
+
+func TestGraphQL_MutationOverGET(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", `/graphql?query=mutation{deletePost(id:"1")}`, nil)
+	NewRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"rest_api/rpc"
+	"rest_api/rpc/pb"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCClient serves rpc.NewServer on a random local port and returns a connection to it
+func newGRPCClient(t *testing.T) *grpc.ClientConn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := rpc.NewServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPC_UsersAndPosts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	conn := newGRPCClient(t)
+	users := pb.NewUsersServiceClient(conn)
+	posts := pb.NewPostsServiceClient(conn)
+	ctx := context.Background()
+
+	created, err := users.CreateUser(ctx, &pb.CreateUserRequest{
+		Name:  "Rpc User",
+		Posts: []*pb.NewPost{{Title: "First", Body: "one"}, {Title: "Second", Body: "two"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Rpc User", created.GetUser().GetName())
+	assert.Equal(t, 2, len(created.GetPosts()))
+	userID := created.GetUser().GetId()
+
+	got, err := users.GetUser(ctx, &pb.GetUserRequest{Id: userID})
+	assert.NoError(t, err)
+	assert.Equal(t, "Rpc User", got.GetUser().GetName())
+
+	post, err := posts.CreatePost(ctx, &pb.CreatePostRequest{Title: "Third", Body: "three", UserId: userID})
+	assert.NoError(t, err)
+
+	newUserID := userID
+	updated, err := posts.UpdatePost(ctx, &pb.UpdatePostRequest{Id: post.GetPost().GetId(), Title: "Third Updated", UserId: &newUserID})
+	assert.NoError(t, err)
+	assert.Equal(t, "Third Updated", updated.GetPost().GetTitle())
+	assert.Equal(t, "three", updated.GetPost().GetBody())
+
+	stream, err := posts.ListPosts(ctx, &pb.ListPostsRequest{UserId: userID})
+	assert.NoError(t, err)
+	var titles []string
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		titles = append(titles, p.GetTitle())
+	}
+	assert.Equal(t, []string{"First", "Second", "Third Updated"}, titles)
+
+	_, err = posts.DeletePost(ctx, &pb.DeletePostRequest{Id: post.GetPost().GetId()})
+	assert.NoError(t, err)
+	_, err = posts.GetPost(ctx, &pb.GetPostRequest{Id: post.GetPost().GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	userPosts, err := users.ListUserPosts(ctx, &pb.ListUserPostsRequest{UserId: userID})
+	assert.NoError(t, err)
+	count := 0
+	for {
+		_, err := userPosts.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestGRPC_UpdateUser_ForeignPost(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	owner, err := ub.New().Create()
+	assert.NoError(t, err)
+	other, err := ub.New().Create()
+	assert.NoError(t, err)
+	var postBuilder testutils.PostBuilder
+	foreign, err := postBuilder.New().WithUserID(other.ID).Create()
+	assert.NoError(t, err)
+
+	users := pb.NewUsersServiceClient(newGRPCClient(t))
+	_, err = users.UpdateUser(context.Background(), &pb.UpdateUserRequest{Id: uint64(owner.ID), RemovePostIds: []uint64{uint64(foreign.ID)}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = users.UpdateUser(context.Background(), &pb.UpdateUserRequest{Id: 0, Name: "Nobody"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPC_CreatePost_Invalid(t *testing.T) {
+	posts := pb.NewPostsServiceClient(newGRPCClient(t))
+	_, err := posts.CreatePost(context.Background(), &pb.CreatePostRequest{Body: "no title", UserId: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPC_Health(t *testing.T) {
+	health := healthpb.NewHealthClient(newGRPCClient(t))
+	resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "restapi.v1.PostsService"})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+}
+
+func TestGRPC_Reflection(t *testing.T) {
+	client := reflectionpb.NewServerReflectionClient(newGRPCClient(t))
+	stream, err := client.ServerReflectionInfo(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+
+	var names []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	assert.Contains(t, names, "restapi.v1.PostsService")
+	assert.Contains(t, names, "restapi.v1.UsersService")
+	assert.Contains(t, names, "grpc.health.v1.Health")
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest_api/config"
+	errors_middleware "rest_api/middleware"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosts_Create_IdempotentReplay(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	body := []byte(fmt.Sprintf(`{"title":"Once","body":"Only once","user_id":%d}`, u.ID))
+
+	var ids []uint
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/posts/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "post-replay-key")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		if i == 1 {
+			assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+		}
+
+		var resp struct {
+			Post models.JsonPost `json:"post"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		ids = append(ids, resp.Post.ID)
+	}
+	assert.Equal(t, ids[0], ids[1])
+
+	var count int64
+	config.DB.Model(&models.Post{}).Where("user_id = ?", u.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestUsers_Create_IdempotencyKeyReusedWithDifferentBody(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader([]byte(`{"name":"First"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "user-conflict-key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/", bytes.NewReader([]byte(`{"name":"Second"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "user-conflict-key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestUsers_Create_FailedRequestReleasesIdempotencyKey(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader([]byte(`{"name":""}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "user-failed-key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var count int64
+	config.DB.Model(&models.IdempotencyKey{}).Where("key = ?", "user-failed-key").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	calls := 0
+	router.POST("/flaky", errors_middleware.Idempotency(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("handler crashed")
+		}
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/flaky", bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "panic-key")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, send().Code)
+	var count int64
+	config.DB.Model(&models.IdempotencyKey{}).Where("key = ?", "panic-key").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// the retry runs the handler again instead of waiting for the crashed request
+	w := send()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotency_LapsedLeaseIsTakenOver(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	calls := 0
+	router.POST("/slow", errors_middleware.Idempotency(), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+	send := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/slow", bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// rows left in flight by servers that died mid-request: one whose lease has lapsed, one still held
+	lapsed, held := time.Now().Add(-time.Second), time.Now().Add(time.Minute)
+	expires := time.Now().Add(time.Hour)
+	assert.NoError(t, config.DB.Create(&[]models.IdempotencyKey{
+		{Key: "crashed-key", RequestHash: "unknown", Owner: "crashed", LockedUntil: &lapsed, ExpiresAt: expires},
+		{Key: "held-key", RequestHash: "unknown", Owner: "running", LockedUntil: &held, ExpiresAt: expires},
+	}).Error)
+
+	w := send("crashed-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, calls)
+	var row models.IdempotencyKey
+	assert.NoError(t, config.DB.First(&row, "key = ?", "crashed-key").Error)
+	assert.True(t, row.Completed)
+	assert.NotEqual(t, "crashed", row.Owner)
+
+	assert.Equal(t, http.StatusConflict, send("held-key").Code)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postImport(router http.Handler, query, contentType string, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/imports?"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestImports_UsersThenPostsByAuthorKey(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	users := "key,name\nimp-ada,Ada Lovelace\nimp-alan,Alan Turing\n"
+	w := postImport(router, "kind=users", "text/csv", []byte(users))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.ImportJobResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "completed", resp.Job.Status)
+	assert.Equal(t, 2, resp.Job.ImportedRows)
+
+	posts := `{"title":"Notes","body":"On the engine","author_key":"imp-ada"}
+{"title":"Computing","body":"Machinery and intelligence","author_key":"imp-alan"}
+`
+	w = postImport(router, "kind=posts", "application/x-ndjson", []byte(posts))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Job.ImportedRows)
+
+	var mapping models.UserExternalKey
+	assert.NoError(t, config.DB.First(&mapping, "key = ?", "imp-ada").Error)
+	var post models.Post
+	assert.NoError(t, config.DB.First(&post, "title = ?", "Notes").Error)
+	assert.Equal(t, mapping.UserID, post.UserID)
+}
+
+func TestImports_Atomic_FailedRowRollsBack(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	users := "key,name\nimp-ok,Imported OK\nimp-bad,\n"
+	w := postImport(router, "kind=users", "text/csv", []byte(users))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var resp controllers.ImportJobResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "failed", resp.Job.Status)
+	assert.Equal(t, 1, resp.Job.FailedRows)
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("name = ?", "Imported OK").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// The error report names the failing row
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/imports/"+testutils.Itoa(resp.Job.ID)+"/errors", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, "2", rows[1][0])
+}
+
+func TestImports_Chunked_SkipsFailedRows(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	id := testutils.Itoa(u.ID)
+	posts := "title,body,user_id\nA,a," + id + "\nB,," + id + "\nC,c," + id + "\nD,d,notanumber\nE,e," + id + "\n"
+	w := postImport(router, "kind=posts&mode=chunked&chunk_size=2", "text/csv", []byte(posts))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.ImportJobResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "completed", resp.Job.Status)
+	assert.Equal(t, 5, resp.Job.ProcessedRows)
+	assert.Equal(t, 3, resp.Job.ImportedRows)
+	assert.Equal(t, 2, resp.Job.FailedRows)
+
+	var count int64
+	config.DB.Model(&models.Post{}).Where("user_id = ?", u.ID).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestImports_DryRun_PersistsNothing(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "authors.csv")
+	part.Write([]byte("key,name\nimp-dry,Dry Run User\n"))
+	mw.Close()
+
+	w := postImport(router, "kind=users&dry_run=true", mw.FormDataContentType(), buf.Bytes())
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.ImportJobResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Job.DryRun)
+	assert.Equal(t, 1, resp.Job.ImportedRows)
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("name = ?", "Dry Run User").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestImports_InvalidKind(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	w := postImport(router, "kind=comments", "text/csv", []byte(strings.Repeat("a\n", 2)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createPost(t *testing.T, router http.Handler, body string) models.JsonPost {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/posts/", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Post
+}
+
+func transition(router http.Handler, postID uint, action, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/posts/"+testutils.Itoa(postID)+"/"+action, bytes.NewReader([]byte(body)))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLifecycle_Drafts_OnlyVisibleToOwner(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	owner, err := ub.New().Create()
+	assert.NoError(t, err)
+	other, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	draft := createPost(t, router, fmt.Sprintf(`{"title":"Draft","body":"WIP","user_id":%d,"status":"draft"}`, owner.ID))
+	assert.Equal(t, models.PostStatusDraft, draft.Status)
+	assert.Nil(t, draft.PublishedAt)
+
+	for _, tc := range []struct {
+		viewer uint
+		code   int
+		listed int
+	}{{0, http.StatusNotFound, 0}, {other.ID, http.StatusNotFound, 0}, {owner.ID, http.StatusOK, 1}} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(draft.ID), nil)
+		if tc.viewer != 0 {
+			req.Header.Set("X-User-ID", testutils.Itoa(tc.viewer))
+		}
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/posts/?user_id="+testutils.Itoa(owner.ID), nil)
+		if tc.viewer != 0 {
+			req.Header.Set("X-User-ID", testutils.Itoa(tc.viewer))
+		}
+		router.ServeHTTP(w, req)
+		var list controllers.PostsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.Len(t, list.Posts, tc.listed)
+	}
+
+	w := transition(router, draft.ID, "publish", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.PostStatusPublished, resp.Post.Status)
+	assert.NotNil(t, resp.Post.PublishedAt)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(draft.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLifecycle_Drafts_CommentsAndReactionsOnlyReachableByOwner(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	owner, err := ub.New().Create()
+	assert.NoError(t, err)
+	other, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	draft := createPost(t, router, fmt.Sprintf(`{"title":"Draft","body":"WIP","user_id":%d,"status":"draft"}`, owner.ID))
+	postURL := "/posts/" + testutils.Itoa(draft.ID)
+	send := func(viewer uint, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if viewer != 0 {
+			req.Header.Set("X-User-ID", testutils.Itoa(viewer))
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(owner.ID, "POST", postURL+"/comments", fmt.Sprintf(`{"body":"Note to self","user_id":%d}`, owner.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created controllers.CommentResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	commentURL := "/comments/" + testutils.Itoa(created.Comment.ID)
+
+	for _, viewer := range []uint{0, other.ID} {
+		assert.Equal(t, http.StatusNotFound, send(viewer, "GET", postURL+"/comments", "").Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer, "POST", postURL+"/comments", fmt.Sprintf(`{"body":"Found it","user_id":%d}`, other.ID)).Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer, "PATCH", commentURL, `{"body":"Changed"}`).Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer, "GET", postURL+"/reactions", "").Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer, "PUT", postURL+"/reactions/like", fmt.Sprintf(`{"user_id":%d}`, other.ID)).Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer, "DELETE", postURL+"/reactions/like?user_id="+testutils.Itoa(other.ID), "").Code)
+	}
+
+	assert.Equal(t, http.StatusOK, send(owner.ID, "GET", postURL+"/comments", "").Code)
+	assert.Equal(t, http.StatusOK, send(owner.ID, "PUT", postURL+"/reactions/like", fmt.Sprintf(`{"user_id":%d}`, owner.ID)).Code)
+	assert.Equal(t, http.StatusOK, send(owner.ID, "GET", postURL+"/reactions", "").Code)
+}
+
+func TestLifecycle_InvalidTransitions(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, http.StatusConflict, transition(router, p.ID, "schedule", `{"publish_at":"`+future+`"}`).Code)
+	assert.Equal(t, http.StatusOK, transition(router, p.ID, "archive", "").Code)
+	assert.Equal(t, http.StatusConflict, transition(router, p.ID, "publish", "").Code)
+	assert.Equal(t, http.StatusOK, transition(router, p.ID, "unpublish", "").Code)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, http.StatusBadRequest, transition(router, p.ID, "schedule", `{"publish_at":"`+past+`"}`).Code)
+	assert.Equal(t, http.StatusNotFound, transition(router, p.ID+1000, "publish", "").Code)
+}
+
+func TestLifecycle_Scheduler_PublishesDuePosts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	scheduled := createPost(t, router, fmt.Sprintf(`{"title":"Later","body":"Soon","user_id":%d,"status":"scheduled","publish_at":"%s"}`, u.ID, publishAt.Format(time.RFC3339)))
+	assert.Equal(t, models.PostStatusScheduled, scheduled.Status)
+
+	n, err := controllers.PublishDuePosts(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	n, err = controllers.PublishDuePosts(publishAt.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(scheduled.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.PostStatusPublished, resp.Post.Status)
+	assert.Equal(t, publishAt.Format(time.RFC3339), *resp.Post.PublishedAt)
+}
+
+func TestLifecycle_Schedule_RequiresPublishAt(t *testing.T) {
+	router := NewRouter()
+	w := transition(router, 1, "schedule", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/controllers"
+	"rest_api/markdown"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdown_Render_GFMAndTOC(t *testing.T) {
+	rendered, err := markdown.Render("# Intro\n\nSome *text*.\n\n## Getting `started`\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done\n")
+	assert.NoError(t, err)
+
+	assert.Contains(t, rendered.HTML, `<h1 id="intro">Intro</h1>`)
+	assert.Contains(t, rendered.HTML, `<h2 id="getting-started">`)
+	assert.Contains(t, rendered.HTML, "<em>text</em>")
+	assert.Contains(t, rendered.HTML, "<table>")
+	assert.Contains(t, rendered.HTML, `type="checkbox"`)
+	assert.Equal(t, []markdown.Heading{
+		{Level: 1, Text: "Intro", ID: "intro"},
+		{Level: 2, Text: "Getting started", ID: "getting-started"},
+	}, rendered.TOC)
+}
+
+func TestMarkdown_Render_Sanitizes(t *testing.T) {
+	rendered, err := markdown.Render("<script>alert(1)</script>\n\n[click](javascript:alert(1)) <img src=x onerror=alert(1)>\n")
+	assert.NoError(t, err)
+
+	assert.NotContains(t, rendered.HTML, "<script")
+	assert.NotContains(t, rendered.HTML, "javascript:")
+	assert.NotContains(t, rendered.HTML, "onerror")
+	assert.Contains(t, rendered.HTML, "click")
+}
+
+func TestMarkdown_Cache_RendersOncePerSource(t *testing.T) {
+	cache := markdown.NewCache(2)
+
+	first, err := cache.Render("# One")
+	assert.NoError(t, err)
+	again, err := cache.Render("# One")
+	assert.NoError(t, err)
+	assert.Equal(t, first, again)
+	assert.Equal(t, 1, cache.Len())
+
+	_, _ = cache.Render("# Two")
+	_, _ = cache.Render("# Three")
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestMarkdown_PostsShow_InvalidFormat(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/1?format=pdf", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMarkdown_PostsShow_FormatHTML(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).WithBody("## Setup\n\nRun **it**.").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/posts/%d?format=html", p.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "## Setup\n\nRun **it**.", resp.Post.Body)
+	assert.Contains(t, resp.Post.BodyHTML, `<h2 id="setup">Setup</h2>`)
+	assert.Contains(t, resp.Post.BodyHTML, "<strong>it</strong>")
+	assert.Equal(t, []markdown.Heading{{Level: 2, Text: "Setup", ID: "setup"}}, resp.Post.TOC)
+	htmlETag := w.Header().Get("ETag")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/posts/%d", p.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "body_html")
+	assert.NotEqual(t, htmlETag, w.Header().Get("ETag"))
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// failOutboxFor makes the test outbox handler fail the events of the post with this ID
+var failOutboxFor uint
+
+func init() {
+	controllers.RegisterOutboxHandler("test", func(_ *gorm.DB, event models.OutboxEvent) error {
+		if event.AggregateType == models.AggregatePost && event.AggregateID == failOutboxFor {
+			return errors.New("handler unavailable")
+		}
+		return nil
+	})
+}
+
+func TestOutbox_StatsAdminOnly(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/outbox/stats", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// postRequest makes a request with a JSON body and returns the decoded post of the response
+func postRequest(t *testing.T, router http.Handler, method, url, body string) controllers.PostResponse {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.PostResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestOutbox_RelaysInOrderAndRetries(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	t.Setenv("OUTBOX_RETRY_BASE", "50ms")
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+	defer func() { failOutboxFor = 0 }()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	router := NewRouter()
+	created := postRequest(t, router, "POST", "/posts/", `{"title":"Outboxed","body":"Body","user_id":`+testutils.Itoa(u.ID)+`}`)
+	postID := created.Post.ID
+	postRequest(t, router, "PATCH", "/posts/"+testutils.Itoa(postID), `{"title":"Outboxed again"}`)
+
+	// both events were written with the changes and wait for the relay
+	var events []models.OutboxEvent
+	assert.NoError(t, config.DB.Where("aggregate_type = ? AND aggregate_id = ?", models.AggregatePost, postID).Order("id").Find(&events).Error)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "post.created", events[0].Type)
+	assert.Equal(t, "post.updated", events[1].Type)
+	assert.Equal(t, models.OutboxPending, events[0].Status)
+
+	w := adminRequest(router, "GET", "/outbox/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats controllers.OutboxStatsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.GreaterOrEqual(t, stats.Pending, int64(2))
+	assert.Greater(t, stats.LagSeconds, 0.0)
+
+	// the first event fails; the second waits behind it instead of overtaking it
+	failOutboxFor = postID
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, config.DB.Where("aggregate_type = ? AND aggregate_id = ?", models.AggregatePost, postID).Order("id").Find(&events).Error)
+	assert.Equal(t, models.OutboxPending, events[0].Status)
+	assert.Equal(t, 1, events[0].Attempts)
+	assert.Equal(t, "test: handler unavailable", events[0].LastError)
+	assert.Equal(t, 0, events[1].Attempts)
+	// what the other handlers wrote for the failed attempt was rolled back
+	var streamed []models.PostEvent
+	assert.NoError(t, config.DB.Where("post_id = ?", postID).Order("id").Find(&streamed).Error)
+	assert.Empty(t, streamed)
+
+	failOutboxFor = 0
+	time.Sleep(100 * time.Millisecond)
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, config.DB.Where("aggregate_type = ? AND aggregate_id = ?", models.AggregatePost, postID).Order("id").Find(&events).Error)
+	for _, e := range events {
+		assert.Equal(t, models.OutboxDone, e.Status)
+		assert.NotNil(t, e.ProcessedAt)
+	}
+	assert.NoError(t, config.DB.Where("post_id = ?", postID).Order("id").Find(&streamed).Error)
+	if assert.Len(t, streamed, 2) {
+		assert.Equal(t, "post.created", streamed[0].Type)
+		assert.Equal(t, "post.updated", streamed[1].Type)
+		assert.Contains(t, streamed[1].Payload, `"title":"Outboxed again"`)
+	}
+}
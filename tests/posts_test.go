@@ -200,3 +200,33 @@ func TestPosts_Delete_NotFound(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
+
+func TestPosts_Index_FilterByUser(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	other, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	_, err = pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	_, err = pb.New().WithUserID(other.ID).Create()
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/?user_id="+testutils.Itoa(u.ID), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Posts []models.JsonPost `json:"posts"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, len(resp.Posts))
+	assert.Equal(t, u.ID, resp.Posts[0].UserID)
+}
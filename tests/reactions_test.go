@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func putReaction(router http.Handler, postID, userID uint, reactionType string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"user_id":%d}`, userID))
+	req, _ := http.NewRequest("PUT", "/posts/"+testutils.Itoa(postID)+"/reactions/"+reactionType, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReactions_Put_IsIdempotent(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u1, err := ub.New().Create()
+	assert.NoError(t, err)
+	u2, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u1.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, putReaction(router, p.ID, u1.ID, "like").Code)
+	assert.Equal(t, http.StatusOK, putReaction(router, p.ID, u1.ID, "like").Code)
+	assert.Equal(t, http.StatusOK, putReaction(router, p.ID, u1.ID, "love").Code)
+	w := putReaction(router, p.ID, u2.ID, "like")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.ReactionCountsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []models.JsonReactionCount{{Type: "like", Count: 2}, {Type: "love", Count: 1}}, resp.ReactionCounts)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID), nil)
+	router.ServeHTTP(w, req)
+	var postResp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &postResp))
+	assert.Equal(t, resp.ReactionCounts, postResp.Post.ReactionCounts)
+}
+
+func TestReactions_Delete_And_List(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u1, err := ub.New().Create()
+	assert.NoError(t, err)
+	u2, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u1.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, putReaction(router, p.ID, u1.ID, "laugh").Code)
+	assert.Equal(t, http.StatusOK, putReaction(router, p.ID, u2.ID, "laugh").Code)
+
+	path := "/posts/" + testutils.Itoa(p.ID) + "/reactions/laugh?user_id=" + testutils.Itoa(u1.ID)
+	var resp controllers.ReactionCountsResponse
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []models.JsonReactionCount{{Type: "laugh", Count: 1}}, resp.ReactionCounts)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/reactions", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list controllers.ReactionsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Reactions, 1) {
+		assert.Equal(t, u2.ID, list.Reactions[0].UserID)
+		assert.Equal(t, "laugh", list.Reactions[0].Type)
+	}
+}
+
+func TestReactions_Put_UnknownType(t *testing.T) {
+	router := NewRouter()
+	w := putReaction(router, 1, 1, "meh")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rest_api/replay"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const replayRecords = `
+# create a user, then list posts
+{"name":"create user","method":"POST","path":"/users/","body":{"name":"Replay User"},"expected":{"status":200,"body":{"user":{"name":"Replay User"},"posts":[]},"ignore":["id","created_at","updated_at"]}}
+{"name":"missing post","method":"GET","path":"/posts/99999999","expected":{"status":404}}
+{"name":"wrong expectation","method":"GET","path":"/posts/99999999","expected":{"status":200}}
+`
+
+func TestReplay_InProcess_SummaryAndDiffs(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	records, err := replay.LoadRecords(strings.NewReader(replayRecords))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(records))
+
+	results := replay.Run(context.Background(), records, replay.HandlerTransport(NewRouter()), replay.Options{Concurrency: 1})
+	summary := replay.Summarize(results)
+
+	assert.Equal(t, 3, summary.Total)
+	assert.Equal(t, 0, summary.Errors)
+	assert.Equal(t, 1, summary.Mismatches)
+	assert.Equal(t, 1, summary.StatusCodes[http.StatusOK])
+	assert.Equal(t, 2, summary.StatusCodes[http.StatusNotFound])
+	assert.False(t, results[0].Mismatched())
+	assert.True(t, results[2].Mismatched())
+	assert.Contains(t, results[2].Diffs[0], "expected 200, got 404")
+}
+
+func TestReplay_HTTPTarget(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+
+	records, err := replay.LoadRecords(strings.NewReader(
+		`{"method":"GET","path":"/users/99999999","expected":{"status":404,"body":{"error":"User not found"}}}`))
+	assert.NoError(t, err)
+
+	results := replay.Run(context.Background(), records, replay.HTTPTransport(server.URL, server.Client()), replay.Options{Concurrency: 2, Rate: 100})
+	summary := replay.Summarize(results)
+	assert.False(t, summary.Failed())
+}
+
+func TestReplay_DiffJSON(t *testing.T) {
+	diffs := replay.DiffJSON(
+		[]byte(`{"post":{"id":1,"title":"A","tags":["x"]}}`),
+		[]byte(`{"post":{"id":2,"title":"B","tags":["x","y"],"extra":true}}`),
+		[]string{"id"},
+	)
+	assert.Equal(t, []string{
+		"$.post.extra: unexpected true",
+		"$.post.tags: expected 1 items, got 2",
+		`$.post.title: expected "A", got "B"`,
+	}, diffs)
+}
+
+func TestReplay_LoadRecords_InvalidLine(t *testing.T) {
+	_, err := replay.LoadRecords(strings.NewReader("{\"method\":\"GET\",\"path\":\"/posts/\"}\n{\"method\":\"GET\"}\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
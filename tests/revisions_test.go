@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rest_api/controllers"
+	"rest_api/tests/testutils"
+	"rest_api/textdiff"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func patchPost(router http.Handler, postID, editorID uint, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/posts/"+testutils.Itoa(postID), bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", testutils.Itoa(editorID))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRevisions_Update_RecordsHistory(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	author, err := ub.New().Create()
+	assert.NoError(t, err)
+	editor, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(author.ID).WithBody("line one\nline two\n").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, patchPost(router, p.ID, editor.ID, `{"body":"line one\nline 2\n"}`).Code)
+	// changing only comments_locked does not add a revision
+	assert.Equal(t, http.StatusOK, patchPost(router, p.ID, editor.ID, `{"comments_locked":true}`).Code)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/revisions", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list controllers.RevisionsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Revisions, 2) {
+		assert.Equal(t, 2, list.Revisions[0].Number)
+		assert.Equal(t, editor.ID, *list.Revisions[0].EditorID)
+		assert.Equal(t, 1, list.Revisions[1].Number)
+		assert.Equal(t, author.ID, *list.Revisions[1].EditorID)
+		assert.Equal(t, "line one\nline two\n", list.Revisions[1].Body)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/revisions/diff", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var diff controllers.DiffResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 1, diff.From)
+	assert.Equal(t, 2, diff.To)
+	assert.Equal(t, "--- rev 1\n+++ rev 2\n@@ -1,2 +1,2 @@\n line one\n-line two\n+line 2\n", diff.Unified)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/revisions/diff?from=1&to=2&format=words", nil)
+	router.ServeHTTP(w, req)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Contains(t, diff.BodyEdits, textdiff.Edit{Op: textdiff.OpInsert, Text: "2"})
+}
+
+func TestRevisions_Restore_AddsRevision(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).WithTitle("Original").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	assert.Equal(t, http.StatusOK, patchPost(router, p.ID, u.ID, `{"title":"Vandalized"}`).Code)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/posts/"+testutils.Itoa(p.ID)+"/revisions/1/restore", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.RestoreRevisionResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Original", resp.Post.Title)
+	assert.Equal(t, 3, resp.Revision.Number)
+	assert.Equal(t, 1, *resp.Revision.RestoredFrom)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/"+testutils.Itoa(p.ID)+"/revisions/2", nil)
+	router.ServeHTTP(w, req)
+	var rev controllers.RevisionResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rev))
+	assert.Equal(t, "Vandalized", rev.Revision.Title)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/posts/"+testutils.Itoa(p.ID)+"/revisions/9/restore", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRevisions_Diff_InvalidFormat(t *testing.T) {
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/1/revisions/diff?format=side-by-side", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "unified"))
+}
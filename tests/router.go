@@ -1,8 +1,8 @@
 package tests
 
 import (
-	"rest_api/controllers"
 	errors_middleware "rest_api/middleware"
+	"rest_api/routes"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,14 +14,7 @@ func NewRouter() *gin.Engine {
 	r.Use(gin.Recovery())
 	r.Use(errors_middleware.JSONErrorMiddleware())
 
-	r.POST("/users/", controllers.UsersCreate)
-	r.GET("/users/:id", controllers.UsersShow)
-	r.GET("/users/:id/posts", controllers.UserPostsShow)
-	r.POST("/posts/", controllers.PostsCreate)
-	r.GET("/posts/", controllers.PostsIndex)
-	r.GET("/posts/:id", controllers.PostsShow)
-	r.PATCH("/posts/:id", controllers.PostsUpdate)
-	r.DELETE("/posts/:id", controllers.PostsDelete)
+	routes.Register(r)
 
 	return r
 }
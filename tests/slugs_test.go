@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugs_Slugify(t *testing.T) {
+	assert.Equal(t, "my-first-post", models.Slugify("  My First Post!  "))
+	assert.Equal(t, "café-crème", models.Slugify("Café — Crème"))
+	// decomposed accents give the same slug as composed ones
+	assert.Equal(t, "caf\u00e9", models.Slugify("Cafe\u0301"))
+	assert.Equal(t, "привет-мир", models.Slugify("Привет, мир"))
+	assert.Equal(t, "", models.Slugify("?!"))
+}
+
+func getBySlug(router http.Handler, slug string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/by-slug/"+slug, nil)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSlugs_Create_ResolvesCollisions(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	first, err := pb.New().WithUserID(u.ID).WithTitle("Slug Collision").Create()
+	assert.NoError(t, err)
+	second, err := pb.New().WithUserID(u.ID).WithTitle("slug collision?").Create()
+	assert.NoError(t, err)
+	third, err := pb.New().WithUserID(u.ID).WithTitle("Slug: collision").Create()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "slug-collision", *first.Slug)
+	assert.Equal(t, "slug-collision-2", *second.Slug)
+	assert.Equal(t, "slug-collision-3", *third.Slug)
+
+	router := NewRouter()
+	w := getBySlug(router, "slug-collision-2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, second.ID, resp.Post.ID)
+	assert.Equal(t, "slug-collision-2", resp.Post.Slug)
+
+	assert.Equal(t, http.StatusNotFound, getBySlug(router, "slug-collision-4").Code)
+}
+
+func TestSlugs_TitleChange_RedirectsFormerSlug(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).WithTitle("Original Slug Title").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := patchPost(router, p.ID, u.ID, `{"title":"Renamed Slug Title"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "renamed-slug-title", resp.Post.Slug)
+
+	w = getBySlug(router, "original-slug-title?format=html")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/posts/by-slug/renamed-slug-title?format=html", w.Header().Get("Location"))
+
+	// a post created later cannot take the former slug
+	other, err := pb.New().WithUserID(u.ID).WithTitle("Original Slug Title").Create()
+	assert.NoError(t, err)
+	assert.Equal(t, "original-slug-title-2", *other.Slug)
+
+	// going back to the old title takes the old slug back
+	assert.Equal(t, http.StatusOK, patchPost(router, p.ID, u.ID, `{"title":"Original Slug Title"}`).Code)
+	assert.Equal(t, http.StatusOK, getBySlug(router, "original-slug-title").Code)
+	w = getBySlug(router, "renamed-slug-title")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/posts/by-slug/original-slug-title", w.Header().Get("Location"))
+}
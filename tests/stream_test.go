@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/poststream"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostStream_HubFiltersAndDropsSlowSubscribers(t *testing.T) {
+	hub := poststream.NewHub()
+	published := func(e models.PostEvent) bool { return e.Status == models.PostStatusPublished }
+	fast := hub.Subscribe(4, published)
+	slow := hub.Subscribe(1, func(models.PostEvent) bool { return true })
+	assert.Equal(t, 2, hub.Len())
+
+	hub.Publish(
+		models.PostEvent{ID: 1, Status: models.PostStatusPublished},
+		models.PostEvent{ID: 2, Status: models.PostStatusDraft},
+		models.PostEvent{ID: 3, Status: models.PostStatusPublished},
+	)
+
+	assert.Equal(t, uint64(1), (<-fast.Events).ID)
+	assert.Equal(t, uint64(3), (<-fast.Events).ID)
+	select {
+	case <-fast.Dropped:
+		t.Fatal("a subscriber that keeps up must not be dropped")
+	default:
+	}
+
+	// the slow subscriber had room for one event and was dropped on the second
+	<-slow.Dropped
+	assert.Equal(t, uint64(1), (<-slow.Events).ID)
+	assert.Equal(t, 1, hub.Len())
+
+	hub.Unsubscribe(fast)
+	hub.Unsubscribe(slow)
+	assert.Equal(t, 0, hub.Len())
+}
+
+func TestPostStream_CursorWaitsForSkippedIDs(t *testing.T) {
+	now := time.Now()
+	cursor := poststream.NewCursor(10, time.Second)
+
+	cursor.Observe([]uint64{11, 14}, now)
+	assert.Equal(t, uint64(14), cursor.Last())
+	assert.Equal(t, []uint64{12, 13}, cursor.Gaps())
+
+	// 13 committed late; 12 never does
+	cursor.Observe([]uint64{13, 15}, now)
+	assert.Equal(t, uint64(15), cursor.Last())
+	assert.Equal(t, []uint64{12}, cursor.Gaps())
+
+	cursor.Observe(nil, now.Add(2*time.Second))
+	assert.Empty(t, cursor.Gaps())
+}
+
+func TestPostStream_InvalidParameters(t *testing.T) {
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/stream?user_id=abc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/posts/stream", nil)
+	req.Header.Set("Last-Event-ID", "-1")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// readSSEEvent reads one event from an event stream, returning its fields by name
+func readSSEEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields[name] = value
+	}
+}
+
+func TestPostStream_ResumeAndLive(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	var before uint64
+	config.DB.Model(&models.PostEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&before)
+	cursor := poststream.NewCursor(before, time.Second)
+
+	router := NewRouter()
+	create := func(title, status string) {
+		w := httptest.NewRecorder()
+		body := `{"title":"` + title + `","body":"Body","user_id":` + testutils.Itoa(u.ID) + `,"status":"` + status + `"}`
+		req, _ := http.NewRequest("POST", "/posts/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	create("Draft", "draft")
+	create("Missed", "published")
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/posts/stream?user_id="+testutils.Itoa(u.ID), nil)
+	req.Header.Set("Last-Event-ID", testutils.Itoa(uint(before)))
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	stream := bufio.NewReader(resp.Body)
+
+	// the draft is left out for anonymous viewers; the published post is replayed
+	event := readSSEEvent(t, stream)
+	assert.Equal(t, "post.created", event["event"])
+	assert.Contains(t, event["data"], `"title":"Missed"`)
+
+	create("Live", "published")
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+	_, err = controllers.PollPostEvents(cursor)
+	assert.NoError(t, err)
+
+	event = readSSEEvent(t, stream)
+	assert.Equal(t, "post.created", event["event"])
+	assert.Contains(t, event["data"], `"title":"Live"`)
+	assert.NotEmpty(t, event["id"])
+}
+
+func TestPostStream_UnpublishedPostIsRemoved(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	var before uint64
+	config.DB.Model(&models.PostEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&before)
+
+	router := NewRouter()
+	created := postRequest(t, router, "POST", "/posts/", `{"title":"Withdrawn","body":"Secret body","user_id":`+testutils.Itoa(u.ID)+`}`)
+	postRequest(t, router, "POST", "/posts/"+testutils.Itoa(created.Post.ID)+"/unpublish", "")
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	open := func(viewer uint) *bufio.Reader {
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/posts/stream?user_id="+testutils.Itoa(u.ID), nil)
+		req.Header.Set("Last-Event-ID", testutils.Itoa(uint(before)))
+		if viewer != 0 {
+			req.Header.Set("X-User-ID", testutils.Itoa(viewer))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return bufio.NewReader(resp.Body)
+	}
+
+	// anonymous viewers saw the post, so they learn it is gone, without its contents
+	stream := open(0)
+	event := readSSEEvent(t, stream)
+	assert.Equal(t, "post.created", event["event"])
+	event = readSSEEvent(t, stream)
+	assert.Equal(t, "post.removed", event["event"])
+	assert.JSONEq(t, `{"id":`+testutils.Itoa(created.Post.ID)+`}`, event["data"])
+
+	// the author still sees the update
+	stream = open(u.ID)
+	readSSEEvent(t, stream)
+	event = readSSEEvent(t, stream)
+	assert.Equal(t, "post.updated", event["event"])
+	assert.Contains(t, event["data"], `"status":"draft"`)
+	assert.Contains(t, event["data"], `"previous_status":"published"`)
+}
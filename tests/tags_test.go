@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags_CreatePost_UpsertsTags(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	_, err = pb.New().WithUserID(u.ID).WithTags("Go").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(fmt.Sprintf(`{"title":"Tagged","body":"Body","user_id":%d,"tags":["go","Databases"],"categories":["Engineering"]}`, u.ID))
+	req, _ := http.NewRequest("POST", "/posts/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"Databases", "Go"}, resp.Post.Tags)
+	assert.Equal(t, []string{"Engineering"}, resp.Post.Categories)
+
+	var count int64
+	config.DB.Model(&models.Tag{}).Where("slug = ?", "go").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestTags_Index_Counts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	_, err = pb.New().WithUserID(u.ID).WithTags("go", "sql").Create()
+	assert.NoError(t, err)
+	_, err = pb.New().WithUserID(u.ID).WithTags("go").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tags", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.TagsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	counts := map[string]int{}
+	for _, tag := range resp.Tags {
+		counts[tag.Slug] = tag.PostCount
+	}
+	assert.Equal(t, 2, counts["go"])
+	assert.Equal(t, 1, counts["sql"])
+}
+
+func TestTags_Posts_And_IndexFilter(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	tagged, err := pb.New().WithUserID(u.ID).WithTags("rare-tag").Create()
+	assert.NoError(t, err)
+	_, err = pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	for _, path := range []string{"/tags/rare-tag/posts", "/posts/?tag=rare-tag"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+
+		var resp controllers.PostsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		if assert.Len(t, resp.Posts, 1, path) {
+			assert.Equal(t, tagged.ID, resp.Posts[0].ID)
+			assert.Equal(t, []string{"rare-tag"}, resp.Posts[0].Tags)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tags/missing/posts", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTags_UpdatePost_ReplacesTags(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	p, err := pb.New().WithUserID(u.ID).WithTags("old").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/posts/"+testutils.Itoa(p.ID), bytes.NewReader([]byte(`{"tags":["new"]}`)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.PostResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"new"}, resp.Post.Tags)
+	assert.Equal(t, p.Title, resp.Post.Title)
+}
+
+func TestTags_RenameAndMerge_Admin(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	_, err = pb.New().WithUserID(u.ID).WithTags("postgres", "pg").Create()
+	assert.NoError(t, err)
+	_, err = pb.New().WithUserID(u.ID).WithTags("pg").Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/tags/postgres", bytes.NewReader([]byte(`{"name":"PostgreSQL"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp controllers.TagResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "postgresql", resp.Tag.Slug)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/tags/pg/merge", bytes.NewReader([]byte(`{"into":"postgresql"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "postgresql", resp.Tag.Slug)
+	assert.Equal(t, 2, resp.Tag.PostCount)
+
+	var count int64
+	config.DB.Model(&models.Tag{}).Where("slug = ?", "pg").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestTags_Rename_RequiresAdminToken(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+
+	router := NewRouter()
+	for _, auth := range []string{"", "Bearer wrong"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/tags/go", bytes.NewReader([]byte(`{"name":"Golang"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	"rest_api/config"
 	"rest_api/models"
+
+	"gorm.io/gorm"
 )
 
 // UserBuilder helps create a User row for tests and returns the created model.
@@ -37,6 +39,7 @@ type PostBuilder struct {
 	title  string
 	body   string
 	userID uint
+	tags   []string
 }
 
 // New initializes (or re-initializes) the builder with default values.
@@ -44,6 +47,7 @@ func (b *PostBuilder) New() *PostBuilder {
 	ts := time.Now().UTC().Format(time.RFC3339Nano)
 	b.title = "Test Title " + ts
 	b.body = "Test Body " + ts
+	b.tags = nil
 	return b
 }
 
@@ -62,9 +66,21 @@ func (b *PostBuilder) WithUserID(userID uint) *PostBuilder {
 	return b
 }
 
+func (b *PostBuilder) WithTags(names ...string) *PostBuilder {
+	b.tags = names
+	return b
+}
+
 // Create inserts the post into DB using the current config.DB (can be a tx) and returns it.
 func (b *PostBuilder) Create() (models.Post, error) {
 	p := models.Post{Title: b.title, Body: b.body, UserID: b.userID}
+	for _, name := range b.tags {
+		tag := models.Tag{Name: name, Slug: models.Slugify(name)}
+		if err := config.DB.Where(models.Tag{Slug: tag.Slug}).FirstOrCreate(&tag).Error; err != nil {
+			return models.Post{}, err
+		}
+		p.Tags = append(p.Tags, tag)
+	}
 	if err := config.DB.Create(&p).Error; err != nil {
 		return models.Post{}, err
 	}
@@ -85,3 +101,53 @@ func Itoa(u uint) string {
 	}
 	return string(buf[i:])
 }
+
+// CommentBuilder helps create a Comment row for tests and returns the created model.
+type CommentBuilder struct {
+	body     string
+	postID   uint
+	userID   uint
+	parentID *uint
+}
+
+// New initializes (or re-initializes) the builder with default values.
+func (b *CommentBuilder) New() *CommentBuilder {
+	b.body = "Test Comment " + time.Now().UTC().Format(time.RFC3339Nano)
+	b.parentID = nil
+	return b
+}
+
+func (b *CommentBuilder) WithBody(body string) *CommentBuilder {
+	b.body = body
+	return b
+}
+
+func (b *CommentBuilder) WithPostID(postID uint) *CommentBuilder {
+	b.postID = postID
+	return b
+}
+
+func (b *CommentBuilder) WithUserID(userID uint) *CommentBuilder {
+	b.userID = userID
+	return b
+}
+
+func (b *CommentBuilder) WithParentID(parentID uint) *CommentBuilder {
+	b.parentID = &parentID
+	return b
+}
+
+// Create inserts the comment into DB using the current config.DB (can be a tx), bumps the
+// post's comment count like the API does, and returns the comment.
+func (b *CommentBuilder) Create() (models.Comment, error) {
+	c := models.Comment{PostID: b.postID, UserID: b.userID, ParentID: b.parentID, Body: b.body}
+	if err := config.DB.Create(&c).Error; err != nil {
+		return models.Comment{}, err
+	}
+	err := config.DB.Model(&models.Post{}).Where("id = ?", b.postID).
+		Update("comment_count", gorm.Expr("comment_count + 1")).Error
+	if err != nil {
+		return models.Comment{}, err
+	}
+	return c, nil
+}
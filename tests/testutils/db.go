@@ -22,7 +22,8 @@ func ConfigureTestDB() *gorm.DB {
 	// Reuse existing connect logic from app
 	config.ConnectToDB()
 	// Ensure schema exists
-	_ = config.DB.AutoMigrate(&models.User{}, &models.Post{})
+	_ = config.DB.AutoMigrate(&models.User{}, &models.Tag{}, &models.Category{}, &models.Post{}, &models.PostRevision{}, &models.PostSlug{}, &models.Attachment{}, &models.AttachmentVariant{}, &models.IdempotencyKey{}, &models.UserExternalKey{}, &models.ImportJob{}, &models.Comment{}, &models.Reaction{}, &models.ReactionCount{}, &models.Follow{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.PostEvent{}, &models.OutboxEvent{})
+	_ = models.MigrateExtras(config.DB)
 
 	waitForPostgres(dsn)
 
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"rest_api/textdiff"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextDiff_Words(t *testing.T) {
+	edits := textdiff.Words("the quick brown fox", "the slow brown dog")
+	assert.Equal(t, []textdiff.Edit{
+		{Op: textdiff.OpEqual, Text: "the "},
+		{Op: textdiff.OpDelete, Text: "quick"},
+		{Op: textdiff.OpInsert, Text: "slow"},
+		{Op: textdiff.OpEqual, Text: " brown "},
+		{Op: textdiff.OpDelete, Text: "fox"},
+		{Op: textdiff.OpInsert, Text: "dog"},
+	}, edits)
+
+	var rebuilt strings.Builder
+	for _, e := range edits {
+		if e.Op != textdiff.OpDelete {
+			rebuilt.WriteString(e.Text)
+		}
+	}
+	assert.Equal(t, "the slow brown dog", rebuilt.String())
+}
+
+func TestTextDiff_Unified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	assert.Equal(t, `--- rev 1
++++ rev 2
+@@ -1,5 +1,5 @@
+ one
+ two
+-three
++THREE
+ four
+ five
+@@ -9,2 +9,3 @@
+ nine
+ ten
++eleven
+`, textdiff.Unified(a, b, "rev 1", "rev 2", 2))
+
+	assert.Equal(t, "", textdiff.Unified(a, a, "rev 1", "rev 1", 3))
+	assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+new\n", textdiff.Unified("", "new", "a", "b", 3))
+}
@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"rest_api/thumbnail"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF block carrying orientation right after the JPEG's start marker
+func withOrientation(jpegData []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpegData[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(jpegData[2:])
+	return out.Bytes()
+}
+
+func TestThumbnail_ResizeKeepsAspectRatio(t *testing.T) {
+	img := solidImage(1000, 500, color.RGBA{10, 20, 30, 255})
+
+	resized := thumbnail.Resize(img, 160)
+	assert.Equal(t, 160, resized.Bounds().Dx())
+	assert.Equal(t, 80, resized.Bounds().Dy())
+	assert.Equal(t, color.RGBA{10, 20, 30, 255}, resized.RGBAAt(40, 40))
+
+	tall := thumbnail.Resize(solidImage(300, 1200, color.RGBA{A: 255}), 480)
+	assert.Equal(t, 120, tall.Bounds().Dx())
+	assert.Equal(t, 480, tall.Bounds().Dy())
+
+	// images that already fit are not scaled up
+	small := solidImage(100, 50, color.RGBA{A: 255})
+	assert.Same(t, small, thumbnail.Resize(small, 160))
+}
+
+func TestThumbnail_LoadAppliesOrientation(t *testing.T) {
+	img := solidImage(40, 20, color.RGBA{200, 0, 0, 255})
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+
+	loaded, err := thumbnail.Load(bytes.NewReader(buf.Bytes()), 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", loaded.Format)
+	assert.Equal(t, 40, loaded.Width())
+	assert.Equal(t, 20, loaded.Height())
+
+	// orientation 6 is a camera held on its side: the upright image is taller than it is wide
+	loaded, err = thumbnail.Load(bytes.NewReader(withOrientation(buf.Bytes(), 6)), 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, loaded.Width())
+	assert.Equal(t, 40, loaded.Height())
+}
+
+func TestThumbnail_LoadRejectsTooManyPixels(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, solidImage(100, 100, color.RGBA{A: 255})))
+
+	_, err := thumbnail.Load(bytes.NewReader(buf.Bytes()), 9999)
+	assert.ErrorIs(t, err, thumbnail.ErrTooLarge)
+
+	_, err = thumbnail.Load(bytes.NewReader([]byte("not an image")), 9999)
+	assert.Error(t, err)
+}
+
+func TestThumbnail_EncodeKeepsTransparency(t *testing.T) {
+	img := solidImage(4, 4, color.RGBA{A: 0})
+
+	var buf bytes.Buffer
+	contentType, extension, err := thumbnail.Encode(&buf, img, "png")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+	assert.Equal(t, ".png", extension)
+
+	buf.Reset()
+	contentType, extension, err = thumbnail.Encode(&buf, img, "jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+	assert.Equal(t, ".jpg", extension)
+	_, format, err := image.DecodeConfig(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+}
+
+func TestThumbnail_BlurhashAndAverageColor(t *testing.T) {
+	img := solidImage(32, 24, color.RGBA{255, 0, 0, 255})
+
+	hash := thumbnail.Blurhash(img, 4, 3)
+	// 1 size flag, 1 maximum, 4 for the average color and 2 for each of the other 11 components
+	assert.Len(t, hash, 28)
+	// 4x3 components, then the average color: pure red
+	assert.Equal(t, "L", hash[:1])
+	assert.Equal(t, "TI:j", hash[2:6])
+
+	assert.Equal(t, "#ff0000", thumbnail.AverageColor(img))
+
+	// transparent pixels do not darken the average
+	half := solidImage(2, 1, color.RGBA{0, 0, 255, 255})
+	half.SetRGBA(1, 0, color.RGBA{})
+	assert.Equal(t, "#0000ff", thumbnail.AverageColor(half))
+}
+
+// withPNGChunk inserts a chunk right after the PNG's header chunk
+func withPNGChunk(pngData []byte, chunkType, data string) []byte {
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(len(data)))
+	chunk.WriteString(chunkType + data)
+	binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE([]byte(chunkType+data)))
+
+	// the signature is 8 bytes and the IHDR chunk 25
+	var out bytes.Buffer
+	out.Write(pngData[:33])
+	out.Write(chunk.Bytes())
+	out.Write(pngData[33:])
+	return out.Bytes()
+}
+
+func TestThumbnail_StripMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, solidImage(40, 20, color.RGBA{200, 0, 0, 255}), nil))
+	exif := []byte("Exif\x00\x00")
+
+	// an upright JPEG loses its EXIF block and keeps its encoded pixels
+	stripped, err := thumbnail.StripMetadata(withOrientation(buf.Bytes(), 1), 1<<20)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(stripped, exif))
+	assert.Equal(t, buf.Bytes(), stripped)
+
+	// a sideways one is turned upright before its orientation is dropped
+	stripped, err = thumbnail.StripMetadata(withOrientation(buf.Bytes(), 6), 1<<20)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(stripped, exif))
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+	assert.Equal(t, 20, cfg.Width)
+	assert.Equal(t, 40, cfg.Height)
+
+	buf.Reset()
+	assert.NoError(t, png.Encode(&buf, solidImage(4, 4, color.RGBA{A: 255})))
+	tagged := withPNGChunk(withPNGChunk(buf.Bytes(), "eXIf", "MM\x00\x2a"), "tEXt", "Author\x00Someone")
+	stripped, err = thumbnail.StripMetadata(tagged, 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), stripped)
+
+	// a WebP loses the chunk and the flag announcing it
+	riff := func(chunks ...string) []byte {
+		body := "WEBP" + strings.Join(chunks, "")
+		var out bytes.Buffer
+		out.WriteString("RIFF")
+		binary.Write(&out, binary.LittleEndian, uint32(len(body)))
+		out.WriteString(body)
+		return out.Bytes()
+	}
+	vp8x := func(flags byte) string { return "VP8X\x0a\x00\x00\x00" + string([]byte{flags}) + strings.Repeat("\x00", 9) }
+	pixels := "VP8L\x03\x00\x00\x00abc\x00"
+	stripped, err = thumbnail.StripMetadata(riff(vp8x(0x08), "EXIF\x04\x00\x00\x00MM\x00\x2a", pixels), 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, riff(vp8x(0), pixels), stripped)
+
+	_, err = thumbnail.StripMetadata([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 1<<20)
+	assert.ErrorIs(t, err, thumbnail.ErrMalformed)
+	other := []byte("%PDF-1.7")
+	stripped, err = thumbnail.StripMetadata(other, 1<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, other, stripped)
+}
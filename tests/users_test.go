@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
+	"rest_api/config"
 	"rest_api/models"
 	"rest_api/tests/testutils"
 
@@ -130,4 +132,172 @@ func TestUsersPosts_User_Not_Found(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
 
-}
\ No newline at end of file
+}
+
+func TestUsers_Create_WithPosts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(`{"name":"Nested","posts":[{"title":"P1","body":"B1"},{"title":"P2","body":"B2"}]}`)
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		User  models.JsonUser   `json:"user"`
+		Posts []models.JsonPost `json:"posts"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Nested", resp.User.Name)
+	assert.Equal(t, 2, len(resp.Posts))
+	for _, p := range resp.Posts {
+		assert.Equal(t, resp.User.ID, p.UserID)
+	}
+}
+
+func TestUsers_Create_WithInvalidPost_RollsBack(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	// the second post passes validation, but Postgres refuses the NUL byte in its body, so the
+	// posts fail to insert after the user has been
+	body := []byte(`{"name":"Rolled Back User","posts":[{"title":"Rolled Back P1","body":"B1"},{"title":"Rolled Back P2","body":"B\u00002"}]}`)
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("name = ?", "Rolled Back User").Count(&count)
+	assert.Equal(t, int64(0), count)
+	config.DB.Unscoped().Model(&models.Post{}).Where("title = ?", "Rolled Back P1").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestUsers_Update_AddAndRemovePosts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().WithName("Before").Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	keep, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+	remove, err := pb.New().WithUserID(u.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(`{"name":"After","add_posts":[{"title":"New","body":"Post"}],"remove_post_ids":[` + testutils.Itoa(remove.ID) + `]}`)
+	req, _ := http.NewRequest("PATCH", "/users/"+testutils.Itoa(u.ID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		User  models.JsonUser   `json:"user"`
+		Posts []models.JsonPost `json:"posts"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "After", resp.User.Name)
+	assert.Equal(t, 2, len(resp.Posts))
+	ids := []uint{resp.Posts[0].ID, resp.Posts[1].ID}
+	assert.Contains(t, ids, keep.ID)
+	assert.NotContains(t, ids, remove.ID)
+}
+
+func TestUsers_Update_RemoveForeignPost_RollsBack(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().WithName("Owner").Create()
+	assert.NoError(t, err)
+	other, err := ub.New().WithName("Other").Create()
+	assert.NoError(t, err)
+	var pb testutils.PostBuilder
+	foreign, err := pb.New().WithUserID(other.ID).Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	w := httptest.NewRecorder()
+	body := []byte(`{"name":"Renamed","remove_post_ids":[` + testutils.Itoa(foreign.ID) + `]}`)
+	req, _ := http.NewRequest("PATCH", "/users/"+testutils.Itoa(u.ID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var user models.User
+	assert.NoError(t, config.DB.First(&user, u.ID).Error)
+	assert.Equal(t, "Owner", user.Name)
+}
+
+func TestUsers_NestedScheduledPostWithoutPublishAt(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	scheduled := `{"title":"Unscheduled","body":"B","status":"scheduled"}`
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/users/", `{"name":"Scheduler","posts":[`+scheduled+`]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", "/users/"+testutils.Itoa(u.ID), `{"add_posts":[`+scheduled+`]}`).Code)
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("name = ?", "Scheduler").Count(&count)
+	assert.Equal(t, int64(0), count)
+	config.DB.Unscoped().Model(&models.Post{}).Where("title = ?", "Unscheduled").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestUsers_NestedPostsAreValidatedLikePosts(t *testing.T) {
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+
+	router := NewRouter()
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for _, post := range []string{
+		`{"title":"Invalid","body":"B","status":"bogus"}`,
+		`{"title":"Invalid","body":"B","status":"archived"}`,
+		`{"title":"Invalid","body":"B","tags":["` + strings.Repeat("t", 101) + `"]}`,
+		`{"title":"Invalid"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/users/", `{"name":"Invalid Nested","posts":[`+post+`]}`).Code, post)
+		assert.Equal(t, http.StatusBadRequest, send("PATCH", "/users/"+testutils.Itoa(u.ID), `{"add_posts":[`+post+`]}`).Code, post)
+	}
+
+	var count int64
+	config.DB.Unscoped().Model(&models.Post{}).Where("title = ?", "Invalid").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"rest_api/config"
+	"rest_api/controllers"
+	"rest_api/models"
+	"rest_api/tests/testutils"
+	"rest_api/webhooks"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks_SignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sig := webhooks.Sign("whsec-test-secret", 1700000000, body)
+	assert.Equal(t, "sha256=75a629d3168aceb43a64aa904f809f7fc6ef0f69bbcede0e82478e15389cbc27", sig)
+
+	assert.True(t, webhooks.Verify("whsec-test-secret", 1700000000, body, sig))
+	assert.False(t, webhooks.Verify("other-secret", 1700000000, body, sig))
+	assert.False(t, webhooks.Verify("whsec-test-secret", 1700000001, body, sig))
+	assert.False(t, webhooks.Verify("whsec-test-secret", 1700000000, []byte(`{"id":"2"}`), sig))
+	assert.False(t, webhooks.Verify("whsec-test-secret", 1700000000, body, "75a629d3"))
+}
+
+func TestWebhooks_Backoff(t *testing.T) {
+	base, limit := 30*time.Second, time.Hour
+	assert.Equal(t, 30*time.Second, webhooks.Backoff(1, base, limit))
+	assert.Equal(t, time.Minute, webhooks.Backoff(2, base, limit))
+	assert.Equal(t, 4*time.Minute, webhooks.Backoff(4, base, limit))
+	assert.Equal(t, time.Hour, webhooks.Backoff(8, base, limit))
+	assert.Equal(t, time.Hour, webhooks.Backoff(100, base, limit))
+}
+
+func TestWebhooks_AdminOnly(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	router := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/webhooks", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/webhooks", bytes.NewReader([]byte(`{"url":"http://example.com","events":["post.created"]}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer wrong")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// webhookReceiver records the deliveries it gets and answers each with the next status in line,
+// then 200 once they run out
+type webhookReceiver struct {
+	mu       sync.Mutex
+	secret   string
+	statuses []int
+	events   []string
+	verified []bool
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	ts, _ := strconv.ParseInt(req.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, req.Header.Get(webhooks.HeaderEvent))
+	r.verified = append(r.verified, webhooks.Verify(r.secret, ts, body, req.Header.Get(webhooks.HeaderSignature)))
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func adminRequest(router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWebhooks_DeliverRetryAndRedeliver(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	receiver := &webhookReceiver{secret: "receiver-secret-0123456789", statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	router := NewRouter()
+	w := adminRequest(router, "POST", "/webhooks", `{"url":"`+server.URL+`","events":["post.created","post.deleted"],"secret":"receiver-secret-0123456789"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var hook controllers.WebhookResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	assert.Equal(t, "receiver-secret-0123456789", hook.Webhook.Secret)
+	assert.True(t, hook.Webhook.Active)
+
+	var ub testutils.UserBuilder
+	u, err := ub.New().Create()
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/posts/", bytes.NewReader([]byte(`{"title":"Hooked","body":"Body","user_id":`+testutils.Itoa(u.ID)+`}`)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the event waits in the outbox until the relay queues its delivery
+	n, err := controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+
+	// the first attempt gets a 503 and is retried later
+	n, err = controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	deliveriesURL := "/webhooks/" + testutils.Itoa(hook.Webhook.ID) + "/deliveries"
+	w = adminRequest(router, "GET", deliveriesURL, "")
+	var log controllers.WebhookDeliveriesResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &log))
+	assert.Len(t, log.Deliveries, 1)
+	delivery := log.Deliveries[0]
+	assert.Equal(t, "post.created", delivery.EventType)
+	assert.Equal(t, models.DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+	assert.NotNil(t, delivery.NextAttemptAt)
+
+	var event struct {
+		Type string
+		Data controllers.PostResponse
+	}
+	assert.NoError(t, json.Unmarshal([]byte(delivery.Payload), &event))
+	assert.Equal(t, "post.created", event.Type)
+	assert.Equal(t, "Hooked", event.Data.Post.Title)
+
+	w = adminRequest(router, "POST", deliveriesURL+"/"+testutils.Itoa(delivery.ID)+"/redeliver", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	n, err = controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	w = adminRequest(router, "GET", deliveriesURL+"?status=delivered", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &log))
+	assert.Len(t, log.Deliveries, 1)
+	assert.NotNil(t, log.Deliveries[0].DeliveredAt)
+
+	assert.Equal(t, []string{"post.created", "post.created"}, receiver.events)
+	assert.Equal(t, []bool{true, true}, receiver.verified)
+}
+
+func TestWebhooks_DeadLetter(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+	t.Setenv("WEBHOOK_RETRY_BASE", "1ms")
+	cleanup, err := testutils.BeginTxWithSeeds()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	router := NewRouter()
+	w := adminRequest(router, "POST", "/webhooks", `{"url":"`+server.URL+`","events":["user.created"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var hook controllers.WebhookResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	// a secret is generated when none is given
+	assert.Len(t, hook.Webhook.Secret, 64)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewReader([]byte(`{"name":"Hooked"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, err = controllers.RelayOutbox(context.Background())
+	assert.NoError(t, err)
+	_, err = controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+
+	var delivery models.WebhookDelivery
+	assert.NoError(t, config.DB.Where("subscription_id = ?", hook.Webhook.ID).First(&delivery).Error)
+	assert.Equal(t, models.DeliveryDead, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, "unexpected status 500", delivery.LastError)
+
+	// dead deliveries are not retried
+	n, err := controllers.DeliverDueWebhooks(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
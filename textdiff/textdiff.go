@@ -0,0 +1,208 @@
+// Package textdiff compares texts line by line or word by word using Myers' algorithm.
+package textdiff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Edit operations
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Edit is a run of text that is kept, inserted or deleted to turn the old text into the new one
+type Edit struct {
+	Op   string `json:"op" xml:"op" yaml:"op" example:"insert"`
+	Text string `json:"text" xml:"text" yaml:"text" example:"new words"`
+}
+
+// tokens splits s into alternating runs of whitespace and non-whitespace
+var tokens = regexp.MustCompile(`\s+|\S+`)
+
+// Words diffs a and b word by word. Whitespace runs are tokens too, so joining the equal and
+// inserted texts gives back b exactly. Neighbouring edits of the same kind are merged.
+func Words(a, b string) []Edit {
+	edits := []Edit{}
+	for _, e := range diff(tokens.FindAllString(a, -1), tokens.FindAllString(b, -1)) {
+		if n := len(edits); n > 0 && edits[n-1].Op == e.Op {
+			edits[n-1].Text += e.Text
+			continue
+		}
+		edits = append(edits, e)
+	}
+	return edits
+}
+
+// Unified diffs a and b line by line in the unified format of diff -u, with context lines of
+// unchanged text around every change. Identical texts give an empty string.
+func Unified(a, b, fromName, toName string, context int) string {
+	type line struct {
+		Edit
+		a, b int // line numbers in a and b before this line
+	}
+	var lines []line
+	var changes []int
+	ai, bi := 0, 0
+	for _, e := range diff(splitLines(a), splitLines(b)) {
+		if e.Op != OpEqual {
+			changes = append(changes, len(lines))
+		}
+		lines = append(lines, line{e, ai, bi})
+		if e.Op != OpInsert {
+			ai++
+		}
+		if e.Op != OpDelete {
+			bi++
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(changes); {
+		// grow the hunk while the next change is close enough for the context to overlap
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*context+1 {
+			j++
+		}
+		start, end := max(changes[i]-context, 0), min(changes[j]+context, len(lines)-1)
+
+		aCount, bCount := 0, 0
+		for _, l := range lines[start : end+1] {
+			if l.Op != OpInsert {
+				aCount++
+			}
+			if l.Op != OpDelete {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(lines[start].a, aCount), hunkRange(lines[start].b, bCount))
+		for _, l := range lines[start : end+1] {
+			prefix := " "
+			switch l.Op {
+			case OpInsert:
+				prefix = "+"
+			case OpDelete:
+				prefix = "-"
+			}
+			out.WriteString(prefix + l.Text + "\n")
+		}
+		i = j + 1
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk side; empty sides point at the line before
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diff returns the shortest edit script from a to b, one token per edit
+func diff(a, b []string) []Edit {
+	// common prefixes and suffixes are cheap to match and keep the search small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, t := range a[:prefix] {
+		edits = append(edits, Edit{OpEqual, t})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, t := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{OpEqual, t})
+	}
+	return edits
+}
+
+// myers finds the shortest edit script with Myers' O((N+M)D) greedy algorithm, keeping the
+// furthest reaching path of every round so the script can be traced back from the end
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var reversed []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Edit{OpEqual, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, Edit{OpInsert, b[y-1]})
+		} else {
+			reversed = append(reversed, Edit{OpDelete, a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, Edit{OpEqual, a[x-1]})
+		x--
+		y--
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
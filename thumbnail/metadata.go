@@ -0,0 +1,137 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+)
+
+// ErrMalformed is returned by StripMetadata for images whose structure cannot be followed
+var ErrMalformed = errors.New("image is malformed")
+
+// uprightQuality is the JPEG quality of originals re-encoded to apply their orientation
+const uprightQuality = 92
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// StripMetadata returns the image in data without the metadata cameras and editors embed, such as
+// EXIF with its GPS position, XMP and text comments. A JPEG whose EXIF says to rotate or flip it is
+// turned upright and re-encoded, since the orientation would otherwise go with the EXIF block;
+// when it has more than maxPixels pixels it is only stripped and loses its orientation. Other
+// images keep their encoded pixels untouched, and data that is not a JPEG, PNG or WebP is
+// returned as it is.
+func StripMetadata(data []byte, maxPixels int) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		if jpegOrientation(data) != 1 {
+			if img, err := Load(bytes.NewReader(data), maxPixels); err == nil {
+				var buf bytes.Buffer
+				if err := jpeg.Encode(&buf, img.RGBA, &jpeg.Options{Quality: uprightQuality}); err != nil {
+					return nil, err
+				}
+				return buf.Bytes(), nil
+			}
+		}
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// stripJPEG drops the APP1 (EXIF and XMP) and APP13 (IPTC) segments and comments. They all come
+// before the start of scan, after which the data is copied as it is.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, ErrMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// fill byte before a marker
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return append(out, data[i:]...), nil
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return nil, ErrMalformed
+		}
+		switch marker {
+		case 0xE1, 0xED, 0xFE:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// stripPNG drops the eXIf and text chunks. Every chunk carries its own checksum, so the rest are
+// copied as they are.
+func stripPNG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end < i+12 || end > len(data) {
+			return nil, ErrMalformed
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			return out, nil
+		}
+		i = end
+	}
+	return nil, ErrMalformed
+}
+
+// stripWebP drops the EXIF and XMP chunks, clears the VP8X flags announcing them and fixes up the
+// RIFF size
+func stripWebP(data []byte) ([]byte, error) {
+	size := int(binary.LittleEndian.Uint32(data[4:])) + 8
+	if size > len(data) {
+		return nil, ErrMalformed
+	}
+	out := make([]byte, 12, size)
+	copy(out, data[:12])
+	for i := 12; i < size; {
+		if i+8 > size {
+			return nil, ErrMalformed
+		}
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length + length%2
+		if end < i+8 || end > size {
+			return nil, ErrMalformed
+		}
+		switch fourCC := string(data[i : i+4]); fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			if length < 1 {
+				return nil, ErrMalformed
+			}
+			start := len(out)
+			out = append(out, data[i:end]...)
+			// bit 3 announces EXIF and bit 2 XMP
+			out[start+8] &^= 0x08 | 0x04
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
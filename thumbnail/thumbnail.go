@@ -0,0 +1,154 @@
+// Package thumbnail makes resized copies of uploaded images using only the standard library
+// decoders (JPEG, PNG and GIF). Copies are re-encoded from pixels, so they carry none of the
+// original's metadata, and StripMetadata removes it from the originals.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Spec names a variant and the size its longer side is scaled down to
+type Spec struct {
+	Name    string
+	MaxSide int
+}
+
+// Specs are the variants made for every image, smallest first
+var Specs = []Spec{
+	{Name: "thumb", MaxSide: 160},
+	{Name: "small", MaxSide: 480},
+	{Name: "medium", MaxSide: 1200},
+}
+
+// FindSpec returns the spec called name
+func FindSpec(name string) (Spec, bool) {
+	for _, s := range Specs {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Spec{}, false
+}
+
+// Supported reports whether images of contentType can be decoded
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// ErrTooLarge is returned by Load for images with more pixels than allowed
+var ErrTooLarge = errors.New("image has too many pixels")
+
+// Image is a decoded image, turned upright according to its EXIF orientation
+type Image struct {
+	RGBA   *image.RGBA
+	Format string
+}
+
+// Load decodes the image read from r. The dimensions are checked before the pixels are decoded,
+// so an image that would not fit in maxPixels never gets allocated.
+func Load(r io.Reader, maxPixels int) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	if format == "jpeg" {
+		rgba = orient(rgba, jpegOrientation(data))
+	}
+	return &Image{RGBA: rgba, Format: format}, nil
+}
+
+// Width returns the upright width
+func (i *Image) Width() int { return i.RGBA.Bounds().Dx() }
+
+// Height returns the upright height
+func (i *Image) Height() int { return i.RGBA.Bounds().Dy() }
+
+// Resize scales img down so that its longer side is at most maxSide, averaging the source pixels
+// each target pixel covers. Images that already fit are returned as they are.
+func Resize(img *image.RGBA, maxSide int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return img
+	}
+	dw, dh := maxSide, maxSide
+	if sw >= sh {
+		dh = max(1, (sh*maxSide+sw/2)/sw)
+	} else {
+		dw = max(1, (sw*maxSide+sh/2)/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[sy*img.Stride+x0*4 : sy*img.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			o := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[o+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// Encode writes img as a JPEG when the source was a JPEG and as a PNG otherwise, so transparency
+// survives. It returns the content type and file extension written.
+func Encode(w io.Writer, img image.Image, sourceFormat string) (contentType, extension string, err error) {
+	if sourceFormat == "jpeg" {
+		return "image/jpeg", ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: 82})
+	}
+	return "image/png", ".png", png.Encode(w, img)
+}
+
+// AverageColor returns the mean color of img as #rrggbb, weighting each pixel by its opacity
+func AverageColor(img *image.RGBA) string {
+	var r, g, b, a int
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r += int(img.Pix[i])
+		g += int(img.Pix[i+1])
+		b += int(img.Pix[i+2])
+		a += int(img.Pix[i+3])
+	}
+	if a == 0 {
+		return "#000000"
+	}
+	// the pixels are alpha-premultiplied, so dividing by the total opacity undoes it
+	return fmt.Sprintf("#%02x%02x%02x", r*255/a, g*255/a, b*255/a)
+}
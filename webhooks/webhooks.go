@@ -0,0 +1,68 @@
+// Package webhooks holds the parts of outbound webhooks that do not touch the database: event
+// types, request signing and the retry schedule. Receivers can use Verify to check a delivery.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types a subscription can ask for
+const (
+	PostCreated = "post.created"
+	PostUpdated = "post.updated"
+	PostDeleted = "post.deleted"
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+)
+
+// EventTypes lists every event type, in the order they are documented
+var EventTypes = []string{PostCreated, PostUpdated, PostDeleted, UserCreated, UserUpdated}
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature header value for body sent at timestamp (Unix seconds): "sha256="
+// followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with secret. Covering the
+// timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is Sign(secret, timestamp, body), comparing in constant time
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	given, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	want, _ := strings.CutPrefix(Sign(secret, timestamp, body), "sha256=")
+	got, err := hex.DecodeString(given)
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(want)
+	return hmac.Equal(got, expected)
+}
+
+// Backoff returns how long to wait after the given failed attempt (1 for the first) before
+// trying again: base, doubling with every attempt, and never more than limit
+func Backoff(attempt int, base, limit time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}